@@ -8,10 +8,14 @@ import (
 	"strings"
 
 	"github.com/makeworld-the-better-one/amfora/bookmarks"
+	"github.com/makeworld-the-better-one/amfora/cache"
 	"github.com/makeworld-the-better-one/amfora/client"
 	"github.com/makeworld-the-better-one/amfora/config"
 	"github.com/makeworld-the-better-one/amfora/display"
+	"github.com/makeworld-the-better-one/amfora/downloads"
+	"github.com/makeworld-the-better-one/amfora/history"
 	"github.com/makeworld-the-better-one/amfora/logger"
+	"github.com/makeworld-the-better-one/amfora/sessions"
 	"github.com/makeworld-the-better-one/amfora/subscriptions"
 )
 
@@ -45,6 +49,10 @@ func main() {
 			fmt.Println("Usage:")
 			fmt.Println("amfora [URL]")
 			fmt.Println("amfora --version, -v")
+			fmt.Println("amfora tofu export [FILE]")
+			fmt.Println("amfora tofu import [--overwrite] FILE")
+			fmt.Println("amfora fetch [--header | --render] [--follow] [--width N] URL")
+			fmt.Println("amfora render [--type MEDIATYPE] [--width N] [FILE]")
 			return
 		}
 	}
@@ -55,12 +63,23 @@ func main() {
 		os.Exit(1)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "tofu" {
+		os.Exit(tofuCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		os.Exit(renderCommand(os.Args[2:]))
+	}
+
 	err = client.Init()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Client error: %v\n", err)
 		os.Exit(1)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "fetch" {
+		os.Exit(fetchCommand(os.Args[2:]))
+	}
+
 	err = subscriptions.Init()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "subscriptions.json error: %v\n", err)
@@ -71,6 +90,26 @@ func main() {
 		fmt.Fprintf(os.Stderr, "bookmarks.xml error: %v\n", err)
 		os.Exit(1)
 	}
+	err = cache.LoadRedirs(config.RedirPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "redirects.json error: %v\n", err)
+		os.Exit(1)
+	}
+	err = downloads.LoadHashes(config.DownloadHashesPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "downloads.json error: %v\n", err)
+		os.Exit(1)
+	}
+	err = sessions.Init(config.SessionDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Sessions error: %v\n", err)
+		os.Exit(1)
+	}
+	err = history.Init(config.HistoryPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "history.json error: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Initialize lower-level cview app
 	if err = display.App.Init(); err != nil {
@@ -81,6 +120,7 @@ func main() {
 	display.Init(version, commit, builtBy)
 
 	// Load a URL, file, or render from stdin
+	opened := true
 	if len(os.Args[1:]) > 0 {
 		url := os.Args[1]
 		if !strings.Contains(url, "://") || strings.HasPrefix(url, "../") || strings.HasPrefix(url, "./") {
@@ -103,8 +143,12 @@ func main() {
 		renderFromStdin()
 	} else {
 		display.NewTab()
+		opened = false
 	}
 
+	// Restore the tabs from last time, keeping what was opened above
+	display.StartSession(opened)
+
 	// Start
 	if err = display.App.Run(); err != nil {
 		panic(err)
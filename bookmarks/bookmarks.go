@@ -127,6 +127,23 @@ func Change(url, name string) {
 	}
 }
 
+// Move changes the URL of the bookmark at the provided URL, keeping its name.
+// It returns false if there is no bookmark at that URL, or there's
+// already one at the new URL.
+func Move(oldURL, newURL string) bool {
+	if _, ok := Get(newURL); ok {
+		return false
+	}
+	for _, bkmk := range data.Bookmarks {
+		if bkmk.URL == oldURL {
+			bkmk.URL = newURL
+			writeXbel() //nolint:errcheck
+			return true
+		}
+	}
+	return false
+}
+
 // Add will add a new bookmark.
 func Add(url, name string) {
 	data.Bookmarks = append(data.Bookmarks, &xbelBookmark{
@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Functions for the persistent page cache, which stores raw responses on disk
+// so they can be used after a restart, and while offline.
+
+// Response is a raw response as it was received over the network.
+type Response struct {
+	URL     string    `json:"url"`
+	Status  int       `json:"status"`
+	Meta    string    `json:"meta"`
+	Body    []byte    `json:"body"`
+	Fetched time.Time `json:"fetched"`
+}
+
+var diskDir string // Empty if the persistent cache is disabled
+var diskMu = sync.Mutex{}
+
+// SetDiskDir sets the directory where responses are stored, enabling
+// the persistent cache. An empty string disables it.
+func SetDiskDir(dir string) {
+	diskMu.Lock()
+	defer diskMu.Unlock()
+	diskDir = dir
+}
+
+// DiskEnabled returns whether the persistent cache is enabled.
+func DiskEnabled() bool {
+	diskMu.Lock()
+	defer diskMu.Unlock()
+	return diskDir != ""
+}
+
+// diskPath returns the path of the file for the URL.
+func diskPath(url string) string {
+	return filepath.Join(diskDir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(url))))
+}
+
+// AddResponse stores a response on disk, removing the oldest responses
+// as needed to keep the persistent cache inside the max size.
+// It does nothing if the persistent cache is disabled.
+func AddResponse(r *Response) error {
+	diskMu.Lock()
+	defer diskMu.Unlock()
+
+	if diskDir == "" || r.URL == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxSize && maxSize > 0 {
+		// This response can never be added
+		return nil
+	}
+	if err := os.MkdirAll(diskDir, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(diskPath(r.URL), data, 0600); err != nil {
+		return err
+	}
+	return pruneDisk()
+}
+
+// pruneDisk removes the least recently fetched responses until the
+// persistent cache fits in the max size. The caller must hold diskMu.
+func pruneDisk() error {
+	if maxSize <= 0 {
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(diskDir)
+	if err != nil {
+		return err
+	}
+	size := 0
+	for _, f := range files {
+		size += int(f.Size())
+	}
+	if size <= maxSize {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, f := range files {
+		if size <= maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(diskDir, f.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		size -= int(f.Size())
+	}
+	return nil
+}
+
+// GetResponse returns the stored response for the URL, no matter how old it is,
+// and a bool indicating if it was found.
+func GetResponse(url string) (*Response, bool) {
+	diskMu.Lock()
+	defer diskMu.Unlock()
+
+	if diskDir == "" {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(diskPath(url))
+	if err != nil {
+		return nil, false
+	}
+	var r Response
+	if err := json.Unmarshal(data, &r); err != nil || r.URL != url {
+		return nil, false
+	}
+	return &r, true
+}
+
+// GetFreshResponse is like GetResponse, but it only returns responses that
+// are within the cache timeout.
+func GetFreshResponse(url string) (*Response, bool) {
+	r, ok := GetResponse(url)
+	if ok && (timeout == 0 || time.Since(r.Fetched) < timeout) {
+		return r, true
+	}
+	return nil, false
+}
+
+// AllResponses returns every stored response, the most recently fetched
+// first. Files that can't be read are skipped.
+func AllResponses() []*Response {
+	diskMu.Lock()
+	defer diskMu.Unlock()
+
+	rs := make([]*Response, 0)
+	if diskDir == "" {
+		return rs
+	}
+	files, err := ioutil.ReadDir(diskDir)
+	if err != nil {
+		return rs
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(diskDir, f.Name()))
+		if err != nil {
+			continue
+		}
+		var r Response
+		if json.Unmarshal(data, &r) != nil || r.URL == "" {
+			continue
+		}
+		rs = append(rs, &r)
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Fetched.After(rs[j].Fetched)
+	})
+	return rs
+}
+
+// RemoveResponse removes the stored response for the URL.
+// Even if it doesn't exist there will be no error.
+func RemoveResponse(url string) {
+	diskMu.Lock()
+	defer diskMu.Unlock()
+
+	if diskDir == "" {
+		return
+	}
+	os.Remove(diskPath(url)) //nolint:errcheck
+}
+
+// ClearResponses removes all stored responses.
+func ClearResponses() error {
+	diskMu.Lock()
+	defer diskMu.Unlock()
+
+	if diskDir == "" {
+		return nil
+	}
+	files, err := ioutil.ReadDir(diskDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		if err := os.Remove(filepath.Join(diskDir, f.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
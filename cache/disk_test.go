@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisk(t *testing.T) {
+	reset()
+	SetDiskDir(t.TempDir())
+	defer SetDiskDir("")
+
+	r := &Response{URL: "gemini://example.com/", Status: 20, Meta: "text/gemini", Body: []byte("# Hi"), Fetched: time.Now()}
+	assert.NoError(t, AddResponse(r))
+	got, ok := GetResponse(r.URL)
+	if assert.True(t, ok, "response should be found") {
+		assert.Equal(t, r.Body, got.Body)
+		assert.Equal(t, r.Meta, got.Meta)
+	}
+
+	all := AllResponses()
+	if assert.Len(t, all, 1) {
+		assert.Equal(t, r.URL, all[0].URL)
+	}
+
+	RemoveResponse(r.URL)
+	_, ok = GetResponse(r.URL)
+	assert.False(t, ok, "response should be removed")
+
+	assert.NoError(t, AddResponse(r))
+	assert.NoError(t, ClearResponses())
+	_, ok = GetResponse(r.URL)
+	assert.False(t, ok, "responses should be cleared")
+}
+
+func TestDiskTimeout(t *testing.T) {
+	reset()
+	SetDiskDir(t.TempDir())
+	defer SetDiskDir("")
+	SetTimeout(60)
+	defer SetTimeout(0)
+
+	r := &Response{URL: "gemini://example.com/", Status: 20, Meta: "text/gemini", Fetched: time.Now().Add(-time.Hour)}
+	assert.NoError(t, AddResponse(r))
+	_, ok := GetFreshResponse(r.URL)
+	assert.False(t, ok, "old response shouldn't be fresh")
+	_, ok = GetResponse(r.URL)
+	assert.True(t, ok, "old response should still be available for offline mode")
+}
+
+func TestDiskMaxSize(t *testing.T) {
+	reset()
+	SetDiskDir(t.TempDir())
+	defer SetDiskDir("")
+
+	r := &Response{URL: "gemini://example.com/", Status: 20, Meta: "text/gemini", Body: make([]byte, 100)}
+	r2 := &Response{URL: "gemini://example.org/", Status: 20, Meta: "text/gemini", Body: make([]byte, 100)}
+	SetMaxSize(300)
+	assert.NoError(t, AddResponse(r))
+	time.Sleep(10 * time.Millisecond) // Make sure modification times are different
+	assert.NoError(t, AddResponse(r2))
+	_, ok := GetResponse(r.URL)
+	assert.False(t, ok, "oldest response should be removed to stay under max size")
+	_, ok = GetResponse(r2.URL)
+	assert.True(t, ok, "newest response should be kept")
+}
@@ -3,14 +3,25 @@
 package cache
 
 import (
+	"container/list"
 	"sync"
 	"time"
 
 	"github.com/makeworld-the-better-one/amfora/structs"
 )
 
-var pages = make(map[string]*structs.Page) // The actual cache
-var urls = make([]string, 0)               // Duplicate of the keys in the `pages` map, but in order of being added
+// entry is a page in the cache, with data used for its management.
+type entry struct {
+	page     *structs.Page
+	size     int // Size of the page when it was added
+	lastUsed time.Time
+}
+
+var pages = make(map[string]*list.Element) // The actual cache, elements hold an *entry
+var lru = list.New()                       // Pages ordered by use, the most recently used page is at the front
+var curSize = 0                            // Running total of the size of all pages in bytes
+var hits = 0                               // Number of times GetPage found a page
+var misses = 0                             // Number of times GetPage didn't
 var maxPages = 0                           // Max allowed number of pages in cache
 var maxSize = 0                            // Max allowed cache size in bytes
 var mu = sync.RWMutex{}
@@ -38,22 +49,15 @@ func SetTimeout(t int) {
 	timeout = time.Duration(t) * time.Second
 }
 
-func removeIndex(s []string, i int) []string {
-	s[len(s)-1], s[i] = s[i], s[len(s)-1]
-	return s[:len(s)-1]
-}
-
-func removeURL(url string) {
-	for i := range urls {
-		if urls[i] == url {
-			urls = removeIndex(urls, i)
-			return
-		}
-	}
+// removeElement removes a page from the cache. The caller must hold mu.
+func removeElement(el *list.Element) {
+	e := lru.Remove(el).(*entry)
+	delete(pages, e.page.URL)
+	curSize -= e.size
 }
 
-// AddPage adds a page to the cache, removing earlier pages as needed
-// to keep the cache inside its limits.
+// AddPage adds a page to the cache, removing the least recently used pages
+// as needed to keep the cache inside its limits.
 //
 // If your page is larger than the max cache size, the provided page
 // will silently not be added to the cache.
@@ -63,28 +67,30 @@ func AddPage(p *structs.Page) {
 		return
 	}
 
-	if p.Size() > maxSize && maxSize > 0 {
+	size := p.Size()
+	if size > maxSize && maxSize > 0 {
 		// This page can never be added
 		return
 	}
 
-	// Remove earlier pages to make room for this one
-	// There should only ever be 1 page to remove at most,
-	// but this handles more just in case.
-	for NumPages() >= maxPages && maxPages > 0 {
-		RemovePage(urls[0])
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Remove the old version if it was already there
+	if el, ok := pages[p.URL]; ok {
+		removeElement(el)
+	}
+
+	// Remove the least recently used pages to make room for this one
+	for lru.Len() >= maxPages && maxPages > 0 {
+		removeElement(lru.Back())
 	}
-	// Do the same but for cache size
-	for SizePages()+p.Size() > maxSize && maxSize > 0 {
-		RemovePage(urls[0])
+	for curSize+size > maxSize && maxSize > 0 {
+		removeElement(lru.Back())
 	}
 
-	mu.Lock()
-	defer mu.Unlock()
-	pages[p.URL] = p
-	// Remove the URL if it was already there, then add it to the end
-	removeURL(p.URL)
-	urls = append(urls, p.URL)
+	pages[p.URL] = lru.PushFront(&entry{page: p, size: size, lastUsed: time.Now()})
+	curSize += size
 }
 
 // RemovePage will remove a page from the cache.
@@ -92,27 +98,25 @@ func AddPage(p *structs.Page) {
 func RemovePage(url string) {
 	mu.Lock()
 	defer mu.Unlock()
-	delete(pages, url)
-	removeURL(url)
+	if el, ok := pages[url]; ok {
+		removeElement(el)
+	}
 }
 
 // ClearPages removes all pages from the cache.
 func ClearPages() {
 	mu.Lock()
 	defer mu.Unlock()
-	pages = make(map[string]*structs.Page)
-	urls = make([]string, 0)
+	pages = make(map[string]*list.Element)
+	lru.Init()
+	curSize = 0
 }
 
 // SizePages returns the approx. current size of the cache in bytes.
 func SizePages() int {
 	mu.RLock()
 	defer mu.RUnlock()
-	n := 0
-	for _, page := range pages {
-		n += page.Size()
-	}
-	return n
+	return curSize
 }
 
 func NumPages() int {
@@ -124,12 +128,79 @@ func NumPages() int {
 // GetPage returns the page struct, and a bool indicating if the page was in the cache or not.
 // (nil, false) is returned if the page isn't in the cache.
 func GetPage(url string) (*structs.Page, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	el, ok := pages[url]
+	if !ok {
+		misses++
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if timeout != 0 && time.Since(e.page.MadeAt) >= timeout {
+		// Expired, it won't be used again
+		removeElement(el)
+		misses++
+		return nil, false
+	}
+
+	hits++
+	e.lastUsed = time.Now()
+	lru.MoveToFront(el)
+	return e.page, true
+}
+
+// PageInfo describes a page in the cache.
+type PageInfo struct {
+	URL      string
+	Size     int
+	MadeAt   time.Time
+	LastUsed time.Time
+}
+
+// Stats describes the page cache.
+type Stats struct {
+	Pages  int
+	Size   int
+	Hits   int
+	Misses int
+}
+
+// GetStats returns the current stats of the page cache.
+func GetStats() Stats {
+	mu.RLock()
+	defer mu.RUnlock()
+	return Stats{Pages: len(pages), Size: curSize, Hits: hits, Misses: misses}
+}
+
+// AllPages returns info about every page in the cache,
+// with the most recently used page first.
+func AllPages() []PageInfo {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	infos := make([]PageInfo, 0, lru.Len())
+	for el := lru.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*entry)
+		infos = append(infos, PageInfo{
+			URL:      e.page.URL,
+			Size:     e.size,
+			MadeAt:   e.page.MadeAt,
+			LastUsed: e.lastUsed,
+		})
+	}
+	return infos
+}
+
+// Pages returns every page in the cache, with the most recently used page
+// first. Unlike GetPage, it doesn't count as a hit or change the order.
+func Pages() []*structs.Page {
 	mu.RLock()
 	defer mu.RUnlock()
 
-	p, ok := pages[url]
-	if ok && (timeout == 0 || time.Since(p.MadeAt) < timeout) {
-		return p, ok
+	ps := make([]*structs.Page, 0, lru.Len())
+	for el := lru.Front(); el != nil; el = el.Next() {
+		ps = append(ps, el.Value.(*entry).page)
 	}
-	return nil, false
+	return ps
 }
@@ -32,7 +32,7 @@ func TestMaxSize(t *testing.T) {
 	assert.Equal(1, NumPages(), "one page should be added")
 	AddPage(&p2)
 	assert.Equal(1, NumPages(), "there should still be just one page due to cache size limits")
-	assert.Equal(p2.URL, urls[0], "the only page url should be the second page one")
+	assert.Equal(p2.URL, lru.Front().Value.(*entry).page.URL, "the only page url should be the second page one")
 }
 
 func TestRemove(t *testing.T) {
@@ -47,7 +47,7 @@ func TestClearAndNumPages(t *testing.T) {
 	AddPage(&p)
 	ClearPages()
 	assert.Equal(t, 0, len(pages), "map should be empty")
-	assert.Equal(t, 0, len(urls), "urls slice shoulde be empty")
+	assert.Equal(t, 0, lru.Len(), "lru list should be empty")
 	assert.Equal(t, 0, NumPages(), "NumPages should report empty too")
 }
 
@@ -69,3 +69,35 @@ func TestGet(t *testing.T) {
 		t.Error("page urls don't match")
 	}
 }
+
+func TestLRU(t *testing.T) {
+	reset()
+	p3 := structs.Page{URL: "example.net"}
+	SetMaxPages(2)
+	AddPage(&p)
+	AddPage(&p2)
+	GetPage(p.URL) // p is now more recently used than p2
+	AddPage(&p3)
+	_, ok := GetPage(p.URL)
+	assert.True(t, ok, "recently used page should be kept")
+	_, ok = GetPage(p2.URL)
+	assert.False(t, ok, "least recently used page should be removed")
+}
+
+func TestStats(t *testing.T) {
+	reset()
+	before := GetStats()
+	AddPage(&p)
+	GetPage(p.URL)
+	GetPage(p2.URL)
+	stats := GetStats()
+	assert.Equal(t, before.Hits+1, stats.Hits)
+	assert.Equal(t, before.Misses+1, stats.Misses)
+	assert.Equal(t, 1, stats.Pages)
+	assert.Equal(t, p.Size(), stats.Size)
+	assert.Equal(t, p.URL, AllPages()[0].URL)
+
+	// Listing the pages doesn't count as a hit
+	assert.Equal(t, []*structs.Page{&p}, Pages())
+	assert.Equal(t, stats.Hits, GetStats().Hits)
+}
@@ -1,23 +1,118 @@
 package cache
 
-import "sync"
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
 
 // Functions for caching redirects.
 
-var redirUrls = make(map[string]string) // map original URL to redirect
+// redirect is where a URL redirects to.
+type redirect struct {
+	URL    string    `json:"url"`
+	Status int       `json:"status"` // The status code that produced the redirect
+	Added  time.Time `json:"added"`
+	// Temp redirects are only kept in memory, and never saved to the file
+	Temp bool `json:"-"`
+}
+
+// redirJSON is the format of the redirects file.
+type redirJSON struct {
+	Redirects map[string]*redirect `json:"redirects"`
+}
+
+var redirUrls = make(map[string]*redirect) // map original URL to redirect
 var redirMu = sync.RWMutex{}
+var redirPath string // The file redirects are saved to, empty if they aren't saved
+var redirExpiry = time.Duration(0)
+
+// SetRedirExpiry sets the max number of seconds a redirect is remembered for.
+// A value <= 0 means forever.
+func SetRedirExpiry(t int) {
+	redirMu.Lock()
+	defer redirMu.Unlock()
+
+	if t <= 0 {
+		redirExpiry = time.Duration(0)
+		return
+	}
+	redirExpiry = time.Duration(t) * time.Second
+}
+
+// expired returns whether the redirect is too old to be used.
+// The caller must hold redirMu.
+func (r *redirect) expired() bool {
+	return redirExpiry != 0 && time.Since(r.Added) >= redirExpiry
+}
+
+// LoadRedirs loads the redirects saved in the file, and saves all
+// future redirects there. It is fine if the file doesn't exist yet.
+func LoadRedirs(path string) error {
+	redirMu.Lock()
+	defer redirMu.Unlock()
+
+	redirPath = path
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	var j redirJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	for og, r := range j.Redirects {
+		if r == nil || r.URL == "" || r.expired() {
+			continue
+		}
+		redirUrls[og] = r
+	}
+	return nil
+}
 
-// AddRedir adds a original-to-redirect pair to the cache.
-func AddRedir(og, redir string) {
+// writeRedirs saves the redirects to the file, if there is one.
+// The caller must hold redirMu.
+func writeRedirs() {
+	if redirPath == "" {
+		return
+	}
+	saved := make(map[string]*redirect, len(redirUrls))
+	for og, r := range redirUrls {
+		if !r.Temp {
+			saved[og] = r
+		}
+	}
+	data, err := json.MarshalIndent(&redirJSON{Redirects: saved}, "", "  ")
+	if err != nil {
+		return
+	}
+	ioutil.WriteFile(redirPath, data, 0666) //nolint:errcheck // Only cached data
+}
+
+// AddRedir adds a original-to-redirect pair to the cache, with the status
+// code of the redirect. It is only used for permanent redirects.
+// If temp is true the redirect is only kept in memory, for things that
+// shouldn't be saved to disk.
+func AddRedir(og, redir string, status int, temp bool) {
 	redirMu.Lock()
 	defer redirMu.Unlock()
 
+	now := time.Now()
 	for k, v := range redirUrls {
-		if og == v {
+		if og == v.URL {
 			// The original URL param is the redirect URL for `k`.
 			// This means there is a chain: k -> og -> redir
 			// The chain should be removed
-			redirUrls[k] = redir
+			redirUrls[k] = &redirect{URL: redir, Status: status, Added: now, Temp: v.Temp || temp}
 		}
 		if redir == k {
 			// There's a loop
@@ -25,13 +120,15 @@ func AddRedir(og, redir string) {
 			delete(redirUrls, k)
 		}
 	}
-	redirUrls[og] = redir
+	redirUrls[og] = &redirect{URL: redir, Status: status, Added: now, Temp: temp}
+	writeRedirs()
 }
 
 // ClearRedirs removes all redirects from the cache.
 func ClearRedirs() {
 	redirMu.Lock()
-	redirUrls = make(map[string]string)
+	redirUrls = make(map[string]*redirect)
+	writeRedirs()
 	redirMu.Unlock()
 }
 
@@ -45,8 +142,8 @@ func Redirect(u string) string {
 	// A single lookup is enough, because AddRedir
 	// removes loops and chains.
 	redir, ok := redirUrls[u]
-	if ok {
-		return redir
+	if ok && !redir.expired() {
+		return redir.URL
 	}
 	return u
 }
@@ -56,3 +153,27 @@ func NumRedirs() int {
 	defer redirMu.RUnlock()
 	return len(redirUrls)
 }
+
+// RemoveRedir removes the redirect for the original URL from the cache.
+// Even if it doesn't exist there will be no error.
+func RemoveRedir(og string) {
+	redirMu.Lock()
+	defer redirMu.Unlock()
+	delete(redirUrls, og)
+	writeRedirs()
+}
+
+// AllRedirs returns a copy of all the redirects in the cache,
+// mapping original URLs to where they redirect.
+func AllRedirs() map[string]string {
+	redirMu.RLock()
+	defer redirMu.RUnlock()
+
+	m := make(map[string]string, len(redirUrls))
+	for k, v := range redirUrls {
+		if !v.expired() {
+			m[k] = v.URL
+		}
+	}
+	return m
+}
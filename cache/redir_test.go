@@ -1,24 +1,69 @@
 package cache
 
 import (
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestAddRedir(t *testing.T) {
 	ClearRedirs()
-	AddRedir("A", "B")
+	AddRedir("A", "B", 31, false)
 	assert.Equal(t, "B", Redirect("A"), "A redirects to B")
 
 	// Chain
-	AddRedir("B", "C")
+	AddRedir("B", "C", 31, false)
 	assert.Equal(t, "C", Redirect("B"), "B redirects to C")
 	assert.Equal(t, "C", Redirect("A"), "A now redirects to C too")
 
 	// Loop
 	ClearRedirs()
-	AddRedir("A", "B")
-	AddRedir("B", "A")
+	AddRedir("A", "B", 31, false)
+	AddRedir("B", "A", 31, false)
 	assert.Equal(t, "A", Redirect("B"), "B redirects to A - most recent version of loop is used")
 }
+
+func TestRemoveRedir(t *testing.T) {
+	ClearRedirs()
+	AddRedir("A", "B", 31, false)
+	AddRedir("C", "D", 31, false)
+	RemoveRedir("A")
+	assert.Equal(t, "A", Redirect("A"), "A shouldn't redirect anymore")
+	assert.Equal(t, map[string]string{"C": "D"}, AllRedirs())
+}
+
+func TestPersistRedirs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redirects.json")
+	ClearRedirs()
+	assert.NoError(t, LoadRedirs(path), "missing file should be fine")
+	defer func() { redirPath = "" }()
+
+	AddRedir("A", "B", 31, false)
+	redirUrls = make(map[string]*redirect) // Forget without saving
+	assert.NoError(t, LoadRedirs(path))
+	assert.Equal(t, "B", Redirect("A"), "redirect should be loaded from the file")
+	assert.Equal(t, 31, redirUrls["A"].Status)
+
+	// Temp redirects are used, but not saved
+	AddRedir("C", "D", 31, true)
+	AddRedir("D", "E", 30, false)
+	assert.Equal(t, "E", Redirect("C"))
+	assert.Equal(t, 30, redirUrls["C"].Status, "the status that was received is kept")
+	redirUrls = make(map[string]*redirect)
+	assert.NoError(t, LoadRedirs(path))
+	assert.Equal(t, "C", Redirect("C"), "temp redirects aren't saved, even in a chain")
+	assert.Equal(t, "E", Redirect("D"))
+}
+
+func TestRedirExpiry(t *testing.T) {
+	ClearRedirs()
+	SetRedirExpiry(60)
+	defer SetRedirExpiry(0)
+
+	AddRedir("A", "B", 31, false)
+	redirUrls["A"].Added = time.Now().Add(-time.Hour)
+	assert.Equal(t, "A", Redirect("A"), "expired redirect shouldn't be used")
+	assert.Equal(t, 0, len(AllRedirs()))
+}
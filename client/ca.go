@@ -0,0 +1,144 @@
+package client
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/viper"
+)
+
+// Certificate verification policies, see the [tls] section of the config.
+const (
+	PolicyTofu       = "tofu"
+	PolicyCA         = "ca"
+	PolicyCAOrTofu   = "ca-or-tofu"
+	PolicyPinnedOnly = "pinned-only"
+)
+
+// ErrNotPinned is returned for hosts that aren't in the TOFU database
+// when the pinned-only policy is used.
+var ErrNotPinned = errors.New("server cert is not in TOFU database")
+
+var (
+	defaultPolicy string
+	hostPolicies  = make(map[string]string) // Keyed by idKey
+
+	// Pools used for CA verification. caRoots is nil if only
+	// the system pool is used.
+	caRoots         *x509.CertPool
+	caIntermediates *x509.CertPool
+)
+
+func validPolicy(p string) bool {
+	return p == PolicyTofu || p == PolicyCA || p == PolicyCAOrTofu || p == PolicyPinnedOnly
+}
+
+// caInit loads the [tls] section of the config.
+func caInit() error {
+	defaultPolicy = strings.ToLower(viper.GetString("tls.policy"))
+	if !validPolicy(defaultPolicy) {
+		return fmt.Errorf("[tls]: invalid policy: %s", defaultPolicy) //nolint:goerr113
+	}
+
+	if policiesViper := viper.Sub("tls.policies"); policiesViper != nil {
+		for _, host := range policiesViper.AllKeys() {
+			p := strings.ToLower(policiesViper.GetString(host))
+			if !validPolicy(p) {
+				return fmt.Errorf("[tls.policies]: invalid policy for %s: %s", host, p) //nolint:goerr113
+			}
+			hostname, port, err := net.SplitHostPort(host)
+			if err != nil {
+				// No port
+				hostname, port = host, ""
+			}
+			hostPolicies[idKey(hostname, port)] = p
+		}
+	}
+
+	bundlePath := viper.GetString("tls.ca_bundle")
+	if bundlePath == "" {
+		return nil
+	}
+	bundlePath, err := homedir.Expand(bundlePath)
+	if err != nil {
+		return fmt.Errorf("[tls]: ca_bundle: %w", err)
+	}
+	bundle, err := ioutil.ReadFile(bundlePath)
+	if err != nil {
+		return fmt.Errorf("[tls]: ca_bundle: %w", err)
+	}
+	caRoots, err = x509.SystemCertPool()
+	if err != nil {
+		// The system pool isn't available on all platforms
+		caRoots = x509.NewCertPool()
+	}
+	caIntermediates = x509.NewCertPool()
+	if !caRoots.AppendCertsFromPEM(bundle) {
+		return errors.New("[tls]: ca_bundle: no certificates found in " + bundlePath) //nolint:goerr113
+	}
+	// The bundle can provide intermediate certs as well, since servers can't
+	caIntermediates.AppendCertsFromPEM(bundle)
+	return nil
+}
+
+// tlsPolicy returns the certificate verification policy for a host.
+func tlsPolicy(domain, port string) string {
+	if p, ok := hostPolicies[idKey(domain, port)]; ok {
+		return p
+	}
+	return defaultPolicy
+}
+
+// VerifyCA checks whether the cert is signed by a trusted CA, and is valid
+// for the given hostname. A nil error means it is.
+//
+// Only the leaf cert of a server is available, so servers that rely on
+// sending intermediate certs will fail verification, unless the
+// intermediate certs are in the configured CA bundle.
+func VerifyCA(cert *x509.Certificate, hostname string) error {
+	_, err := cert.Verify(x509.VerifyOptions{
+		DNSName:       hostname,
+		Roots:         caRoots,
+		Intermediates: caIntermediates,
+	})
+	return err
+}
+
+// handleCert checks the server cert according to the policy for the host.
+// A nil error means the connection can go ahead.
+func handleCert(domain, port string, cert *x509.Certificate) error {
+	switch tlsPolicy(domain, port) {
+	case PolicyCA:
+		if err := VerifyCA(cert, domain); err != nil {
+			return fmt.Errorf("certificate for %s couldn't be verified with a CA: %w", domain, err)
+		}
+		return nil
+	case PolicyCAOrTofu:
+		if VerifyCA(cert, domain) == nil {
+			// Still save it, so that a switch to a self-signed cert is noticed
+			saveTofuEntry(domain, port, cert)
+			return nil
+		}
+	case PolicyPinnedOnly:
+		tofuStoreMu.Lock()
+		e := getTofuEntry(domain, port)
+		if e == nil {
+			// Stored so the user can look at it and trust it
+			mismatches[idKey(domain, port)] = cert
+		}
+		tofuStoreMu.Unlock()
+		if e == nil {
+			return ErrNotPinned
+		}
+	}
+
+	if !handleTofu(domain, port, cert) {
+		return ErrTofu
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeCert creates a cert for the host, signed by the parent, or self-signed
+// if parent is nil.
+func makeCert(t *testing.T, host string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if !isCA {
+		template.DNSNames = []string{host}
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestHandleCert(t *testing.T) {
+	oldStore := tofuStore
+	tofuStore = viper.New()
+	defer func() { tofuStore = oldStore }()
+
+	ca, caKey := makeCert(t, "Test CA", true, nil, nil)
+	caRoots = x509.NewCertPool()
+	caRoots.AddCert(ca)
+	defer func() { caRoots = nil }()
+
+	signed, _ := makeCert(t, "ca.example", false, ca, caKey)
+	selfSigned, _ := makeCert(t, "ca.example", false, nil, nil)
+
+	defaultPolicy = PolicyCA
+	defer func() { defaultPolicy = "" }()
+	assert.NoError(t, handleCert("ca.example", "", signed))
+	assert.Error(t, handleCert("ca.example", "", selfSigned), "self-signed cert should fail CA policy")
+	assert.Error(t, handleCert("other.example", "", signed), "cert for a different host should fail CA policy")
+
+	hostPolicies[idKey("pinned.example", "")] = PolicyPinnedOnly
+	defer delete(hostPolicies, idKey("pinned.example", ""))
+	assert.ErrorIs(t, handleCert("pinned.example", "", selfSigned), ErrNotPinned)
+	saveTofuEntry("pinned.example", "", selfSigned)
+	assert.NoError(t, handleCert("pinned.example", "", selfSigned))
+
+	hostPolicies[idKey("mixed.example", "")] = PolicyCAOrTofu
+	defer delete(hostPolicies, idKey("mixed.example", ""))
+	mixed, _ := makeCert(t, "mixed.example", false, ca, caKey)
+	assert.NoError(t, handleCert("mixed.example", "", mixed))
+	assert.ErrorIs(t, handleCert("mixed.example", "", selfSigned), ErrTofu,
+		"self-signed cert should be checked against the pinned CA-signed one")
+}
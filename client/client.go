@@ -1,4 +1,4 @@
-// Package client retrieves data over Gemini and implements a TOFU system.
+// Package client retrieves data over Gemini and other small web protocols, and implements a TOFU system.
 package client
 
 import (
@@ -29,6 +29,10 @@ var (
 	confCerts = make(map[certMapKey]string)
 	confKeys  = make(map[certMapKey]string)
 
+	// Map URL scopes to the name of the identity bound to them, see identity.go
+	identityScopes   = make(map[certMapKey]string)
+	identityScopesMu = &sync.RWMutex{}
+
 	// Cache the cert and key assigned to different URLs
 	certCache   = make(map[certMapKey][][]byte)
 	certCacheMu = &sync.RWMutex{}
@@ -70,33 +74,79 @@ func Init() error {
 		confKeys[certMapKey{pu.Host, pu.Path}] = keysViper.GetString(keyURL)
 	}
 
-	return nil
+	httpInit()
+
+	if err := caInit(); err != nil {
+		return err
+	}
+	return loadIdentities()
 }
 
-// getCertPath returns the path of the cert from the config.
-// It returns "" if no config value exists.
-func getCertPath(host string, path string) string {
-	for k, v := range confCerts {
+// matchCertMapKey returns the value in the map whose key matches the host and path
+// most specifically, along with the length of the matched key path.
+// A key matches if it has the same host, and its path is the same as or a
+// prefix of the provided path.
+// It returns "" and -1 if nothing matches.
+func matchCertMapKey(m map[certMapKey]string, host string, path string) (string, int) {
+	match := ""
+	matchLen := -1
+	for k, v := range m {
 		if k.host == host && (k.path == path || strings.HasPrefix(path, k.path)) {
 			// Either exact match to what's in config, or a subpath
-			return v
+			if len(k.path) > matchLen {
+				match = v
+				matchLen = len(k.path)
+			}
 		}
 	}
-	// No matches
+	return match, matchLen
+}
+
+// identityMatch returns the name of the identity bound to the host and path,
+// if it is more specific than the provided config match length.
+// It returns "" otherwise.
+func identityMatch(host string, path string, confLen int) string {
+	identityScopesMu.RLock()
+	defer identityScopesMu.RUnlock()
+
+	name, n := matchCertMapKey(identityScopes, host, path)
+	if n > confLen {
+		return name
+	}
 	return ""
 }
 
-// getKeyPath returns the path of the key from the config.
-// It returns "" if no config value exists.
+// getCertPath returns the path of the cert from the config, or from the
+// identity bound to the URL. The most specific match is used, and the config
+// wins if both are equally specific.
+// It returns "" if no value exists.
+func getCertPath(host string, path string) string {
+	v, n := matchCertMapKey(confCerts, host, path)
+	if name := identityMatch(host, path, n); name != "" {
+		certPath, _ := identityPaths(name)
+		return certPath
+	}
+	return v
+}
+
+// getKeyPath returns the path of the key from the config, or from the
+// identity bound to the URL. It follows the same rules as getCertPath.
+// It returns "" if no value exists.
 func getKeyPath(host string, path string) string {
-	for k, v := range confKeys {
-		if k.host == host && (k.path == path || strings.HasPrefix(path, k.path)) {
-			// Either exact match to what's in config, or a subpath
-			return v
-		}
+	v, n := matchCertMapKey(confKeys, host, path)
+	if name := identityMatch(host, path, n); name != "" {
+		_, keyPath := identityPaths(name)
+		return keyPath
 	}
-	// No matches
-	return ""
+	return v
+}
+
+// resetCertCache removes all cached certs, so that changes to which certs
+// are assigned to URLs take effect.
+func resetCertCache() {
+	certCacheMu.Lock()
+	certCache = make(map[certMapKey][][]byte)
+	certCacheMu.Unlock()
 }
 
 func clientCert(host string, path string) ([]byte, []byte) {
@@ -170,17 +220,42 @@ func fetch(u string, c *gemini.Client) (*gemini.Response, error) {
 		return nil, err
 	}
 
-	ok := handleTofu(parsed.Hostname(), parsed.Port(), res.Cert)
-	if !ok {
-		return res, ErrTofu
+	err = handleCert(parsed.Hostname(), parsed.Port(), res.Cert)
+	if errors.Is(err, ErrTofu) || errors.Is(err, ErrNotPinned) {
+		// The response is returned so the user can choose to trust it
+		return res, err
+	}
+	if err != nil {
+		res.Body.Close()
+		return nil, err
 	}
 
-	return res, err
+	return res, nil
 }
 
 // Fetch returns response data and an error.
 // The error text is human friendly and should be displayed.
+// Gopher, Spartan, Titan, HTTP, finger, and nex URLs are supported too, see
+// FetchGopher, FetchSpartan, FetchTitan, FetchHTTP, FetchFinger, and FetchNex.
 func Fetch(u string) (*gemini.Response, error) {
+	if strings.HasPrefix(u, "gopher://") {
+		return FetchGopher(u)
+	}
+	if strings.HasPrefix(u, "spartan://") {
+		return FetchSpartan(u)
+	}
+	if strings.HasPrefix(u, "titan://") {
+		return FetchTitan(u)
+	}
+	if strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") {
+		return FetchHTTP(u)
+	}
+	if strings.HasPrefix(u, "finger://") {
+		return FetchFinger(u)
+	}
+	if strings.HasPrefix(u, "nex://") {
+		return FetchNex(u)
+	}
 	return fetch(u, fetchClient)
 }
 
@@ -200,9 +275,13 @@ func fetchWithProxy(proxyHostname, proxyPort, u string, c *gemini.Client) (*gemi
 	}
 
 	// Only associate the returned cert with the proxy
-	ok := handleTofu(proxyHostname, proxyPort, res.Cert)
-	if !ok {
-		return res, ErrTofu
+	err = handleCert(proxyHostname, proxyPort, res.Cert)
+	if errors.Is(err, ErrTofu) || errors.Is(err, ErrNotPinned) {
+		return res, err
+	}
+	if err != nil {
+		res.Body.Close()
+		return nil, err
 	}
 
 	return res, nil
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"bufio"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/makeworld-the-better-one/go-gemini"
+)
+
+// FetchFinger fetches a finger URL, and returns it as a Gemini response
+// with plain text. The user can be in the path, like finger://example.com/user,
+// or before the host, like finger://user@example.com.
+func FetchFinger(u string) (*gemini.Response, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	user := strings.TrimPrefix(parsed.Path, "/")
+	if user == "" && parsed.User != nil {
+		user = parsed.User.Username()
+	}
+
+	port := parsed.Port()
+	if port == "" {
+		port = "79"
+	}
+	conn, err := nativeDial(net.JoinHostPort(parsed.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	setNativeDeadline(conn)
+
+	if _, err := conn.Write([]byte(user + "\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newNativeResponse(20, "text/plain", conn, bufio.NewReader(conn)), nil
+}
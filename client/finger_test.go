@@ -0,0 +1,26 @@
+package client
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchFinger(t *testing.T) {
+	host := gopherServer(t, func(request string) string {
+		return "user: " + request
+	})
+
+	for _, u := range []string{"finger://" + host + "/alice", "finger://alice@" + host} {
+		res, err := Fetch(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(t, 20, res.Status)
+		assert.Equal(t, "text/plain", res.Meta)
+		assert.Equal(t, "user: alice\r\n", string(body), u)
+	}
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"mime"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/makeworld-the-better-one/go-gemini"
+)
+
+var ErrGopherType = errors.New("gopher item type can't be fetched")
+
+// gopherMeta returns the mediatype for a gopher item type. The selector is
+// used to guess the mediatype of files that don't have a specific type.
+func gopherMeta(itemType byte, selector string) string {
+	byExt, _, _ := mime.ParseMediaType(mime.TypeByExtension(path.Ext(selector)))
+
+	switch itemType {
+	case '1', '7':
+		return "application/gopher-menu"
+	case '0':
+		if strings.HasPrefix(byExt, "text/") {
+			// Like text/markdown or text/gemini
+			return byExt
+		}
+		return "text/plain"
+	case 'h':
+		return "text/html"
+	case 'g':
+		return "image/gif"
+	case 'p':
+		return "image/png"
+	case 'I', ':':
+		if strings.HasPrefix(byExt, "image/") {
+			return byExt
+		}
+	case 'd':
+		return "application/pdf"
+	}
+	if byExt != "" {
+		return byExt
+	}
+	return "application/octet-stream"
+}
+
+// parseGopherURL returns the parts of a gopher URL, as described in RFC 4266.
+// The search string is from the URL query, or after a tab in the selector.
+func parseGopherURL(parsed *url.URL) (itemType byte, selector, search string) {
+	p := parsed.Path
+	if p == "" || p == "/" {
+		return '1', "", ""
+	}
+	p = strings.TrimPrefix(p, "/")
+	itemType = p[0]
+	selector = p[1:]
+
+	if i := strings.IndexByte(selector, '\t'); i >= 0 {
+		selector, search = selector[:i], selector[i+1:]
+		// Gopher+ strings after another tab aren't supported
+		if j := strings.IndexByte(search, '\t'); j >= 0 {
+			search = search[:j]
+		}
+	}
+	if parsed.RawQuery != "" {
+		query, err := url.PathUnescape(parsed.RawQuery)
+		if err != nil {
+			query = parsed.RawQuery
+		}
+		if itemType == '7' && search == "" {
+			search = query
+		} else {
+			// Part of the selector
+			selector += "?" + query
+		}
+	}
+	return itemType, selector, search
+}
+
+// FetchGopher fetches a gopher URL, and returns it as a Gemini response.
+//
+// Search items without a search string return a status 10 response, so
+// the user is asked for input. Links to other URLs using "URL:" selectors
+// return a redirect. Menus have the application/gopher-menu mediatype.
+func FetchGopher(u string) (*gemini.Response, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	itemType, selector, search := parseGopherURL(parsed)
+
+	switch itemType {
+	case '7':
+		if search == "" {
+			return newNativeResponse(10, "Search", nil, nil), nil
+		}
+	case 'h':
+		if strings.HasPrefix(selector, "URL:") {
+			return newNativeResponse(gemini.StatusRedirect, selector[4:], nil, nil), nil
+		}
+	case '8', 'T', '2':
+		// Telnet and CSO
+		return nil, ErrGopherType
+	}
+
+	port := parsed.Port()
+	if port == "" {
+		port = "70"
+	}
+	conn, err := nativeDial(net.JoinHostPort(parsed.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	setNativeDeadline(conn)
+
+	request := selector
+	if search != "" {
+		request += "\t" + search
+	}
+	if _, err := conn.Write([]byte(request + "\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newNativeResponse(20, gopherMeta(itemType, selector), conn, bufio.NewReader(conn)), nil
+}
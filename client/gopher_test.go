@@ -0,0 +1,109 @@
+package client
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gopherServer starts a gopher server that replies to each request with
+// the reply function's result. It returns the host and port.
+func gopherServer(t *testing.T, reply func(request string) string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			conn.Write([]byte(reply(line))) //nolint:errcheck
+			conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestParseGopherURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		itemType byte
+		selector string
+		search   string
+	}{
+		{"gopher://example.com", '1', "", ""},
+		{"gopher://example.com/", '1', "", ""},
+		{"gopher://example.com/0/file.txt", '0', "/file.txt", ""},
+		{"gopher://example.com/7/search?two%20words", '7', "/search", "two words"},
+		{"gopher://example.com/7/search%09query", '7', "/search", "query"},
+		{"gopher://example.com/1/cgi?a=b", '1', "/cgi?a=b", ""},
+	}
+	for _, tt := range tests {
+		parsed, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		itemType, selector, search := parseGopherURL(parsed)
+		assert.Equal(t, string(tt.itemType), string(itemType), tt.url)
+		assert.Equal(t, tt.selector, selector, tt.url)
+		assert.Equal(t, tt.search, search, tt.url)
+	}
+}
+
+func TestFetchGopher(t *testing.T) {
+	host := gopherServer(t, func(request string) string {
+		return "request: " + request
+	})
+
+	res, err := Fetch("gopher://" + host + "/0/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, 20, res.Status)
+	assert.Equal(t, "text/plain", res.Meta)
+	assert.Equal(t, "request: /file.txt\r\n", string(body))
+
+	res, err = Fetch("gopher://" + host + "/7/search?some%20words")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, "application/gopher-menu", res.Meta)
+	assert.Equal(t, "request: /search\tsome words\r\n", string(body))
+
+	res, err = Fetch("gopher://" + host + "/9/file.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	assert.Equal(t, "application/pdf", res.Meta)
+}
+
+func TestFetchGopherNoConnection(t *testing.T) {
+	// These don't make a request, so no server is needed
+	res, err := FetchGopher("gopher://example.invalid/7/search")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, res.Status)
+	assert.NoError(t, SetReadTimeout(res, 0))
+
+	res, err = FetchGopher("gopher://example.invalid/hURL:https://example.com/")
+	assert.NoError(t, err)
+	assert.Equal(t, 30, res.Status)
+	assert.Equal(t, "https://example.com/", res.Meta)
+
+	_, err = FetchGopher("gopher://example.invalid/8")
+	assert.ErrorIs(t, err, ErrGopherType)
+}
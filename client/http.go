@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/makeworld-the-better-one/go-gemini"
+	"github.com/spf13/viper"
+)
+
+var httpTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nativeDial(addr)
+	},
+	ForceAttemptHTTP2:   true,
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
+var httpClient = &http.Client{
+	// Redirects are handled like Gemini ones, so the user sees them
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+	Transport: httpTransport,
+}
+
+// httpInit sets the timeout for HTTP responses from the config. Only getting
+// the headers is limited, because the body may be downloaded.
+func httpInit() {
+	httpTransport.ResponseHeaderTimeout = time.Duration(viper.GetInt("a-general.page_max_time")) * time.Second
+}
+
+// httpStatus returns the Gemini status that is handled the same way as
+// the HTTP status, and the meta for it.
+func httpStatus(res *http.Response, u *url.URL) (int, string) {
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		meta := res.Header.Get("Content-Type")
+		if meta == "" {
+			meta = "application/octet-stream"
+		}
+		return gemini.StatusSuccess, meta
+	case res.StatusCode >= 300 && res.StatusCode < 400:
+		loc, err := url.Parse(res.Header.Get("Location"))
+		if err != nil || res.Header.Get("Location") == "" {
+			return gemini.StatusTemporaryFailure, "invalid redirect"
+		}
+		redir := u.ResolveReference(loc).String()
+		if res.StatusCode == http.StatusMovedPermanently || res.StatusCode == http.StatusPermanentRedirect {
+			return gemini.StatusRedirectPermanent, redir
+		}
+		return gemini.StatusRedirect, redir
+	}
+
+	text := res.Status // Like "404 Not Found"
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		return gemini.StatusNotFound, text
+	case http.StatusGone:
+		return gemini.StatusGone, text
+	case http.StatusTooManyRequests:
+		wait := res.Header.Get("Retry-After")
+		if _, err := strconv.Atoi(wait); err != nil {
+			wait = "60"
+		}
+		return gemini.StatusSlowDown, wait
+	case http.StatusServiceUnavailable:
+		return gemini.StatusUnavailable, text
+	}
+	if res.StatusCode >= 500 {
+		return gemini.StatusTemporaryFailure, text
+	}
+	return gemini.StatusPermanentFailure, text
+}
+
+// FetchHTTP fetches an HTTP or HTTPS URL, and returns it as a Gemini response.
+// Redirects aren't followed, they're returned as Gemini redirects.
+func FetchHTTP(u string) (*gemini.Response, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil) //nolint:noctx
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Amfora")
+	req.Header.Set("Accept", "text/html, text/plain;q=0.9, */*;q=0.5")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	status, meta := httpStatus(res, parsed)
+	if status != gemini.StatusSuccess {
+		res.Body.Close()
+		return &gemini.Response{Status: status, Meta: meta, Body: http.NoBody}, nil
+	}
+	return &gemini.Response{Status: status, Meta: meta, Body: res.Body}, nil
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchHTTP(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<p>Hi</p>")) //nolint:errcheck
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/temp", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	res, err := Fetch(server.URL + "/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, 20, res.Status)
+	assert.Equal(t, "text/html; charset=utf-8", res.Meta)
+	assert.Equal(t, "<p>Hi</p>", string(body))
+
+	tests := []struct {
+		path   string
+		status int
+		meta   string
+	}{
+		{"/moved", 31, server.URL + "/page"},
+		{"/temp", 30, server.URL + "/page"},
+		{"/missing", 51, "404 Not Found"},
+		{"/slow", 44, "5"},
+		{"/broken", 40, "500 Internal Server Error"},
+	}
+	for _, tt := range tests {
+		res, err := Fetch(server.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		assert.Equal(t, tt.status, res.Status, tt.path)
+		assert.Equal(t, tt.meta, res.Meta, tt.path)
+	}
+}
@@ -0,0 +1,530 @@
+package client
+
+// Client certificate identities created from inside Amfora.
+// Each identity is a self-signed cert and key, stored as PEM files in
+// config.IdentityCertDir. Identities are bound to URL scopes, which are
+// matched the same way as the [auth] section of the config.
+// The scopes are stored in config.IdentityPath.
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/makeworld-the-better-one/amfora/config"
+	"github.com/mitchellh/go-homedir"
+)
+
+var (
+	ErrIdentityExists      = errors.New("an identity with that name already exists")
+	ErrIdentityNotFound    = errors.New("no identity with that name exists")
+	ErrInvalidIdentityName = errors.New("identity names can only contain letters, numbers, spaces, dots, dashes and underscores") //nolint:lll
+	ErrInvalidScope        = errors.New("identity scope is not a valid Gemini URL")
+)
+
+// How long generated certificates are valid for.
+// Capsules identify users by their cert, so it should last a long time.
+const identityValidity = 10 * 365 * 24 * time.Hour
+
+var identityNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9 _.-]*$`)
+
+/*
+Example stored JSON.
+
+{
+	"identities": {
+		"name1": {
+			"scopes": ["gemini://example.com/", "gemini://example.org/app/"],
+			"created": <time>
+		}
+	}
+}
+
+The cert and key for each identity are stored at <name>.crt and <name>.key.
+*/
+
+type identityJSON struct {
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+}
+
+type identitiesJSON struct {
+	Identities map[string]*identityJSON `json:"identities"`
+}
+
+var identities = identitiesJSON{Identities: make(map[string]*identityJSON)}
+
+// identitiesMu protects identities, and writing it to disk.
+var identitiesMu = sync.RWMutex{}
+
+// identityPaths returns the cert and key paths for the identity name.
+func identityPaths(name string) (string, string) {
+	return filepath.Join(config.IdentityCertDir, name+".crt"),
+		filepath.Join(config.IdentityCertDir, name+".key")
+}
+
+// scopeKey normalizes the provided URL into a certMapKey.
+func scopeKey(u string) (certMapKey, error) {
+	pu, _ := normalizeURL(FixUserURL(u))
+	if pu == nil {
+		return certMapKey{}, ErrInvalidScope
+	}
+	return certMapKey{pu.Host, pu.Path}, nil
+}
+
+// loadIdentities reads the identities file and populates identityScopes.
+// A missing file is not an error.
+func loadIdentities() error {
+	jsonBytes, err := ioutil.ReadFile(config.IdentityPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read identities.json error: %w", err)
+	}
+	if len(jsonBytes) == 0 {
+		return nil
+	}
+
+	identitiesMu.Lock()
+	defer identitiesMu.Unlock()
+
+	err = json.Unmarshal(jsonBytes, &identities)
+	if err != nil {
+		return fmt.Errorf("identities.json is corrupted: %w", err)
+	}
+	if identities.Identities == nil {
+		identities.Identities = make(map[string]*identityJSON)
+	}
+
+	identityScopesMu.Lock()
+	defer identityScopesMu.Unlock()
+	for name, id := range identities.Identities {
+		for _, scope := range id.Scopes {
+			key, err := scopeKey(scope)
+			if err != nil {
+				return fmt.Errorf("identities.json: couldn't normalize URL: %s", scope) //nolint:goerr113
+			}
+			identityScopes[key] = name
+		}
+	}
+	return nil
+}
+
+// writeIdentities saves identities to disk.
+// identitiesMu must be held by the caller.
+func writeIdentities() error {
+	jsonBytes, err := json.MarshalIndent(&identities, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(config.IdentityPath, jsonBytes, 0600)
+}
+
+// IdentityNames returns the names of all identities, sorted alphabetically.
+func IdentityNames() []string {
+	identitiesMu.RLock()
+	defer identitiesMu.RUnlock()
+
+	names := make([]string, 0, len(identities.Identities))
+	for name := range identities.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewIdentity generates a new self-signed client certificate and key, and
+// stores them under the provided name. The identity is not bound to any URLs.
+func NewIdentity(name string) error {
+	name = strings.TrimSpace(name)
+	if !identityNameRegex.MatchString(name) {
+		return ErrInvalidIdentityName
+	}
+
+	identitiesMu.Lock()
+	defer identitiesMu.Unlock()
+
+	if _, ok := identities.Identities[name]; ok {
+		return ErrIdentityExists
+	}
+
+	certPEM, keyPEM, err := generateCert(name)
+	if err != nil {
+		return err
+	}
+
+	certPath, keyPath := identityPaths(name)
+	err = ioutil.WriteFile(keyPath, keyPEM, 0600)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(certPath, certPEM, 0600)
+	if err != nil {
+		os.Remove(keyPath)
+		return err
+	}
+
+	identities.Identities[name] = &identityJSON{
+		Scopes:  []string{},
+		Created: time.Now().UTC(),
+	}
+	err = writeIdentities()
+	if err != nil {
+		delete(identities.Identities, name)
+		os.Remove(keyPath)
+		os.Remove(certPath)
+		return err
+	}
+	return nil
+}
+
+// generateCert creates a self-signed client cert with the provided common name.
+// It returns the cert and key in PEM format.
+func generateCert(commonName string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-time.Hour), // Allow for clock skew
+		NotAfter:              now.Add(identityValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+	return certPEM, keyPEM, nil
+}
+
+// BindIdentity makes the identity be used for the provided URL and everything
+// below it. Any other identity bound to the exact same scope is unbound.
+func BindIdentity(name, u string) error {
+	key, err := scopeKey(u)
+	if err != nil {
+		return err
+	}
+	scope := "gemini://" + key.host + key.path
+
+	identitiesMu.Lock()
+	defer identitiesMu.Unlock()
+
+	id, ok := identities.Identities[name]
+	if !ok {
+		return ErrIdentityNotFound
+	}
+
+	identityScopesMu.Lock()
+	if other, ok := identityScopes[key]; ok && other != name {
+		identities.Identities[other].Scopes = removeScope(identities.Identities[other].Scopes, scope)
+	}
+	identityScopes[key] = name
+	identityScopesMu.Unlock()
+
+	if !hasScope(id.Scopes, scope) {
+		id.Scopes = append(id.Scopes, scope)
+	}
+
+	resetCertCache()
+	return writeIdentities()
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for i := range scopes {
+		if scopes[i] == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func removeScope(scopes []string, scope string) []string {
+	ret := make([]string, 0, len(scopes))
+	for i := range scopes {
+		if scopes[i] != scope {
+			ret = append(ret, scopes[i])
+		}
+	}
+	return ret
+}
+
+// IdentityInfo describes an identity for display purposes.
+type IdentityInfo struct {
+	Name        string   // Identity name, or cert path for identities from the config
+	FromConfig  bool     // Whether the identity is from the [auth] section of the config
+	Scopes      []string // URLs the identity is used for, sorted
+	CertPath    string
+	KeyPath     string
+	Subject     string
+	Issuer      string
+	Fingerprint string // SHA-256 of the entire cert
+	NotAfter    time.Time
+	Created     time.Time // Zero for identities from the config
+	Err         error     // Set if the cert couldn't be read, other cert fields will be empty
+}
+
+// readCertInfo fills the cert fields of info using the file at info.CertPath.
+func readCertInfo(info *IdentityInfo) {
+	certPath, err := homedir.Expand(info.CertPath)
+	if err != nil {
+		certPath = info.CertPath
+	}
+	certPEM, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		info.Err = err
+		return
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		info.Err = errors.New("cert file is not in PEM format") //nolint:goerr113
+		return
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		info.Err = err
+		return
+	}
+	info.Subject = cert.Subject.String()
+	info.Issuer = cert.Issuer.String()
+	info.Fingerprint = fmt.Sprintf("%X", sha256.Sum256(cert.Raw))
+	info.NotAfter = cert.NotAfter
+}
+
+// Identities returns information about all identities, both the ones created
+// in Amfora and the ones in the config. Identities from the config are grouped
+// by cert path. Created identities come first, sorted by name.
+func Identities() []*IdentityInfo {
+	infos := make([]*IdentityInfo, 0)
+
+	identitiesMu.RLock()
+	for name, id := range identities.Identities {
+		certPath, keyPath := identityPaths(name)
+		scopes := make([]string, len(id.Scopes))
+		copy(scopes, id.Scopes)
+		sort.Strings(scopes)
+		infos = append(infos, &IdentityInfo{
+			Name:     name,
+			Scopes:   scopes,
+			CertPath: certPath,
+			KeyPath:  keyPath,
+			Created:  id.Created,
+		})
+	}
+	identitiesMu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	confInfos := make(map[string]*IdentityInfo)
+	for k, certPath := range confCerts {
+		info, ok := confInfos[certPath]
+		if !ok {
+			info = &IdentityInfo{
+				Name:       certPath,
+				FromConfig: true,
+				CertPath:   certPath,
+				KeyPath:    confKeys[k],
+			}
+			confInfos[certPath] = info
+		}
+		info.Scopes = append(info.Scopes, "gemini://"+k.host+k.path)
+	}
+	confNames := make([]string, 0, len(confInfos))
+	for name := range confInfos {
+		confNames = append(confNames, name)
+	}
+	sort.Strings(confNames)
+	for _, name := range confNames {
+		sort.Strings(confInfos[name].Scopes)
+		infos = append(infos, confInfos[name])
+	}
+
+	for _, info := range infos {
+		readCertInfo(info)
+	}
+	return infos
+}
+
+// IdentityForURL returns the name of the identity that would be used for
+// the URL, and whether it is from the config. For identities from the config
+// the name is the cert path. The name is empty if no identity would be used.
+func IdentityForURL(u string) (string, bool) {
+	key, err := scopeKey(u)
+	if err != nil {
+		return "", false
+	}
+	v, n := matchCertMapKey(confCerts, key.host, key.path)
+	if name := identityMatch(key.host, key.path, n); name != "" {
+		return name, false
+	}
+	return v, v != ""
+}
+
+// UnbindIdentity stops the identity from being used for the exact scope
+// provided. Scopes of identities from the config can't be changed.
+func UnbindIdentity(name, u string) error {
+	key, err := scopeKey(u)
+	if err != nil {
+		return err
+	}
+	scope := "gemini://" + key.host + key.path
+
+	identitiesMu.Lock()
+	defer identitiesMu.Unlock()
+
+	id, ok := identities.Identities[name]
+	if !ok {
+		return ErrIdentityNotFound
+	}
+	id.Scopes = removeScope(id.Scopes, scope)
+
+	identityScopesMu.Lock()
+	if identityScopes[key] == name {
+		delete(identityScopes, key)
+	}
+	identityScopesMu.Unlock()
+
+	resetCertCache()
+	return writeIdentities()
+}
+
+// DeleteIdentity unbinds the identity from all scopes, and deletes its
+// cert and key files. This cannot be undone.
+func DeleteIdentity(name string) error {
+	identitiesMu.Lock()
+	defer identitiesMu.Unlock()
+
+	if _, ok := identities.Identities[name]; !ok {
+		return ErrIdentityNotFound
+	}
+	delete(identities.Identities, name)
+
+	identityScopesMu.Lock()
+	for k, v := range identityScopes {
+		if v == name {
+			delete(identityScopes, k)
+		}
+	}
+	identityScopesMu.Unlock()
+	resetCertCache()
+
+	err := writeIdentities()
+	if err != nil {
+		return err
+	}
+	certPath, keyPath := identityPaths(name)
+	if err := os.Remove(keyPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(certPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// RenameIdentity changes the name of an identity, keeping its cert, key,
+// and the URLs it's used for. The common name in the cert isn't changed,
+// because sites may know the user by the cert.
+func RenameIdentity(name, newName string) error {
+	newName = strings.TrimSpace(newName)
+	if !identityNameRegex.MatchString(newName) {
+		return ErrInvalidIdentityName
+	}
+
+	identitiesMu.Lock()
+	defer identitiesMu.Unlock()
+
+	id, ok := identities.Identities[name]
+	if !ok {
+		return ErrIdentityNotFound
+	}
+	if newName == name {
+		return nil
+	}
+	if _, ok := identities.Identities[newName]; ok {
+		return ErrIdentityExists
+	}
+
+	certPath, keyPath := identityPaths(name)
+	newCertPath, newKeyPath := identityPaths(newName)
+	if err := os.Rename(keyPath, newKeyPath); err != nil {
+		return err
+	}
+	if err := os.Rename(certPath, newCertPath); err != nil {
+		os.Rename(newKeyPath, keyPath) //nolint:errcheck
+		return err
+	}
+
+	delete(identities.Identities, name)
+	identities.Identities[newName] = id
+	if err := writeIdentities(); err != nil {
+		delete(identities.Identities, newName)
+		identities.Identities[name] = id
+		os.Rename(newKeyPath, keyPath)   //nolint:errcheck
+		os.Rename(newCertPath, certPath) //nolint:errcheck
+		return err
+	}
+
+	identityScopesMu.Lock()
+	for k, v := range identityScopes {
+		if v == name {
+			identityScopes[k] = newName
+		}
+	}
+	identityScopesMu.Unlock()
+	resetCertCache()
+	return nil
+}
+
+// IdentityPEM returns the cert followed by the key of the identity, in PEM format.
+func IdentityPEM(name string) ([]byte, error) {
+	identitiesMu.RLock()
+	_, ok := identities.Identities[name]
+	identitiesMu.RUnlock()
+	if !ok {
+		return nil, ErrIdentityNotFound
+	}
+
+	certPath, keyPath := identityPaths(name)
+	certPEM, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	return append(certPEM, keyPEM...), nil
+}
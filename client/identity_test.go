@@ -0,0 +1,75 @@
+package client
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/makeworld-the-better-one/amfora/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateCert(t *testing.T) {
+	certPEM, keyPEM, err := generateCert("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal("generated cert and key don't make a valid pair:", err)
+	}
+	assert.Equal(t, 1, len(pair.Certificate))
+}
+
+func TestMatchCertMapKey(t *testing.T) {
+	m := map[certMapKey]string{
+		{"example.com", "/"}:        "root",
+		{"example.com", "/app/"}:    "app",
+		{"example.org", "/app/"}:    "other",
+		{"example.com", "/app/sub"}: "sub",
+	}
+
+	v, _ := matchCertMapKey(m, "example.com", "/page.gmi")
+	assert.Equal(t, "root", v)
+	v, _ = matchCertMapKey(m, "example.com", "/app/page.gmi")
+	assert.Equal(t, "app", v, "most specific path should be used")
+	v, _ = matchCertMapKey(m, "example.com", "/app/sub/page.gmi")
+	assert.Equal(t, "sub", v, "most specific path should be used")
+	v, n := matchCertMapKey(m, "example.net", "/")
+	assert.Equal(t, "", v)
+	assert.Equal(t, -1, n)
+}
+
+func TestRenameIdentity(t *testing.T) {
+	dir := t.TempDir()
+	oldCertDir, oldPath := config.IdentityCertDir, config.IdentityPath
+	config.IdentityCertDir, config.IdentityPath = dir, filepath.Join(dir, "identities.json")
+	defer func() { config.IdentityCertDir, config.IdentityPath = oldCertDir, oldPath }()
+
+	if err := NewIdentity("old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := BindIdentity("old", "gemini://example.com/app/"); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, NewIdentity("taken"))
+	defer func() {
+		DeleteIdentity("new")   //nolint:errcheck
+		DeleteIdentity("taken") //nolint:errcheck
+	}()
+
+	assert.ErrorIs(t, RenameIdentity("old", "taken"), ErrIdentityExists)
+	assert.ErrorIs(t, RenameIdentity("old", "bad/name"), ErrInvalidIdentityName)
+	assert.ErrorIs(t, RenameIdentity("missing", "other"), ErrIdentityNotFound)
+
+	assert.NoError(t, RenameIdentity("old", " new "))
+	assert.Equal(t, []string{"new", "taken"}, IdentityNames())
+	name, _ := IdentityForURL("gemini://example.com/app/page.gmi")
+	assert.Equal(t, "new", name, "the identity is still used for the same URLs")
+	certPath, keyPath := identityPaths("new")
+	assert.FileExists(t, certPath)
+	assert.FileExists(t, keyPath)
+	_, err := os.Stat(filepath.Join(dir, "old.key"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,262 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Importing and exporting the TOFU database, in a plain text format like
+// SSH's known_hosts. Each line is:
+//
+//	host port algorithm fingerprint expiry
+//
+// The expiry is in RFC 3339 format, and lines starting with # are ignored.
+// The files made by Lagrange and Bombadillo can be imported too.
+
+// Ways a fingerprint can be made.
+const (
+	AlgoSHA256SPKI = "sha256-spki" // SHA-256 hash of the cert's public key, what Amfora uses
+	AlgoSHA256Cert = "sha256-cert" // SHA-256 hash of the whole cert, used by Amfora v1.0.0
+	AlgoSHA1Cert   = "sha1-cert"   // SHA-1 hash of the whole cert, used by Bombadillo
+)
+
+// TofuImportResult describes what happened to the hosts in an imported file.
+type TofuImportResult struct {
+	Added     int
+	Updated   int // Same fingerprint, later expiry
+	Unchanged int
+	// Human-readable descriptions of hosts that weren't imported,
+	// because of conflicts or bad lines.
+	Conflicts []string
+	Skipped   []string
+}
+
+// ExportTofu writes all the hosts in the TOFU database to w.
+func ExportTofu(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# Amfora TOFU database")
+	fmt.Fprintln(bw, "# host port algorithm fingerprint expiry")
+	for _, e := range TofuEntries() {
+		port := e.Port
+		if port == "" {
+			port = "1965"
+		}
+		expiry := "-"
+		if !e.Expiry.IsZero() {
+			expiry = e.Expiry.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(bw, "%s %s %s %s %s\n", e.Host, port, e.Algorithm, e.Fingerprint, expiry)
+	}
+	return bw.Flush()
+}
+
+// importedEntry is a single host read from a file.
+type importedEntry struct {
+	host        string
+	port        string
+	algo        string
+	fingerprint string
+	expiry      time.Time
+}
+
+// bombadilloRegex matches lines like host=AB:CD:EF...|1600000000
+var bombadilloRegex = regexp.MustCompile(`^([^=\s]+)=([0-9A-Fa-f:]+)(?:[|@ ](\d+))?$`)
+
+// splitKnownHost splits a host that may have a port, as written by
+// various clients: "host", "host:port", "[host]:port", or "host;port".
+func splitKnownHost(s string) (string, string) {
+	if i := strings.LastIndex(s, ";"); i != -1 {
+		return s[:i], s[i+1:]
+	}
+	if host, port, err := net.SplitHostPort(s); err == nil {
+		return host, port
+	}
+	return strings.Trim(s, "[]"), ""
+}
+
+// cleanFingerprint removes colons and makes the hex uppercase, to match
+// how Amfora stores fingerprints.
+func cleanFingerprint(s string) string {
+	return strings.ToUpper(strings.ReplaceAll(s, ":", ""))
+}
+
+// parseUnix parses a Unix timestamp in seconds.
+func parseUnix(s string) (time.Time, bool) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(n, 0).UTC(), true
+}
+
+// parseKnownHostsLine parses a line in Amfora's format, or the format used by
+// Lagrange (host;port expiry fingerprint) or Bombadillo (host=fingerprint|expiry).
+func parseKnownHostsLine(line string) (*importedEntry, error) {
+	fields := strings.Fields(line)
+	var e importedEntry
+
+	switch {
+	case len(fields) == 5:
+		// Amfora
+		e.host, e.port = fields[0], fields[1]
+		e.algo = strings.ToLower(fields[2])
+		e.fingerprint = cleanFingerprint(fields[3])
+		if fields[4] != "-" {
+			t, err := time.Parse(time.RFC3339, fields[4])
+			if err != nil {
+				return nil, fmt.Errorf("invalid expiry: %s", fields[4]) //nolint:goerr113
+			}
+			e.expiry = t.UTC()
+		}
+	case len(fields) == 3:
+		// Lagrange, the expiry and fingerprint are accepted in either order
+		e.host, e.port = splitKnownHost(fields[0])
+		e.algo = AlgoSHA256SPKI
+		expiry, ok := parseUnix(fields[1])
+		e.fingerprint = cleanFingerprint(fields[2])
+		if !ok {
+			expiry, ok = parseUnix(fields[2])
+			e.fingerprint = cleanFingerprint(fields[1])
+		}
+		if !ok {
+			return nil, fmt.Errorf("no expiry found") //nolint:goerr113
+		}
+		e.expiry = expiry
+	case len(fields) == 1 && bombadilloRegex.MatchString(line):
+		m := bombadilloRegex.FindStringSubmatch(line)
+		e.host, e.port = splitKnownHost(m[1])
+		e.fingerprint = cleanFingerprint(m[2])
+		e.algo = AlgoSHA1Cert
+		if m[3] != "" {
+			e.expiry, _ = parseUnix(m[3])
+		}
+	default:
+		return nil, fmt.Errorf("unknown format") //nolint:goerr113
+	}
+
+	e.host = strings.ToLower(strings.TrimSuffix(e.host, "."))
+	if e.port == "1965" {
+		e.port = ""
+	}
+	if e.host == "" {
+		return nil, fmt.Errorf("no host") //nolint:goerr113
+	}
+	if e.port != "" && !isPort(e.port) {
+		return nil, fmt.Errorf("invalid port: %s", e.port) //nolint:goerr113
+	}
+
+	switch e.algo {
+	case AlgoSHA256SPKI, AlgoSHA256Cert:
+		if len(e.fingerprint) != 64 || !isHex(e.fingerprint) {
+			return nil, fmt.Errorf("invalid %s fingerprint", e.algo) //nolint:goerr113
+		}
+	case AlgoSHA1Cert:
+		if len(e.fingerprint) != 40 || !isHex(e.fingerprint) {
+			return nil, fmt.Errorf("invalid %s fingerprint", e.algo) //nolint:goerr113
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm: %s", e.algo) //nolint:goerr113
+	}
+	return &e, nil
+}
+
+// ImportTofu reads hosts from r and merges them into the TOFU database.
+// Hosts that are already in the database with a different fingerprint are
+// conflicts, and are only replaced if overwrite is true. Expired hosts and
+// hosts with no expiry are skipped.
+func ImportTofu(r io.Reader, overwrite bool) (*TofuImportResult, error) {
+	var res TofuImportResult
+	entries := make([]*importedEntry, 0)
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	section := ""
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			// Bombadillo's config is an INI file, with certs in their own section
+			section = strings.ToLower(line)
+			continue
+		}
+		if section != "" && section != "[certs]" {
+			continue
+		}
+
+		e, err := parseKnownHostsLine(line)
+		if err != nil {
+			res.Skipped = append(res.Skipped, fmt.Sprintf("line %d: %v", lineNum, err))
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	tofuStoreMu.Lock()
+	defer tofuStoreMu.Unlock()
+
+	now := time.Now()
+	for _, e := range entries {
+		name := e.host
+		if e.port != "" {
+			name = net.JoinHostPort(e.host, e.port)
+		}
+		if e.expiry.IsZero() {
+			res.Skipped = append(res.Skipped, name+": no expiry")
+			continue
+		}
+		if now.After(e.expiry) {
+			res.Skipped = append(res.Skipped, name+": expired")
+			continue
+		}
+
+		old := getTofuEntry(e.host, e.port)
+		switch {
+		case old == nil:
+			res.Added++
+		case old.Fingerprint == e.fingerprint:
+			if !e.expiry.After(old.Expiry) {
+				res.Unchanged++
+				continue
+			}
+			res.Updated++
+		case overwrite:
+			res.Conflicts = append(res.Conflicts,
+				fmt.Sprintf("%s: replaced %s with %s", name, old.Fingerprint, e.fingerprint))
+		default:
+			res.Conflicts = append(res.Conflicts,
+				fmt.Sprintf("%s: kept %s, file has %s", name, old.Fingerprint, e.fingerprint))
+			continue
+		}
+
+		algo := e.algo
+		if algo == AlgoSHA256SPKI || algo == AlgoSHA1Cert {
+			// The default for the length of the fingerprint
+			algo = ""
+		}
+		tofuStore.Set(idKey(e.host, e.port), e.fingerprint)
+		tofuStore.Set(algorithmKey(e.host, e.port), algo)
+		tofuStore.Set(expiryKey(e.host, e.port), e.expiry)
+		if old == nil || old.Fingerprint != e.fingerprint {
+			// The cert details aren't known
+			tofuStore.Set(notBeforeKey(e.host, e.port), time.Time{})
+			tofuStore.Set(subjectKey(e.host, e.port), "")
+			tofuStore.Set(issuerKey(e.host, e.port), "")
+			tofuStore.Set(firstSeenKey(e.host, e.port), time.Time{})
+			tofuStore.Set(lastSeenKey(e.host, e.port), time.Time{})
+		}
+	}
+
+	return &res, tofuStore.WriteConfig()
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+var fp256 = strings.Repeat("AB", 32)
+
+func TestParseKnownHostsLine(t *testing.T) {
+	e, err := parseKnownHostsLine("example.com 1965 sha256-spki " + fp256 + " 2030-01-01T00:00:00Z")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "example.com", e.host)
+		assert.Equal(t, "", e.port, "port 1965 should be normalized")
+		assert.Equal(t, AlgoSHA256SPKI, e.algo)
+		assert.Equal(t, 2030, e.expiry.Year())
+	}
+
+	// Lagrange
+	e, err = parseKnownHostsLine("example.org;1966 1893456000 " + strings.ToLower(fp256))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "example.org", e.host)
+		assert.Equal(t, "1966", e.port)
+		assert.Equal(t, fp256, e.fingerprint, "fingerprint should be uppercased")
+	}
+
+	// Bombadillo
+	e, err = parseKnownHostsLine("example.net=" + strings.Repeat("AB:", 19) + "AB|1893456000")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "example.net", e.host)
+		assert.Equal(t, AlgoSHA1Cert, e.algo)
+		assert.Equal(t, strings.Repeat("AB", 20), e.fingerprint)
+	}
+
+	_, err = parseKnownHostsLine("example.com 1965 md5 AB 2030-01-01T00:00:00Z")
+	assert.Error(t, err)
+	_, err = parseKnownHostsLine("just some text")
+	assert.Error(t, err)
+}
+
+func TestImportExportTofu(t *testing.T) {
+	oldStore := tofuStore
+	tofuStore = viper.New()
+	tofuStore.SetConfigFile(filepath.Join(t.TempDir(), "tofu.toml"))
+	tofuStore.SetConfigType("toml")
+	defer func() { tofuStore = oldStore }()
+
+	other := strings.Repeat("CD", 32)
+	file := "# comment\n" +
+		"a.example 1965 sha256-spki " + fp256 + " 2030-01-01T00:00:00Z\n" +
+		"b.example 1966 sha256-spki " + fp256 + " 2000-01-01T00:00:00Z\n" +
+		"bad line\n"
+	res, err := ImportTofu(strings.NewReader(file), false)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, res.Added)
+	assert.Equal(t, 2, len(res.Skipped), "expired host and bad line should be skipped")
+
+	res, err = ImportTofu(strings.NewReader("a.example 1965 sha256-spki "+other+" 2030-01-01T00:00:00Z\n"), false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, len(res.Conflicts))
+		assert.Equal(t, fp256, GetTofuEntry("a.example", "").Fingerprint, "conflict shouldn't overwrite")
+	}
+	res, err = ImportTofu(strings.NewReader("a.example 1965 sha256-spki "+other+" 2030-01-01T00:00:00Z\n"), true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, len(res.Conflicts))
+		assert.Equal(t, other, GetTofuEntry("a.example", "").Fingerprint, "conflict should overwrite")
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, ExportTofu(&buf))
+	assert.Contains(t, buf.String(), "a.example 1965 sha256-spki "+other+" 2030-01-01T00:00:00Z\n")
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/makeworld-the-better-one/go-gemini"
+	"github.com/spf13/viper"
+)
+
+// Responses for protocols other than Gemini are made to look like Gemini
+// responses, so that they're handled the same way when displaying pages,
+// asking for input, redirecting, and downloading.
+//
+// go-gemini doesn't allow setting the connection of a response, so the
+// connections of these responses are tracked here instead.
+
+var nativeConns sync.Map // *gemini.Response -> net.Conn
+
+// IsNative returns whether URLs with the scheme can be fetched by Fetch,
+// without a proxy.
+func IsNative(scheme string) bool {
+	switch scheme {
+	case "gemini", "gopher", "spartan", "titan", "finger", "nex":
+		return true
+	}
+	return false
+}
+
+// nativeBody removes its response from nativeConns when it's closed.
+type nativeBody struct {
+	io.ReadCloser
+	res *gemini.Response
+}
+
+func (b *nativeBody) Close() error {
+	nativeConns.Delete(b.res)
+	return b.ReadCloser.Close()
+}
+
+// newNativeResponse returns a Gemini response for a connection using another
+// protocol. The connection is closed when the body is.
+func newNativeResponse(status int, meta string, conn net.Conn, body io.Reader) *gemini.Response {
+	res := &gemini.Response{Status: status, Meta: meta}
+	if conn == nil {
+		// No content, like for input requests
+		res.Body = io.NopCloser(strings.NewReader(""))
+		return res
+	}
+	nativeConns.Store(res, conn)
+	res.Body = &nativeBody{
+		ReadCloser: struct {
+			io.Reader
+			io.Closer
+		}{body, conn},
+		res: res,
+	}
+	return res
+}
+
+// nativeDial connects to the address for other protocols, with the same
+// timeout and SOCKS5 proxy as the Gemini client.
+func nativeDial(address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if fetchClient != nil && fetchClient.Proxy != nil {
+		return fetchClient.Proxy(dialer, address)
+	}
+	return dialer.Dial("tcp", address)
+}
+
+// setNativeDeadline sets the read deadline for a new connection, using the
+// page_max_time config option like the Gemini client does.
+func setNativeDeadline(conn net.Conn) {
+	if d := viper.GetInt("a-general.page_max_time"); d > 0 {
+		conn.SetDeadline(time.Now().Add(time.Duration(d) * time.Second)) //nolint:errcheck
+	}
+}
+
+// SetReadTimeout is the same as res.SetReadTimeout, but it works for
+// responses from all protocols supported by Fetch. It does nothing for
+// responses without a connection.
+func SetReadTimeout(res *gemini.Response, d time.Duration) error {
+	v, ok := nativeConns.Load(res)
+	if !ok {
+		if res.Cert == nil {
+			// Not a Gemini response with a connection
+			return nil
+		}
+		return res.SetReadTimeout(d)
+	}
+	conn := v.(net.Conn)
+	if d <= 0 {
+		return conn.SetDeadline(time.Time{})
+	}
+	return conn.SetDeadline(time.Now().Add(d))
+}
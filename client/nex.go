@@ -0,0 +1,53 @@
+package client
+
+import (
+	"bufio"
+	"mime"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/makeworld-the-better-one/go-gemini"
+)
+
+// FetchNex fetches a nex URL, and returns it as a Gemini response.
+// Directories, whose paths end in a slash, are text/gemini because their
+// links use the same syntax. The mediatype of other files is guessed from
+// the extension.
+func FetchNex(u string) (*gemini.Response, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	p := parsed.Path
+	if p == "" {
+		p = "/"
+	}
+
+	port := parsed.Port()
+	if port == "" {
+		port = "1900"
+	}
+	conn, err := nativeDial(net.JoinHostPort(parsed.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	setNativeDeadline(conn)
+
+	if _, err := conn.Write([]byte(p + "\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	meta := "text/plain"
+	if strings.HasSuffix(p, "/") {
+		meta = "text/gemini"
+	} else if m := mime.TypeByExtension(path.Ext(p)); m != "" {
+		meta = m
+	}
+	if strings.HasSuffix(p, ".gmi") {
+		meta = "text/gemini"
+	}
+	return newNativeResponse(20, meta, conn, bufio.NewReader(conn)), nil
+}
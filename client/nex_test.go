@@ -0,0 +1,35 @@
+package client
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchNex(t *testing.T) {
+	host := gopherServer(t, func(request string) string {
+		return "=> file.txt " + request
+	})
+
+	tests := []struct {
+		url  string
+		meta string
+		body string
+	}{
+		{"nex://" + host, "text/gemini", "=> file.txt /\r\n"},
+		{"nex://" + host + "/dir/", "text/gemini", "=> file.txt /dir/\r\n"},
+		{"nex://" + host + "/notes.gmi", "text/gemini", "=> file.txt /notes.gmi\r\n"},
+		{"nex://" + host + "/notes", "text/plain", "=> file.txt /notes\r\n"},
+	}
+	for _, tt := range tests {
+		res, err := Fetch(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(t, tt.meta, res.Meta, tt.url)
+		assert.Equal(t, tt.body, string(body), tt.url)
+	}
+}
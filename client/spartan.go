@@ -0,0 +1,100 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/makeworld-the-better-one/go-gemini"
+)
+
+var ErrSpartanHeader = errors.New("invalid spartan response header")
+
+// spartanStatuses maps Spartan status codes to the Gemini ones that are
+// handled the same way. Redirects are permanent, because Spartan only has
+// one kind and they're usually used when a page has moved.
+var spartanStatuses = map[byte]int{
+	'2': gemini.StatusSuccess,
+	'3': gemini.StatusRedirectPermanent,
+	'4': gemini.StatusBadRequest,
+	'5': gemini.StatusTemporaryFailure,
+}
+
+// FetchSpartan fetches a spartan URL, and returns it as a Gemini response.
+//
+// The query of the URL is sent as data, like prompt lines in gemtext do.
+// If the URL has an empty query, like "spartan://example.com/echo?", a
+// status 10 response is returned so the user is asked for the data.
+// Redirect paths are made into full URLs.
+func FetchSpartan(u string) (*gemini.Response, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.ForceQuery && parsed.RawQuery == "" {
+		return newNativeResponse(10, "Input", nil, nil), nil
+	}
+	data, err := url.PathUnescape(parsed.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	port := parsed.Port()
+	if port == "" {
+		port = "300"
+	}
+	conn, err := nativeDial(net.JoinHostPort(parsed.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	setNativeDeadline(conn)
+
+	path := parsed.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	request := parsed.Hostname() + " " + path + " " + strconv.Itoa(len(data)) + "\r\n" + data
+	if _, err := conn.Write([]byte(request)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	header, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	header = strings.TrimRight(header, "\r\n")
+	if header == "" {
+		conn.Close()
+		return nil, ErrSpartanHeader
+	}
+	status, ok := spartanStatuses[header[0]]
+	if !ok || (len(header) > 1 && header[1] != ' ') {
+		conn.Close()
+		return nil, ErrSpartanHeader
+	}
+	meta := strings.TrimPrefix(header[1:], " ")
+
+	switch status {
+	case gemini.StatusSuccess:
+		if meta == "" {
+			meta = "text/gemini"
+		}
+		return newNativeResponse(status, meta, conn, r), nil
+	case gemini.StatusRedirectPermanent:
+		// The meta is a path on the same server
+		redir, err := url.Parse(meta)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		meta = parsed.ResolveReference(redir).String()
+	}
+	conn.Close()
+	return newNativeResponse(status, meta, nil, nil), nil
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// spartanServer starts a Spartan server for testing, and returns its host
+// and port. /echo replies with the data sent, /old redirects to /new, and
+// /broken is a server error. Other paths aren't found.
+func spartanServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	handle := func(conn net.Conn) {
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			conn.Write([]byte("4 bad request\r\n")) //nolint:errcheck
+			return
+		}
+		host, path := fields[0], fields[1]
+		n, _ := strconv.Atoi(fields[2])
+		data := make([]byte, n)
+		io.ReadFull(r, data) //nolint:errcheck
+
+		switch path {
+		case "/echo":
+			conn.Write([]byte("2 text/plain\r\n" + host + " " + string(data))) //nolint:errcheck
+		case "/old":
+			conn.Write([]byte("3 /new\r\n")) //nolint:errcheck
+		case "/broken":
+			conn.Write([]byte("5 it broke\r\n")) //nolint:errcheck
+		default:
+			conn.Write([]byte("4 not found\r\n")) //nolint:errcheck
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestFetchSpartan(t *testing.T) {
+	host := spartanServer(t)
+
+	res, err := Fetch("spartan://" + host + "/echo?hello%20there")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, 20, res.Status)
+	assert.Equal(t, "text/plain", res.Meta)
+	assert.Equal(t, "127.0.0.1 hello there", string(body))
+
+	res, err = Fetch("spartan://" + host + "/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 31, res.Status)
+	assert.Equal(t, "spartan://"+host+"/new", res.Meta)
+
+	res, err = Fetch("spartan://" + host + "/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 59, res.Status)
+	assert.Equal(t, "not found", res.Meta)
+
+	res, err = Fetch("spartan://" + host + "/broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 40, res.Status)
+	assert.Equal(t, "it broke", res.Meta)
+}
+
+func TestFetchSpartanPrompt(t *testing.T) {
+	// No request is made, the user needs to be asked first
+	res, err := FetchSpartan("spartan://example.invalid/echo?")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, res.Status)
+}
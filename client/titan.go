@@ -0,0 +1,144 @@
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/makeworld-the-better-one/go-gemini"
+)
+
+var ErrNoTitanData = errors.New("nothing to upload to that titan URL, use the Titan upload command")
+var ErrTitanHeader = errors.New("invalid response header")
+var ErrTitanUntrusted = errors.New("the server's certificate isn't trusted, so nothing was uploaded. " +
+	"Load a Gemini page from the server first to check it")
+
+// Data to upload, set before the titan URL is fetched
+var titanData sync.Map // URL string -> []byte
+
+// TitanURL returns the titan:// URL for uploading data with the mediatype to
+// the Gemini URL. The token is left out if it's empty.
+func TitanURL(u, mediatype string, size int, token string) (string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	parsed.Scheme = "titan"
+	parsed.RawQuery = ""
+	parsed.ForceQuery = false
+	parsed.Fragment = ""
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+	// Parameters aren't allowed in the mediatype, only the type itself
+	if i := strings.IndexByte(mediatype, ';'); i >= 0 {
+		mediatype = mediatype[:i]
+	}
+
+	params := ";mime=" + strings.TrimSpace(mediatype) + ";size=" + strconv.Itoa(size)
+	if token != "" {
+		params += ";token=" + url.PathEscape(token)
+	}
+	return parsed.String() + params, nil
+}
+
+// SetTitanData sets the data that is uploaded the next time the titan URL is
+// fetched with Fetch. The data is only uploaded once.
+func SetTitanData(u string, data []byte) {
+	titanData.Store(u, data)
+}
+
+// titanPath returns the path of a titan URL without the parameters, so it
+// can be used to find client certificates.
+func titanPath(p string) string {
+	if i := strings.IndexByte(p, ';'); i >= 0 {
+		return p[:i]
+	}
+	return p
+}
+
+// FetchTitan uploads the data set with SetTitanData to the titan URL, and
+// returns the response. The client certificate for the same host and path
+// is used, and the server's certificate is checked like for Gemini, except
+// the user can't be asked to trust it.
+func FetchTitan(u string) (*gemini.Response, error) {
+	v, ok := titanData.LoadAndDelete(u)
+	if !ok {
+		return nil, ErrNoTitanData
+	}
+	data := v.([]byte)
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = "1965"
+	}
+
+	conf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true, //nolint:gosec // Certificates are checked by handleCert
+		ServerName:         parsed.Hostname(),
+	}
+	if certPEM, keyPEM := clientCert(parsed.Host, titanPath(parsed.Path)); certPEM != nil {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	rawConn, err := nativeDial(net.JoinHostPort(parsed.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(rawConn, conf)
+	setNativeDeadline(conn)
+	if err := conn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// The certificate is checked before anything is uploaded, unlike for
+	// Gemini where it's fine to send the URL first
+	if err := handleCert(parsed.Hostname(), port, conn.ConnectionState().PeerCertificates[0]); err != nil {
+		conn.Close()
+		if errors.Is(err, ErrTofu) || errors.Is(err, ErrNotPinned) {
+			return nil, ErrTitanUntrusted
+		}
+		return nil, err
+	}
+
+	if _, err := conn.Write(append([]byte(u+"\r\n"), data...)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	header, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	header = strings.TrimRight(header, "\r\n")
+	if len(header) < 2 {
+		conn.Close()
+		return nil, ErrTitanHeader
+	}
+	status, err := strconv.Atoi(header[:2])
+	if err != nil || !gemini.StatusInRange(status) {
+		conn.Close()
+		return nil, ErrTitanHeader
+	}
+
+	res := newNativeResponse(status, strings.TrimSpace(header[2:]), conn, r)
+	res.Cert = conn.ConnectionState().PeerCertificates[0]
+	return res, nil
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTitanURL(t *testing.T) {
+	u, err := TitanURL("gemini://example.com/page.gmi?query", "text/gemini; charset=utf-8", 123, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "titan://example.com/page.gmi;mime=text/gemini;size=123", u)
+
+	u, err = TitanURL("gemini://example.com:1966", "text/plain", 0, "my token")
+	assert.NoError(t, err)
+	assert.Equal(t, "titan://example.com:1966/;mime=text/plain;size=0;token=my%20token", u)
+
+	assert.Equal(t, "/page.gmi", titanPath("/page.gmi;mime=text/gemini;size=123"))
+}
+
+func TestFetchTitanNoData(t *testing.T) {
+	_, err := FetchTitan("titan://example.invalid/page.gmi;mime=text/gemini;size=3")
+	assert.ErrorIs(t, err, ErrNoTitanData)
+
+	SetTitanData("titan://example.invalid/;mime=text/plain;size=3", []byte("abc"))
+	_, err = FetchTitan("titan://example.invalid/;mime=text/plain;size=3")
+	assert.Error(t, err)
+	// The data is only used once
+	_, err = FetchTitan("titan://example.invalid/;mime=text/plain;size=3")
+	assert.ErrorIs(t, err, ErrNoTitanData)
+}
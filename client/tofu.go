@@ -1,13 +1,16 @@
 package client
 
 import (
+	"crypto/sha1" //nolint:gosec
 	"crypto/sha256"
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/makeworld-the-better-one/amfora/config"
 )
@@ -37,19 +40,58 @@ func idKey(domain string, port string) string {
 	return strings.ReplaceAll(domain, ".", "/") + ":" + port
 }
 
-func expiryKey(domain string, port string) string {
+// subKey returns the config/viper key for some other data stored about
+// a host, like its cert expiry.
+func subKey(domain, port, name string) string {
 	if port == "1965" || port == "" {
-		return strings.ReplaceAll(strings.TrimSuffix(domain, "."), ".", "/") + "/expiry"
+		return strings.ReplaceAll(strings.TrimSuffix(domain, "."), ".", "/") + "/" + name
 	}
-	return strings.ReplaceAll(strings.TrimSuffix(domain, "."), ".", "/") + "/expiry" + ":" + port
+	return strings.ReplaceAll(strings.TrimSuffix(domain, "."), ".", "/") + "/" + name + ":" + port
+}
+
+func expiryKey(domain string, port string) string {
+	return subKey(domain, port, "expiry")
+}
+
+// firstSeenKey is for when the current cert was first seen and saved.
+func firstSeenKey(domain string, port string) string {
+	return subKey(domain, port, "first-seen")
 }
 
+// lastSeenKey is for the last time the current cert was seen.
+func lastSeenKey(domain string, port string) string {
+	return subKey(domain, port, "last-seen")
+}
+
+func subjectKey(domain string, port string) string {
+	return subKey(domain, port, "subject")
+}
+
+func issuerKey(domain string, port string) string {
+	return subKey(domain, port, "issuer")
+}
+
+func notBeforeKey(domain string, port string) string {
+	return subKey(domain, port, "not-before")
+}
+
+// algorithmKey is for the way the cert ID was made, if it was imported
+// from elsewhere. See the Algo constants.
+func algorithmKey(domain string, port string) string {
+	return subKey(domain, port, "algorithm")
+}
+
+// mismatches stores the most recent cert for each host that didn't match
+// the TOFU database, so the user can look at it and decide whether to trust it.
+// It is keyed by idKey, and protected by tofuStoreMu.
+var mismatches = make(map[string]*x509.Certificate)
+
 func loadTofuEntry(domain string, port string) (string, time.Time, error) {
 	tofuStoreMu.RLock()
 	defer tofuStoreMu.RUnlock()
 
 	id := tofuStore.GetString(idKey(domain, port)) // Fingerprint
-	if len(id) != sha256.Size*2 {
+	if !validID(id) {
 		// Not set, or invalid
 		return "", time.Time{}, errors.New("not found") //nolint:goerr113
 	}
@@ -76,12 +118,37 @@ func origCertID(cert *x509.Certificate) string {
 	return fmt.Sprintf("%X", h.Sum(nil))
 }
 
+// sha1CertID is the SHA-1 hash of cert.Raw, which other clients like
+// Bombadillo use. It is only found in entries imported from them.
+func sha1CertID(cert *x509.Certificate) string {
+	h := sha1.New() //nolint:gosec // Only used to match existing entries
+	h.Write(cert.Raw)
+	return fmt.Sprintf("%X", h.Sum(nil))
+}
+
+// validID returns whether the string looks like a cert ID made by one of
+// the funcs above.
+func validID(id string) bool {
+	return (len(id) == sha256.Size*2 || len(id) == sha1.Size*2) && isHex(id)
+}
+
 func saveTofuEntry(domain, port string, cert *x509.Certificate) {
 	tofuStoreMu.Lock()
 	defer tofuStoreMu.Unlock()
 
+	now := time.Now().UTC()
+	if tofuStore.GetString(idKey(domain, port)) != certID(cert) {
+		// A different cert, not just a re-pin of the same one
+		tofuStore.Set(firstSeenKey(domain, port), now)
+	}
 	tofuStore.Set(idKey(domain, port), certID(cert))
+	tofuStore.Set(algorithmKey(domain, port), "")
 	tofuStore.Set(expiryKey(domain, port), cert.NotAfter.UTC())
+	tofuStore.Set(notBeforeKey(domain, port), cert.NotBefore.UTC())
+	tofuStore.Set(subjectKey(domain, port), CertText(cert.Subject.String()))
+	tofuStore.Set(issuerKey(domain, port), CertText(cert.Issuer.String()))
+	tofuStore.Set(lastSeenKey(domain, port), now)
+	delete(mismatches, idKey(domain, port))
 	tofuStore.WriteConfig() //nolint:errcheck // Not an issue if it's not saved, only cached data
 }
 
@@ -104,12 +171,13 @@ func handleTofu(domain, port string, cert *x509.Certificate) bool {
 		// Store expiry again in case it changed
 		tofuStoreMu.Lock()
 		tofuStore.Set(expiryKey(domain, port), cert.NotAfter.UTC())
+		tofuStore.Set(lastSeenKey(domain, port), time.Now().UTC())
 		tofuStore.WriteConfig() //nolint:errcheck
 		tofuStoreMu.Unlock()
 		return true
 	}
-	if origCertID(cert) == id {
-		// Valid but uses old ID type
+	if origCertID(cert) == id || sha1CertID(cert) == id {
+		// Valid but uses old or imported ID type
 		saveTofuEntry(domain, port, cert)
 		return true
 	}
@@ -118,6 +186,10 @@ func handleTofu(domain, port string, cert *x509.Certificate) bool {
 		saveTofuEntry(domain, port, cert)
 		return true
 	}
+
+	tofuStoreMu.Lock()
+	mismatches[idKey(domain, port)] = cert
+	tofuStoreMu.Unlock()
 	return false
 }
 
@@ -135,3 +207,200 @@ func GetExpiry(domain, port string) time.Time {
 
 	return tofuStore.GetTime(expiryKey(domain, port))
 }
+
+// TofuEntry is a host's entry in the TOFU database.
+type TofuEntry struct {
+	Host        string
+	Port        string // Empty for port 1965
+	Fingerprint string // SHA-256 hash of the cert's public key, unless Algorithm says otherwise
+	Algorithm   string // How the fingerprint was made, see the Algo constants
+	Expiry      time.Time
+	// These fields are empty if the entry was saved by an older version
+	NotBefore time.Time
+	Subject   string
+	Issuer    string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Repin is true if whatever cert is seen next will be trusted and saved,
+	// because there's no expiry date. This is set by RepinTofuEntry.
+	Repin bool
+	// Mismatch is the most recent cert seen for this host that didn't match,
+	// since Amfora was started. It is nil if there wasn't one.
+	Mismatch *x509.Certificate
+}
+
+// getTofuEntry returns the host's entry, or nil if there isn't one.
+// The caller must hold a lock on tofuStoreMu.
+func getTofuEntry(domain, port string) *TofuEntry {
+	id := tofuStore.GetString(idKey(domain, port))
+	if !validID(id) {
+		return nil
+	}
+	if port == "1965" {
+		port = ""
+	}
+	algo := tofuStore.GetString(algorithmKey(domain, port))
+	if len(id) == sha1.Size*2 {
+		algo = AlgoSHA1Cert
+	} else if algo == "" {
+		algo = AlgoSHA256SPKI
+	}
+	expiry := tofuStore.GetTime(expiryKey(domain, port))
+	return &TofuEntry{
+		Host:        domain,
+		Port:        port,
+		Fingerprint: id,
+		Algorithm:   algo,
+		Expiry:      expiry,
+		NotBefore:   tofuStore.GetTime(notBeforeKey(domain, port)),
+		Subject:     CertText(tofuStore.GetString(subjectKey(domain, port))),
+		Issuer:      CertText(tofuStore.GetString(issuerKey(domain, port))),
+		FirstSeen:   tofuStore.GetTime(firstSeenKey(domain, port)),
+		LastSeen:    tofuStore.GetTime(lastSeenKey(domain, port)),
+		Repin:       expiry.IsZero(),
+		Mismatch:    mismatches[idKey(domain, port)],
+	}
+}
+
+// GetTofuEntry returns the host's entry in the TOFU database, or nil if it's not there.
+// The port string can be empty, to indicate port 1965.
+func GetTofuEntry(domain, port string) *TofuEntry {
+	tofuStoreMu.RLock()
+	defer tofuStoreMu.RUnlock()
+
+	return getTofuEntry(domain, port)
+}
+
+// TofuEntries returns all the hosts stored in the TOFU database, sorted by host.
+func TofuEntries() []*TofuEntry {
+	tofuStoreMu.RLock()
+	defer tofuStoreMu.RUnlock()
+
+	entries := make([]*TofuEntry, 0)
+	for _, key := range tofuStore.AllKeys() {
+		id := tofuStore.GetString(key)
+		if !validID(id) {
+			// Not a fingerprint, or a forgotten entry
+			continue
+		}
+
+		// Split off the port, taking care with IPv6 addresses
+		domain, port := key, ""
+		if i := strings.LastIndex(key, ":"); i != -1 {
+			d, p := key[:i], key[i+1:]
+			if tofuStore.IsSet(expiryKey(d, p)) || (strings.Count(key, ":") == 1 && isPort(p)) {
+				domain, port = d, p
+			}
+		}
+		domain = strings.ReplaceAll(domain, "/", ".")
+
+		if e := getTofuEntry(domain, port); e != nil {
+			entries = append(entries, e)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Host == entries[j].Host {
+			return entries[i].Port < entries[j].Port
+		}
+		return entries[i].Host < entries[j].Host
+	})
+	return entries
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9') && !(r >= 'A' && r <= 'F') && !(r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isPort(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ForgetTofuEntry removes a host from the TOFU database, so the next cert
+// seen will be trusted as if the host was never visited.
+// The port string can be empty, to indicate port 1965.
+func ForgetTofuEntry(domain, port string) error {
+	tofuStoreMu.Lock()
+	defer tofuStoreMu.Unlock()
+
+	// Viper can't delete keys, so they are emptied instead
+	tofuStore.Set(idKey(domain, port), "")
+	tofuStore.Set(algorithmKey(domain, port), "")
+	tofuStore.Set(expiryKey(domain, port), time.Time{})
+	tofuStore.Set(notBeforeKey(domain, port), time.Time{})
+	tofuStore.Set(subjectKey(domain, port), "")
+	tofuStore.Set(issuerKey(domain, port), "")
+	tofuStore.Set(firstSeenKey(domain, port), time.Time{})
+	tofuStore.Set(lastSeenKey(domain, port), time.Time{})
+	delete(mismatches, idKey(domain, port))
+	return tofuStore.WriteConfig()
+}
+
+// RepinTofuEntry keeps a host in the TOFU database, but whatever cert is seen
+// next for it will be trusted and saved, replacing the current one.
+// The port string can be empty, to indicate port 1965.
+func RepinTofuEntry(domain, port string) error {
+	tofuStoreMu.Lock()
+	defer tofuStoreMu.Unlock()
+
+	// A missing expiry means the stored cert can't be checked, see handleTofu
+	tofuStore.Set(expiryKey(domain, port), time.Time{})
+	return tofuStore.WriteConfig()
+}
+
+// TrustMismatch saves the last cert seen for the host that didn't match
+// the TOFU database, replacing the current entry. The cert is only saved
+// if it has the given fingerprint, so a different cert sent in the
+// meantime isn't trusted by mistake. It returns whether it was saved.
+// The port string can be empty, to indicate port 1965.
+func TrustMismatch(domain, port, fingerprint string) bool {
+	tofuStoreMu.RLock()
+	cert := mismatches[idKey(domain, port)]
+	tofuStoreMu.RUnlock()
+
+	if cert == nil || certID(cert) != fingerprint {
+		return false
+	}
+	saveTofuEntry(domain, port, cert)
+	return true
+}
+
+// ForgetMismatch removes the last cert seen for the host that didn't match
+// the TOFU database, so it can't be trusted later from about:tofu.
+// The port string can be empty, to indicate port 1965.
+func ForgetMismatch(domain, port string) {
+	tofuStoreMu.Lock()
+	delete(mismatches, idKey(domain, port))
+	tofuStoreMu.Unlock()
+}
+
+// CertText makes text from a cert, like its subject, safe to show on one
+// line. Servers choose this text, and it can have newlines that would add
+// lines to a page, so control characters and line breaks become spaces.
+func CertText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || unicode.In(r, unicode.Zl, unicode.Zp) {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// CertFingerprint returns the fingerprint of the cert, as it would be stored
+// in the TOFU database.
+func CertFingerprint(cert *x509.Certificate) string {
+	return certID(cert)
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"crypto/x509/pkix"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTofuEntries(t *testing.T) {
+	oldStore := tofuStore
+	tofuStore = viper.New()
+	defer func() { tofuStore = oldStore }()
+
+	id := strings.Repeat("AB", 32)
+	expiry := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tofuStore.Set(idKey("example.com", ""), id)
+	tofuStore.Set(expiryKey("example.com", ""), expiry)
+	tofuStore.Set(idKey("example.org", "1966"), id)
+	tofuStore.Set(expiryKey("example.org", "1966"), expiry)
+	tofuStore.Set(idKey("::1", ""), id)
+	tofuStore.Set(expiryKey("::1", ""), expiry)
+	tofuStore.Set(idKey("forgotten.example", ""), "")
+
+	entries := TofuEntries()
+	if !assert.Equal(t, 3, len(entries)) {
+		return
+	}
+	assert.Equal(t, "::1", entries[0].Host)
+	assert.Equal(t, "", entries[0].Port)
+	assert.Equal(t, "example.com", entries[1].Host)
+	assert.Equal(t, "", entries[1].Port)
+	assert.Equal(t, expiry, entries[1].Expiry)
+	assert.False(t, entries[1].Repin)
+	assert.Equal(t, "example.org", entries[2].Host)
+	assert.Equal(t, "1966", entries[2].Port)
+}
+
+func TestCertText(t *testing.T) {
+	assert.Equal(t, "CN=a.example => about:tofu?action=repin&host=b.example",
+		CertText("CN=a.example\n=> about:tofu?action=repin&host=b.example"))
+	assert.Equal(t, "a  b c\u00e9", CertText("a\r\nb\u2028c\u00e9"))
+	name := pkix.Name{CommonName: "a.example\n# Trust me", Organization: []string{"Org\r\n* Safe"}}
+	assert.NotContains(t, CertText(name.String()), "\n", "names from certs keep newlines")
+
+	oldStore := tofuStore
+	tofuStore = viper.New()
+	defer func() { tofuStore = oldStore }()
+	tofuStore.Set(idKey("example.com", ""), strings.Repeat("AB", 32))
+	tofuStore.Set(subjectKey("example.com", ""), "CN=x\n=> about:tofu")
+	assert.Equal(t, "CN=x => about:tofu", GetTofuEntry("example.com", "").Subject,
+		"entries saved before are cleaned too")
+}
@@ -14,6 +14,7 @@ import (
 	"code.rocketnine.space/tslocum/cview"
 	"github.com/gdamore/tcell/v2"
 	"github.com/makeworld-the-better-one/amfora/cache"
+	"github.com/makeworld-the-better-one/amfora/history"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/muesli/termenv"
 	"github.com/rkoesters/xdg/basedir"
@@ -32,6 +33,9 @@ var TofuStore = viper.New()
 var tofuDBDir string
 var tofuDBPath string
 
+// Persistent page cache, only used if it's enabled
+var PageCacheDir string
+
 // Bookmarks
 var BkmkStore = viper.New() // TOML API for old bookmarks file
 var bkmkDir string
@@ -45,6 +49,26 @@ var TempDownloadsDir string
 var subscriptionDir string
 var SubscriptionPath string
 
+// Client certificate identities created within Amfora
+var identityDir string
+var IdentityPath string    // JSON file that stores the URL scopes of each identity
+var IdentityCertDir string // Where the cert and key files for each identity are stored
+
+// Permanent redirects, saved so they're remembered across sessions
+var redirDir string
+var RedirPath string
+
+// Hashes of finished downloads, for finding duplicates
+var downloadHashesDir string
+var DownloadHashesPath string
+
+// Saved sessions of tabs and their history
+var SessionDir string
+
+// Global history of visited pages
+var historyDir string
+var HistoryPath string
+
 // Command for opening HTTP(S) URLs in the browser, from "a-general.http" in config.
 var HTTPCommand []string
 
@@ -111,6 +135,9 @@ func Init() error {
 	}
 	tofuDBPath = filepath.Join(tofuDBDir, "tofu.toml")
 
+	// Persistent page cache goes in the same cache dir
+	PageCacheDir = filepath.Join(tofuDBDir, "pages")
+
 	// Store bookmarks dir and path
 	if runtime.GOOS == "windows" && os.Getenv("XDG_DATA_HOME") == "" {
 		// Windows just keeps it in APPDATA along with other Amfora files
@@ -132,6 +159,56 @@ func Init() error {
 	}
 	SubscriptionPath = filepath.Join(subscriptionDir, "subscriptions.json")
 
+	// Identities dir and paths
+	if runtime.GOOS == "windows" && os.Getenv("XDG_DATA_HOME") == "" {
+		// In APPDATA beside other Amfora files
+		identityDir = amforaAppData
+	} else {
+		// XDG data dir on POSIX systems
+		identityDir = filepath.Join(basedir.DataHome, "amfora")
+	}
+	IdentityPath = filepath.Join(identityDir, "identities.json")
+	IdentityCertDir = filepath.Join(identityDir, "identities")
+
+	// Permanent redirects dir and path
+	if runtime.GOOS == "windows" && os.Getenv("XDG_DATA_HOME") == "" {
+		// In APPDATA beside other Amfora files
+		redirDir = amforaAppData
+	} else {
+		// XDG data dir on POSIX systems
+		redirDir = filepath.Join(basedir.DataHome, "amfora")
+	}
+	RedirPath = filepath.Join(redirDir, "redirects.json")
+
+	// Download hashes dir and path
+	if runtime.GOOS == "windows" && os.Getenv("XDG_DATA_HOME") == "" {
+		// In APPDATA beside other Amfora files
+		downloadHashesDir = amforaAppData
+	} else {
+		// XDG data dir on POSIX systems
+		downloadHashesDir = filepath.Join(basedir.DataHome, "amfora")
+	}
+	DownloadHashesPath = filepath.Join(downloadHashesDir, "downloads.json")
+
+	// Sessions dir
+	if runtime.GOOS == "windows" && os.Getenv("XDG_DATA_HOME") == "" {
+		// In APPDATA beside other Amfora files
+		SessionDir = filepath.Join(amforaAppData, "sessions")
+	} else {
+		// XDG data dir on POSIX systems
+		SessionDir = filepath.Join(basedir.DataHome, "amfora", "sessions")
+	}
+
+	// History dir and path
+	if runtime.GOOS == "windows" && os.Getenv("XDG_DATA_HOME") == "" {
+		// In APPDATA beside other Amfora files
+		historyDir = amforaAppData
+	} else {
+		// XDG data dir on POSIX systems
+		historyDir = filepath.Join(basedir.DataHome, "amfora")
+	}
+	HistoryPath = filepath.Join(historyDir, "history.json")
+
 	// *** Create necessary files and folders ***
 
 	// Config
@@ -170,6 +247,27 @@ func Init() error {
 	if err != nil {
 		return err
 	}
+	// Identities
+	// The cert dir is private because it holds private keys
+	err = os.MkdirAll(IdentityCertDir, 0700)
+	if err != nil {
+		return err
+	}
+	// Permanent redirects
+	err = os.MkdirAll(redirDir, 0755)
+	if err != nil {
+		return err
+	}
+	// Download hashes
+	err = os.MkdirAll(downloadHashesDir, 0755)
+	if err != nil {
+		return err
+	}
+	// History
+	err = os.MkdirAll(historyDir, 0755)
+	if err != nil {
+		return err
+	}
 
 	// *** Setup vipers ***
 
@@ -190,115 +288,7 @@ func Init() error {
 
 	// Setup main config
 
-	viper.SetDefault("a-general.home", "gemini://geminiprotocol.net")
-	viper.SetDefault("a-general.auto_redirect", false)
-	viper.SetDefault("a-general.http", "default")
-	viper.SetDefault("a-general.search", "gemini://geminispace.info/search")
-	viper.SetDefault("a-general.color", true)
-	viper.SetDefault("a-general.ansi", true)
-	viper.SetDefault("a-general.highlight_code", true)
-	viper.SetDefault("a-general.highlight_style", "monokai")
-	viper.SetDefault("a-general.bullets", true)
-	viper.SetDefault("a-general.show_link", false)
-	viper.SetDefault("a-general.max_width", 80)
-	viper.SetDefault("a-general.downloads", "")
-	viper.SetDefault("a-general.temp_downloads", "")
-	viper.SetDefault("a-general.page_max_size", 2097152)
-	viper.SetDefault("a-general.page_max_time", 10)
-	viper.SetDefault("a-general.scrollbar", "auto")
-	viper.SetDefault("a-general.underline", true)
-	viper.SetDefault("commands.command1", "")
-	viper.SetDefault("commands.command2", "")
-	viper.SetDefault("commands.command3", "")
-	viper.SetDefault("commands.command4", "")
-	viper.SetDefault("commands.command5", "")
-	viper.SetDefault("commands.command6", "")
-	viper.SetDefault("commands.command7", "")
-	viper.SetDefault("commands.command8", "")
-	viper.SetDefault("commands.command9", "")
-	viper.SetDefault("commands.command0", "")
-	viper.SetDefault("keybindings.bind_reload", []string{"R", "Ctrl-R"})
-	viper.SetDefault("keybindings.bind_home", "Backspace")
-	viper.SetDefault("keybindings.bind_bookmarks", "Ctrl-B")
-	viper.SetDefault("keybindings.bind_add_bookmark", "Ctrl-D")
-	viper.SetDefault("keybindings.bind_sub", "Ctrl-A")
-	viper.SetDefault("keybindings.bind_add_sub", "Ctrl-X")
-	viper.SetDefault("keybindings.bind_save", "Ctrl-S")
-	viper.SetDefault("keybindings.bind_moveup", "k")
-	viper.SetDefault("keybindings.bind_movedown", "j")
-	viper.SetDefault("keybindings.bind_moveleft", "h")
-	viper.SetDefault("keybindings.bind_moveright", "l")
-	viper.SetDefault("keybindings.bind_pgup", []string{"PgUp", "u"})
-	viper.SetDefault("keybindings.bind_pgdn", []string{"PgDn", "d"})
-	viper.SetDefault("keybindings.bind_bottom", "Space")
-	viper.SetDefault("keybindings.bind_edit", "e")
-	viper.SetDefault("keybindings.bind_back", []string{"b", "Alt-Left"})
-	viper.SetDefault("keybindings.bind_forward", []string{"f", "Alt-Right"})
-	viper.SetDefault("keybindings.bind_new_tab", "Ctrl-T")
-	viper.SetDefault("keybindings.bind_close_tab", "Ctrl-W")
-	viper.SetDefault("keybindings.bind_next_tab", "F2")
-	viper.SetDefault("keybindings.bind_prev_tab", "F1")
-	viper.SetDefault("keybindings.bind_quit", []string{"Ctrl-C", "Ctrl-Q", "Q"})
-	viper.SetDefault("keybindings.bind_help", "?")
-	viper.SetDefault("keybindings.bind_link1", "1")
-	viper.SetDefault("keybindings.bind_link2", "2")
-	viper.SetDefault("keybindings.bind_link3", "3")
-	viper.SetDefault("keybindings.bind_link4", "4")
-	viper.SetDefault("keybindings.bind_link5", "5")
-	viper.SetDefault("keybindings.bind_link6", "6")
-	viper.SetDefault("keybindings.bind_link7", "7")
-	viper.SetDefault("keybindings.bind_link8", "8")
-	viper.SetDefault("keybindings.bind_link9", "9")
-	viper.SetDefault("keybindings.bind_link0", "0")
-	viper.SetDefault("keybindings.bind_tab1", "!")
-	viper.SetDefault("keybindings.bind_tab2", "@")
-	viper.SetDefault("keybindings.bind_tab3", "#")
-	viper.SetDefault("keybindings.bind_tab4", "$")
-	viper.SetDefault("keybindings.bind_tab5", "%")
-	viper.SetDefault("keybindings.bind_tab6", "^")
-	viper.SetDefault("keybindings.bind_tab7", "&")
-	viper.SetDefault("keybindings.bind_tab8", "*")
-	viper.SetDefault("keybindings.bind_tab9", "(")
-	viper.SetDefault("keybindings.bind_tab0", ")")
-	viper.SetDefault("keybindings.bind_command1", "Alt-!")
-	viper.SetDefault("keybindings.bind_command2", "Alt-@")
-	viper.SetDefault("keybindings.bind_command3", "Alt-#")
-	viper.SetDefault("keybindings.bind_command4", "Alt-$")
-	viper.SetDefault("keybindings.bind_command5", "Alt-%")
-	viper.SetDefault("keybindings.bind_command6", "Alt-^")
-	viper.SetDefault("keybindings.bind_command7", "Alt-&")
-	viper.SetDefault("keybindings.bind_command8", "Alt-*")
-	viper.SetDefault("keybindings.bind_command9", "Alt-(")
-	viper.SetDefault("keybindings.bind_command0", "Alt-)")
-	viper.SetDefault("keybindings.bind_command_target1", "Alt-1")
-	viper.SetDefault("keybindings.bind_command_target2", "Alt-2")
-	viper.SetDefault("keybindings.bind_command_target3", "Alt-3")
-	viper.SetDefault("keybindings.bind_command_target4", "Alt-4")
-	viper.SetDefault("keybindings.bind_command_target5", "Alt-5")
-	viper.SetDefault("keybindings.bind_command_target6", "Alt-6")
-	viper.SetDefault("keybindings.bind_command_target7", "Alt-7")
-	viper.SetDefault("keybindings.bind_command_target8", "Alt-8")
-	viper.SetDefault("keybindings.bind_command_target9", "Alt-9")
-	viper.SetDefault("keybindings.bind_command_target0", "Alt-0")
-	viper.SetDefault("keybindings.bind_copy_page_url", "C")
-	viper.SetDefault("keybindings.bind_copy_target_url", "c")
-	viper.SetDefault("keybindings.bind_beginning", []string{"Home", "g"})
-	viper.SetDefault("keybindings.bind_end", []string{"End", "G"})
-	viper.SetDefault("keybindings.bind_search", "/")
-	viper.SetDefault("keybindings.bind_next_match", "n")
-	viper.SetDefault("keybindings.bind_prev_match", "N")
-	viper.SetDefault("keybindings.shift_numbers", "")
-	viper.SetDefault("keybindings.bind_url_handler_open", "Ctrl-U")
-	viper.SetDefault("url-handlers.other", "default")
-	viper.SetDefault("url-prompts.other", false)
-	viper.SetDefault("cache.max_size", 0)
-	viper.SetDefault("cache.max_pages", 20)
-	viper.SetDefault("cache.timeout", 1800)
-	viper.SetDefault("subscriptions.popup", true)
-	viper.SetDefault("subscriptions.update_interval", 1800)
-	viper.SetDefault("subscriptions.workers", 3)
-	viper.SetDefault("subscriptions.entries_per_page", 20)
-	viper.SetDefault("subscriptions.header", true)
+	setDefaults()
 
 	viper.SetConfigFile(configPath)
 	viper.SetConfigType("toml")
@@ -380,6 +370,14 @@ func Init() error {
 	cache.SetMaxSize(viper.GetInt("cache.max_size"))
 	cache.SetMaxPages(viper.GetInt("cache.max_pages"))
 	cache.SetTimeout(viper.GetInt("cache.timeout"))
+	cache.SetRedirExpiry(viper.GetInt("cache.redirect_expiry"))
+	if viper.GetBool("cache.persist") {
+		cache.SetDiskDir(PageCacheDir)
+	}
+
+	// Setup history from config
+	history.SetMaxAge(viper.GetInt("history.max_days"))
+	history.SetExcluded(viper.GetStringSlice("history.exclude"))
 
 	setColor := func(k string, colorStr string) error {
 		if k == "include" {
@@ -504,3 +502,133 @@ func Init() error {
 
 	return nil
 }
+
+// setDefaults sets the default values of the main config.
+func setDefaults() {
+	viper.SetDefault("a-general.home", "gemini://geminiprotocol.net")
+	viper.SetDefault("a-general.auto_redirect", false)
+	viper.SetDefault("a-general.http", "default")
+	viper.SetDefault("a-general.builtin_http", false)
+	viper.SetDefault("a-general.search", "gemini://geminispace.info/search")
+	viper.SetDefault("a-general.search_mode", "literal")
+	viper.SetDefault("a-general.color", true)
+	viper.SetDefault("a-general.ansi", true)
+	viper.SetDefault("a-general.highlight_code", true)
+	viper.SetDefault("a-general.highlight_style", "monokai")
+	viper.SetDefault("a-general.bullets", true)
+	viper.SetDefault("a-general.show_link", false)
+	viper.SetDefault("a-general.max_width", 80)
+	viper.SetDefault("a-general.downloads", "")
+	viper.SetDefault("a-general.temp_downloads", "")
+	viper.SetDefault("a-general.max_downloads", 3)
+	viper.SetDefault("a-general.page_max_size", 2097152)
+	viper.SetDefault("a-general.page_max_time", 10)
+	viper.SetDefault("a-general.scrollbar", "auto")
+	viper.SetDefault("a-general.underline", true)
+	viper.SetDefault("a-general.images", "off")
+	viper.SetDefault("a-general.image_max_dimension", 8192)
+	viper.SetDefault("a-general.restore_session", "ask")
+	viper.SetDefault("tls.policy", "tofu")
+	viper.SetDefault("tls.ca_bundle", "")
+	viper.SetDefault("commands.command1", "")
+	viper.SetDefault("commands.command2", "")
+	viper.SetDefault("commands.command3", "")
+	viper.SetDefault("commands.command4", "")
+	viper.SetDefault("commands.command5", "")
+	viper.SetDefault("commands.command6", "")
+	viper.SetDefault("commands.command7", "")
+	viper.SetDefault("commands.command8", "")
+	viper.SetDefault("commands.command9", "")
+	viper.SetDefault("commands.command0", "")
+	viper.SetDefault("keybindings.bind_reload", []string{"R", "Ctrl-R"})
+	viper.SetDefault("keybindings.bind_home", "Backspace")
+	viper.SetDefault("keybindings.bind_bookmarks", "Ctrl-B")
+	viper.SetDefault("keybindings.bind_add_bookmark", "Ctrl-D")
+	viper.SetDefault("keybindings.bind_sub", "Ctrl-A")
+	viper.SetDefault("keybindings.bind_add_sub", "Ctrl-X")
+	viper.SetDefault("keybindings.bind_save", "Ctrl-S")
+	viper.SetDefault("keybindings.bind_moveup", "k")
+	viper.SetDefault("keybindings.bind_movedown", "j")
+	viper.SetDefault("keybindings.bind_moveleft", "h")
+	viper.SetDefault("keybindings.bind_moveright", "l")
+	viper.SetDefault("keybindings.bind_pgup", []string{"PgUp", "u"})
+	viper.SetDefault("keybindings.bind_pgdn", []string{"PgDn", "d"})
+	viper.SetDefault("keybindings.bind_bottom", "Space")
+	viper.SetDefault("keybindings.bind_edit", "e")
+	viper.SetDefault("keybindings.bind_back", []string{"b", "Alt-Left"})
+	viper.SetDefault("keybindings.bind_forward", []string{"f", "Alt-Right"})
+	viper.SetDefault("keybindings.bind_new_tab", "Ctrl-T")
+	viper.SetDefault("keybindings.bind_close_tab", "Ctrl-W")
+	viper.SetDefault("keybindings.bind_reopen_tab", "U")
+	viper.SetDefault("keybindings.bind_next_tab", "F2")
+	viper.SetDefault("keybindings.bind_prev_tab", "F1")
+	viper.SetDefault("keybindings.bind_quit", []string{"Ctrl-C", "Ctrl-Q", "Q"})
+	viper.SetDefault("keybindings.bind_help", "?")
+	viper.SetDefault("keybindings.bind_link1", "1")
+	viper.SetDefault("keybindings.bind_link2", "2")
+	viper.SetDefault("keybindings.bind_link3", "3")
+	viper.SetDefault("keybindings.bind_link4", "4")
+	viper.SetDefault("keybindings.bind_link5", "5")
+	viper.SetDefault("keybindings.bind_link6", "6")
+	viper.SetDefault("keybindings.bind_link7", "7")
+	viper.SetDefault("keybindings.bind_link8", "8")
+	viper.SetDefault("keybindings.bind_link9", "9")
+	viper.SetDefault("keybindings.bind_link0", "0")
+	viper.SetDefault("keybindings.bind_tab1", "!")
+	viper.SetDefault("keybindings.bind_tab2", "@")
+	viper.SetDefault("keybindings.bind_tab3", "#")
+	viper.SetDefault("keybindings.bind_tab4", "$")
+	viper.SetDefault("keybindings.bind_tab5", "%")
+	viper.SetDefault("keybindings.bind_tab6", "^")
+	viper.SetDefault("keybindings.bind_tab7", "&")
+	viper.SetDefault("keybindings.bind_tab8", "*")
+	viper.SetDefault("keybindings.bind_tab9", "(")
+	viper.SetDefault("keybindings.bind_tab0", ")")
+	viper.SetDefault("keybindings.bind_command1", "Alt-!")
+	viper.SetDefault("keybindings.bind_command2", "Alt-@")
+	viper.SetDefault("keybindings.bind_command3", "Alt-#")
+	viper.SetDefault("keybindings.bind_command4", "Alt-$")
+	viper.SetDefault("keybindings.bind_command5", "Alt-%")
+	viper.SetDefault("keybindings.bind_command6", "Alt-^")
+	viper.SetDefault("keybindings.bind_command7", "Alt-&")
+	viper.SetDefault("keybindings.bind_command8", "Alt-*")
+	viper.SetDefault("keybindings.bind_command9", "Alt-(")
+	viper.SetDefault("keybindings.bind_command0", "Alt-)")
+	viper.SetDefault("keybindings.bind_command_target1", "Alt-1")
+	viper.SetDefault("keybindings.bind_command_target2", "Alt-2")
+	viper.SetDefault("keybindings.bind_command_target3", "Alt-3")
+	viper.SetDefault("keybindings.bind_command_target4", "Alt-4")
+	viper.SetDefault("keybindings.bind_command_target5", "Alt-5")
+	viper.SetDefault("keybindings.bind_command_target6", "Alt-6")
+	viper.SetDefault("keybindings.bind_command_target7", "Alt-7")
+	viper.SetDefault("keybindings.bind_command_target8", "Alt-8")
+	viper.SetDefault("keybindings.bind_command_target9", "Alt-9")
+	viper.SetDefault("keybindings.bind_command_target0", "Alt-0")
+	viper.SetDefault("keybindings.bind_copy_page_url", "C")
+	viper.SetDefault("keybindings.bind_copy_target_url", "c")
+	viper.SetDefault("keybindings.bind_beginning", []string{"Home", "g"})
+	viper.SetDefault("keybindings.bind_end", []string{"End", "G"})
+	viper.SetDefault("keybindings.bind_search", "/")
+	viper.SetDefault("keybindings.bind_next_match", "n")
+	viper.SetDefault("keybindings.bind_prev_match", "N")
+	viper.SetDefault("keybindings.shift_numbers", "")
+	viper.SetDefault("keybindings.bind_url_handler_open", "Ctrl-U")
+	viper.SetDefault("keybindings.bind_offline", "Ctrl-O")
+	viper.SetDefault("keybindings.bind_titan", "Ctrl-E")
+	viper.SetDefault("keybindings.bind_private", "Ctrl-P")
+	viper.SetDefault("url-handlers.other", "default")
+	viper.SetDefault("url-prompts.other", false)
+	viper.SetDefault("cache.max_size", 0)
+	viper.SetDefault("cache.max_pages", 20)
+	viper.SetDefault("cache.timeout", 1800)
+	viper.SetDefault("cache.persist", false)
+	viper.SetDefault("cache.redirect_expiry", 2592000)
+	viper.SetDefault("history.enabled", true)
+	viper.SetDefault("history.max_days", 90)
+	viper.SetDefault("history.exclude", []string{})
+	viper.SetDefault("subscriptions.popup", true)
+	viper.SetDefault("subscriptions.update_interval", 1800)
+	viper.SetDefault("subscriptions.workers", 3)
+	viper.SetDefault("subscriptions.entries_per_page", 20)
+	viper.SetDefault("subscriptions.header", true)
+}
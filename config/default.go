@@ -49,9 +49,24 @@ auto_redirect = false
 
 http = 'default'
 
+# Whether to open simple HTTP(S) pages in a tab instead. HTML is converted to
+# gemtext, keeping headings, paragraphs, lists, links, and preformatted text.
+# Anything that isn't HTML or text is still opened with the http command above.
+# A proxy set for HTTP in the [proxies] section is used instead, if there is one.
+builtin_http = false
+
 # Any URL that will accept a query string can be put here
 search = "gemini://geminispace.info/search"
 
+# How text is matched when searching the current page with bind_search.
+# "literal": the exact text, matching case
+# "case-insensitive": the text, ignoring case
+# "regex": a Go regular expression, see https://golang.org/s/re2syntax
+# "whole-word": the text as whole words, ignoring case
+# Press Tab in the search bar to pick another kind of search. Starting a search
+# with l:, i:, r:, or w: uses that kind instead, like "r:^## ".
+search_mode = "literal"
+
 # Whether colors will be used in the terminal
 color = true
 
@@ -79,6 +94,10 @@ max_width = 80
 # Note the use of single quotes, so that backslashes will not be escaped.
 downloads = ''
 
+# The max number of downloads that run at once, the rest wait in a queue.
+# Zero means no limit.
+max_downloads = 3
+
 # Max size for displayable content in bytes - after that size a download window pops up
 page_max_size = 2097152  # 2 MiB
 # Max time it takes to load a page in seconds - after that a download window pops up
@@ -88,14 +107,35 @@ page_max_time = 10
 # "auto" means the scrollbar only appears when the page is longer than the window.
 scrollbar = "auto"
 
+# Show PNG, JPEG, and GIF images inline as a page, instead of asking to download them.
+# "off" is the default. "halfblock" uses Unicode block characters with true color,
+# and works in most terminals. "sixel" and "kitty" use those terminal graphics
+# protocols, which look better but are only supported by some terminals.
+images = "off"
+
+# Images wider or taller than this many pixels aren't shown, because decoding
+# them could use too much memory.
+image_max_dimension = 8192
+
 # Underline non-gemini URLs
 # This is done to help color blind users
 underline = true
 
+# The open tabs and their history are saved as you browse, so they can be restored
+# after quitting or a crash. This sets whether they are restored when Amfora starts.
+# "ask" shows a prompt, "always" restores them, and "never" starts with a new tab.
+# Other saved sessions can be opened from about:sessions.
+restore_session = "ask"
+
 
 [auth]
 # Authentication settings
 # Note the use of single quotes for values, so that backslashes will not be escaped.
+#
+# When a site asks for a client certificate, Amfora will offer to create a new
+# identity or use an existing one. Those identities are stored in Amfora's data
+# folder, not in this file. If a URL matches both an identity and a cert set below,
+# the more specific one is used, and the ones set below win when they are equal.
 
 [auth.certs]
 # Client certificates
@@ -112,6 +152,35 @@ underline = true
 # Same as [auth.certs] but the path is to the client key file.
 
 
+[tls]
+# How server certificates are checked. The options are:
+#
+# "tofu": Trust On First Use. The certificate of a host is saved the first time it
+#         is seen, and you are warned if it changes before it expires.
+# "ca": The certificate must be signed by a trusted CA, and be valid for the host.
+#       Hosts that fail this check can't be visited. TOFU isn't used.
+# "ca-or-tofu": Certificates signed by a trusted CA are checked that way, and TOFU
+#               is used for the rest, like self-signed certificates.
+# "pinned-only": Only hosts already in the TOFU database are trusted. You are asked
+#                before any new host is added.
+#
+# Trusted CAs are the ones trusted by your system, plus the ones in ca_bundle below.
+# Note that Amfora only sees the server's own certificate, so any intermediate CA
+# certificates needed to verify it must be in ca_bundle.
+policy = "tofu"
+
+# Path to a PEM file of extra CA certificates to trust
+# Note the use of single quotes, so that backslashes will not be escaped.
+ca_bundle = ''
+
+[tls.policies]
+# Use a different policy for certain hosts
+# Set the host equal to one of the policies above
+#
+# "example.com" = "ca"
+# "example.com:1966" = "ca-or-tofu"  # Port 1965 is assumed if no port is specified
+
+
 [commands]
 # Define up to 10 custom commands to execute on the corresponding hotkey press.
 # Commands are run in a new process and will not terminate when Amfora is closed.
@@ -224,6 +293,7 @@ underline = true
 # bind_pgdn
 # bind_new_tab
 # bind_close_tab
+# bind_reopen_tab: Reopen the last closed tab where it was, with its history
 # bind_next_tab
 # bind_prev_tab
 # bind_quit
@@ -235,6 +305,10 @@ underline = true
 # bind_beginning: moving to beginning of page (top left)
 # bind_end: same but the for the end (bottom left)
 # bind_url_handler_open: Open highlighted URL with URL handler (#143)
+# bind_offline: Turn offline mode on or off, where pages are only loaded from the disk cache
+# bind_titan: Upload a local file or an edited copy of the current page with Titan
+# bind_private: Turn private mode on or off, where visited pages aren't added to the history,
+# saved in the session, or written to the disk cache
 
 # Search
 # bind_search = "/"
@@ -362,6 +436,17 @@ max_pages = 30 # The maximum number of pages the cache will store
 # How long a page will stay in cache, in seconds.
 timeout = 1800 # 30 mins
 
+# Whether pages are also saved to disk, in Amfora's cache folder. They will be
+# used after Amfora is restarted, and can be read in offline mode, no matter how old
+# they are. max_size and timeout apply to these pages too, but max_pages doesn't.
+# Pages loaded with client certificates are never saved.
+persist = false
+
+# Permanent redirects are remembered across sessions, and followed without asking the
+# server again. This is how long they are remembered for, in seconds.
+# Zero means forever.
+redirect_expiry = 2592000 # 30 days
+
 [proxies]
 # Allows setting a Gemini proxy for different schemes.
 # The settings are similar to the url-handlers section above.
@@ -373,9 +458,31 @@ timeout = 1800 # 30 mins
 # NOTE: These settings override any external handlers specified in
 # the url-handlers section.
 #
+# Gopher, Spartan, finger, and nex URLs are opened by Amfora itself if no proxy
+# is set for them.
+# The url-handlers section is still used when a link is opened with the
+# bind_url_handler_open keybinding.
+#
 # Note that HTTP and HTTPS are treated as separate protocols here.
 
 
+[history]
+# Every page that is visited is recorded in the history, which can be viewed at
+# about:history. It's kept after Amfora is restarted. Pages aren't recorded
+# while private mode is on, see the bind_private keybinding.
+
+# Set to false to stop recording pages. The history that's already recorded
+# can still be viewed.
+enabled = true
+
+# How many days visits are kept for. Set it to 0 to keep them forever.
+max_days = 90
+
+# Hosts whose pages aren't recorded. Their subdomains aren't recorded either.
+# exclude = ["example.com", "bank.example.org"]
+exclude = []
+
+
 [subscriptions]
 # For tracking feeds and pages
 
@@ -87,6 +87,10 @@ const (
 	CmdSearch
 	CmdNextMatch
 	CmdPrevMatch
+	CmdOffline
+	CmdTitan
+	CmdPrivate
+	CmdReopenTab
 )
 
 type keyBinding struct {
@@ -147,6 +151,14 @@ func GetKeyBinding(cmd Command) string {
 
 // Parse a single keybinding string and add it to the binding map
 func parseBinding(cmd Command, binding string) {
+	if kb, ok := toKeyBinding(binding); ok {
+		bindings[kb] = cmd
+	}
+}
+
+// toKeyBinding parses a single keybinding string. It returns false if the
+// string isn't a valid keybinding.
+func toKeyBinding(binding string) (keyBinding, bool) {
 	var k tcell.Key
 	var m tcell.ModMask
 	var r rune
@@ -165,7 +177,7 @@ func parseBinding(cmd Command, binding string) {
 		k = tcell.KeyRune
 		r = []rune(binding)[0]
 	} else if len(binding) == 0 {
-		return
+		return keyBinding{}, false
 	} else if binding == "Space" {
 		k = tcell.KeyRune
 		r = ' '
@@ -173,97 +185,105 @@ func parseBinding(cmd Command, binding string) {
 		var ok bool
 		k, ok = tcellKeys[binding]
 		if !ok { // Bad keybinding!  Quietly ignore...
-			return
+			return keyBinding{}, false
 		}
 		if strings.HasPrefix(binding, "Ctrl") {
 			m += tcell.ModCtrl
 		}
 	}
 
-	bindings[keyBinding{k, m, r}] = cmd
+	return keyBinding{k, m, r}, true
+}
+
+// configBindings are the config keys for the keybindings of each command.
+var configBindings = map[Command]string{
+	CmdLink1:          "keybindings.bind_link1",
+	CmdLink2:          "keybindings.bind_link2",
+	CmdLink3:          "keybindings.bind_link3",
+	CmdLink4:          "keybindings.bind_link4",
+	CmdLink5:          "keybindings.bind_link5",
+	CmdLink6:          "keybindings.bind_link6",
+	CmdLink7:          "keybindings.bind_link7",
+	CmdLink8:          "keybindings.bind_link8",
+	CmdLink9:          "keybindings.bind_link9",
+	CmdLink0:          "keybindings.bind_link0",
+	CmdBottom:         "keybindings.bind_bottom",
+	CmdEdit:           "keybindings.bind_edit",
+	CmdHome:           "keybindings.bind_home",
+	CmdBookmarks:      "keybindings.bind_bookmarks",
+	CmdAddBookmark:    "keybindings.bind_add_bookmark",
+	CmdSave:           "keybindings.bind_save",
+	CmdReload:         "keybindings.bind_reload",
+	CmdBack:           "keybindings.bind_back",
+	CmdForward:        "keybindings.bind_forward",
+	CmdMoveUp:         "keybindings.bind_moveup",
+	CmdMoveDown:       "keybindings.bind_movedown",
+	CmdMoveLeft:       "keybindings.bind_moveleft",
+	CmdMoveRight:      "keybindings.bind_moveright",
+	CmdPgup:           "keybindings.bind_pgup",
+	CmdPgdn:           "keybindings.bind_pgdn",
+	CmdNewTab:         "keybindings.bind_new_tab",
+	CmdCloseTab:       "keybindings.bind_close_tab",
+	CmdNextTab:        "keybindings.bind_next_tab",
+	CmdPrevTab:        "keybindings.bind_prev_tab",
+	CmdQuit:           "keybindings.bind_quit",
+	CmdHelp:           "keybindings.bind_help",
+	CmdSub:            "keybindings.bind_sub",
+	CmdAddSub:         "keybindings.bind_add_sub",
+	CmdCopyPageURL:    "keybindings.bind_copy_page_url",
+	CmdCopyTargetURL:  "keybindings.bind_copy_target_url",
+	CmdBeginning:      "keybindings.bind_beginning",
+	CmdEnd:            "keybindings.bind_end",
+	CmdURLHandlerOpen: "keybindings.bind_url_handler_open",
+	CmdCommand1:       "keybindings.bind_command1",
+	CmdCommand2:       "keybindings.bind_command2",
+	CmdCommand3:       "keybindings.bind_command3",
+	CmdCommand4:       "keybindings.bind_command4",
+	CmdCommand5:       "keybindings.bind_command5",
+	CmdCommand6:       "keybindings.bind_command6",
+	CmdCommand7:       "keybindings.bind_command7",
+	CmdCommand8:       "keybindings.bind_command8",
+	CmdCommand9:       "keybindings.bind_command9",
+	CmdCommand0:       "keybindings.bind_command0",
+	CmdCommandTarget1: "keybindings.bind_command_target1",
+	CmdCommandTarget2: "keybindings.bind_command_target2",
+	CmdCommandTarget3: "keybindings.bind_command_target3",
+	CmdCommandTarget4: "keybindings.bind_command_target4",
+	CmdCommandTarget5: "keybindings.bind_command_target5",
+	CmdCommandTarget6: "keybindings.bind_command_target6",
+	CmdCommandTarget7: "keybindings.bind_command_target7",
+	CmdCommandTarget8: "keybindings.bind_command_target8",
+	CmdCommandTarget9: "keybindings.bind_command_target9",
+	CmdCommandTarget0: "keybindings.bind_command_target0",
+	CmdSearch:         "keybindings.bind_search",
+	CmdNextMatch:      "keybindings.bind_next_match",
+	CmdPrevMatch:      "keybindings.bind_prev_match",
+	CmdOffline:        "keybindings.bind_offline",
+	CmdTitan:          "keybindings.bind_titan",
+	CmdPrivate:        "keybindings.bind_private",
+	CmdReopenTab:      "keybindings.bind_reopen_tab",
+}
+
+// configTabNBindings are the config keys for switching to tabs by number.
+// This is split off to allow shift_numbers to override bind_tab[1-90]
+// (This is needed for older configs so that the default bind_tab values
+// aren't used)
+var configTabNBindings = map[Command]string{
+	CmdTab1: "keybindings.bind_tab1",
+	CmdTab2: "keybindings.bind_tab2",
+	CmdTab3: "keybindings.bind_tab3",
+	CmdTab4: "keybindings.bind_tab4",
+	CmdTab5: "keybindings.bind_tab5",
+	CmdTab6: "keybindings.bind_tab6",
+	CmdTab7: "keybindings.bind_tab7",
+	CmdTab8: "keybindings.bind_tab8",
+	CmdTab9: "keybindings.bind_tab9",
+	CmdTab0: "keybindings.bind_tab0",
 }
 
 // Generate the bindings map from the TOML configuration file.
 // Called by config.Init()
 func KeyInit() {
-	configBindings := map[Command]string{
-		CmdLink1:          "keybindings.bind_link1",
-		CmdLink2:          "keybindings.bind_link2",
-		CmdLink3:          "keybindings.bind_link3",
-		CmdLink4:          "keybindings.bind_link4",
-		CmdLink5:          "keybindings.bind_link5",
-		CmdLink6:          "keybindings.bind_link6",
-		CmdLink7:          "keybindings.bind_link7",
-		CmdLink8:          "keybindings.bind_link8",
-		CmdLink9:          "keybindings.bind_link9",
-		CmdLink0:          "keybindings.bind_link0",
-		CmdBottom:         "keybindings.bind_bottom",
-		CmdEdit:           "keybindings.bind_edit",
-		CmdHome:           "keybindings.bind_home",
-		CmdBookmarks:      "keybindings.bind_bookmarks",
-		CmdAddBookmark:    "keybindings.bind_add_bookmark",
-		CmdSave:           "keybindings.bind_save",
-		CmdReload:         "keybindings.bind_reload",
-		CmdBack:           "keybindings.bind_back",
-		CmdForward:        "keybindings.bind_forward",
-		CmdMoveUp:         "keybindings.bind_moveup",
-		CmdMoveDown:       "keybindings.bind_movedown",
-		CmdMoveLeft:       "keybindings.bind_moveleft",
-		CmdMoveRight:      "keybindings.bind_moveright",
-		CmdPgup:           "keybindings.bind_pgup",
-		CmdPgdn:           "keybindings.bind_pgdn",
-		CmdNewTab:         "keybindings.bind_new_tab",
-		CmdCloseTab:       "keybindings.bind_close_tab",
-		CmdNextTab:        "keybindings.bind_next_tab",
-		CmdPrevTab:        "keybindings.bind_prev_tab",
-		CmdQuit:           "keybindings.bind_quit",
-		CmdHelp:           "keybindings.bind_help",
-		CmdSub:            "keybindings.bind_sub",
-		CmdAddSub:         "keybindings.bind_add_sub",
-		CmdCopyPageURL:    "keybindings.bind_copy_page_url",
-		CmdCopyTargetURL:  "keybindings.bind_copy_target_url",
-		CmdBeginning:      "keybindings.bind_beginning",
-		CmdEnd:            "keybindings.bind_end",
-		CmdURLHandlerOpen: "keybindings.bind_url_handler_open",
-		CmdCommand1:       "keybindings.bind_command1",
-		CmdCommand2:       "keybindings.bind_command2",
-		CmdCommand3:       "keybindings.bind_command3",
-		CmdCommand4:       "keybindings.bind_command4",
-		CmdCommand5:       "keybindings.bind_command5",
-		CmdCommand6:       "keybindings.bind_command6",
-		CmdCommand7:       "keybindings.bind_command7",
-		CmdCommand8:       "keybindings.bind_command8",
-		CmdCommand9:       "keybindings.bind_command9",
-		CmdCommand0:       "keybindings.bind_command0",
-		CmdCommandTarget1: "keybindings.bind_command_target1",
-		CmdCommandTarget2: "keybindings.bind_command_target2",
-		CmdCommandTarget3: "keybindings.bind_command_target3",
-		CmdCommandTarget4: "keybindings.bind_command_target4",
-		CmdCommandTarget5: "keybindings.bind_command_target5",
-		CmdCommandTarget6: "keybindings.bind_command_target6",
-		CmdCommandTarget7: "keybindings.bind_command_target7",
-		CmdCommandTarget8: "keybindings.bind_command_target8",
-		CmdCommandTarget9: "keybindings.bind_command_target9",
-		CmdCommandTarget0: "keybindings.bind_command_target0",
-		CmdSearch:         "keybindings.bind_search",
-		CmdNextMatch:      "keybindings.bind_next_match",
-		CmdPrevMatch:      "keybindings.bind_prev_match",
-	}
-	// This is split off to allow shift_numbers to override bind_tab[1-90]
-	// (This is needed for older configs so that the default bind_tab values
-	// aren't used)
-	configTabNBindings := map[Command]string{
-		CmdTab1: "keybindings.bind_tab1",
-		CmdTab2: "keybindings.bind_tab2",
-		CmdTab3: "keybindings.bind_tab3",
-		CmdTab4: "keybindings.bind_tab4",
-		CmdTab5: "keybindings.bind_tab5",
-		CmdTab6: "keybindings.bind_tab6",
-		CmdTab7: "keybindings.bind_tab7",
-		CmdTab8: "keybindings.bind_tab8",
-		CmdTab9: "keybindings.bind_tab9",
-		CmdTab0: "keybindings.bind_tab0",
-	}
 	tcellKeys = make(map[string]tcell.Key)
 	bindings = make(map[keyBinding]Command)
 
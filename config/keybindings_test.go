@@ -0,0 +1,29 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestDefaultKeyBindingsUnique(t *testing.T) {
+	setDefaults()
+	KeyInit() // Sets up tcellKeys
+
+	used := make(map[keyBinding]string)
+	for _, m := range []map[Command]string{configBindings, configTabNBindings} {
+		for _, key := range m {
+			for _, b := range viper.GetStringSlice(key) {
+				kb, ok := toKeyBinding(b)
+				if !ok {
+					t.Errorf("%s has an invalid default binding %q", key, b)
+					continue
+				}
+				if other, ok := used[kb]; ok && other != key {
+					t.Errorf("%q is the default binding for both %s and %s", b, key, other)
+				}
+				used[kb] = key
+			}
+		}
+	}
+}
@@ -18,6 +18,14 @@ func aboutInit(version, commit, builtBy string) {
 => about:bookmarks
 => about:subscriptions
 => about:manage-subscriptions
+=> about:identities
+=> about:tofu
+=> about:cache
+=> about:downloads
+=> about:history
+=> about:search
+=> about:closed-tabs
+=> about:sessions
 => about:newtab
 => about:version
 => about:license
@@ -0,0 +1,99 @@
+package display
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/makeworld-the-better-one/amfora/cache"
+	"github.com/makeworld-the-better-one/amfora/renderer"
+	"github.com/makeworld-the-better-one/amfora/structs"
+)
+
+// CachePage displays the cache page in the current tab. `u` is the URL
+// entered by the user, and it may have a query string with an action.
+// It returns whether the page should be added to history.
+func CachePage(t *tab, u string) bool {
+	if len(u) <= 12 || u[:12] != "about:cache?" {
+		renderCachePage(t)
+		return true
+	}
+
+	q, err := url.ParseQuery(u[12:])
+	if err != nil {
+		Error("URL Error", "Invalid query string: "+err.Error())
+		return false
+	}
+	switch q.Get("action") {
+	case "remove-page":
+		cache.RemovePage(q.Get("url"))
+		cache.RemoveResponse(q.Get("url"))
+	case "remove-redir":
+		cache.RemoveRedir(q.Get("url"))
+	case "clear":
+		if !YesNo("Clear all cached pages and redirects?") {
+			return false
+		}
+		cache.ClearPages()
+		cache.ClearRedirs()
+		if err := cache.ClearResponses(); err != nil {
+			Error("Cache Error", "Error clearing the persistent cache: "+err.Error())
+		}
+	default:
+		Error("URL Error", "Unknown cache action.")
+		return false
+	}
+	renderCachePage(t) // Reload
+	return false
+}
+
+func renderCachePage(t *tab) {
+	stats := cache.GetStats()
+	rawPage := "# Cache\n\n" +
+		fmt.Sprintf("%d pages, %s. %d hits, %d misses.\n",
+			stats.Pages, humanize.Bytes(uint64(stats.Size)), stats.Hits, stats.Misses)
+	if cache.DiskEnabled() {
+		rawPage += "Pages are also saved to disk, removing them here removes them from the disk too.\n"
+	}
+	rawPage += "\n=> about:cache?" + url.Values{"action": {"clear"}}.Encode() + " Clear everything\n"
+
+	rawPage += "\n## Pages\n\nMost recently used first.\n\n"
+	pages := cache.AllPages()
+	if len(pages) == 0 {
+		rawPage += "No pages are cached.\n"
+	}
+	for _, p := range pages {
+		rawPage += fmt.Sprintf("=> %s %s\n", p.URL, p.URL)
+		rawPage += fmt.Sprintf("%s, made %s, used %s\n",
+			humanize.Bytes(uint64(p.Size)), humanize.Time(p.MadeAt), humanize.Time(p.LastUsed))
+		rawPage += "=> about:cache?" + url.Values{"action": {"remove-page"}, "url": {p.URL}}.Encode() + " Remove\n\n"
+	}
+
+	rawPage += "\n## Redirects\n\nPermanent redirects are remembered, and followed without asking the server.\n\n"
+	redirs := cache.AllRedirs()
+	if len(redirs) == 0 {
+		rawPage += "No redirects are cached.\n"
+	}
+	ogs := make([]string, 0, len(redirs))
+	for og := range redirs {
+		ogs = append(ogs, og)
+	}
+	sort.Strings(ogs)
+	for _, og := range ogs {
+		rawPage += fmt.Sprintf("=> %s %s → %s\n", redirs[og], og, redirs[og])
+		rawPage += "=> about:cache?" + url.Values{"action": {"remove-redir"}, "url": {og}}.Encode() + " Remove\n\n"
+	}
+
+	content, links := renderer.RenderGemini(rawPage, textWidth(), false)
+	page := structs.Page{
+		Raw:       rawPage,
+		Content:   content,
+		Links:     links,
+		URL:       "about:cache",
+		TermWidth: termW,
+		Mediatype: structs.TextGemini,
+	}
+	setPage(t, &page)
+	t.applyBottomBar()
+}
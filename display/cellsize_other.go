@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package display
+
+// cellSize returns the size of a terminal cell in pixels.
+// The size can't be found on this OS, so a common one is assumed.
+func cellSize() (int, int) {
+	return defaultCellWidth, defaultCellHeight
+}
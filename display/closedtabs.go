@@ -0,0 +1,153 @@
+package display
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/makeworld-the-better-one/amfora/renderer"
+	"github.com/makeworld-the-better-one/amfora/structs"
+)
+
+// Closed tabs are kept with their history, so they can be reopened.
+// They're only kept until Amfora is closed.
+
+// The number of closed tabs that are kept, older ones are forgotten.
+const maxClosedTabs = 20
+
+// closedTab is a tab that was closed.
+type closedTab struct {
+	id     int // So links on about:closed-tabs still work after more tabs are closed
+	t      *tab
+	index  int // Where the tab was
+	closed time.Time
+}
+
+// closedTabs are the closed tabs, the most recent last.
+var closedTabs []*closedTab
+var closedTabID int
+
+// pushClosedTab keeps a tab that is being closed.
+func pushClosedTab(t *tab, index int) {
+	// Keep where it's scrolled to, for when it's reopened
+	t.historyCachePage()
+	t.view.Highlight("")
+
+	closedTabID++
+	closedTabs = append(closedTabs, &closedTab{id: closedTabID, t: t, index: index, closed: time.Now()})
+	if len(closedTabs) > maxClosedTabs {
+		closedTabs = closedTabs[len(closedTabs)-maxClosedTabs:]
+	}
+}
+
+// takeClosedTab removes the closed tab at index n of closedTabs and
+// returns it.
+func takeClosedTab(n int) *closedTab {
+	ct := closedTabs[n]
+	closedTabs = append(closedTabs[:n], closedTabs[n+1:]...)
+	return ct
+}
+
+// reopenClosedTab opens a closed tab again where it was before, and switches
+// to it.
+func reopenClosedTab(ct *closedTab) {
+	index := ct.index
+	if index > NumTabs() {
+		index = NumTabs()
+	}
+	newTabs := make([]*tab, 0, NumTabs()+1)
+	newTabs = append(newTabs, tabs[:index]...)
+	newTabs = append(newTabs, ct.t)
+	newTabs = append(newTabs, tabs[index:]...)
+	setTabs(newTabs, index)
+}
+
+// ReopenTab opens the most recently closed tab again.
+func ReopenTab() {
+	if len(closedTabs) == 0 {
+		go Info("There are no closed tabs to reopen.")
+		return
+	}
+	reopenClosedTab(takeClosedTab(len(closedTabs) - 1))
+}
+
+// ClosedTabsPage displays the closed tabs page in the current tab. `u` is
+// the URL entered by the user, and it may have a query string with an
+// action. It returns whether the page should be added to history.
+func ClosedTabsPage(t *tab, u string) bool {
+	if len(u) <= 18 || u[:18] != "about:closed-tabs?" {
+		renderClosedTabsPage(t)
+		return true
+	}
+
+	q, err := url.ParseQuery(u[18:])
+	if err != nil {
+		Error("URL Error", "Invalid query string: "+err.Error())
+		return false
+	}
+	switch q.Get("action") {
+	case "reopen":
+		id, err := strconv.Atoi(q.Get("id"))
+		n := -1
+		for i, ct := range closedTabs {
+			if err == nil && ct.id == id {
+				n = i
+			}
+		}
+		if n == -1 {
+			Error("Error", "That tab isn't in the list anymore.")
+			return false
+		}
+		ct := takeClosedTab(n)
+		// Reloaded before switching tabs, so this tab doesn't take the focus
+		renderClosedTabsPage(t)
+		reopenClosedTab(ct)
+		return false
+	case "clear":
+		closedTabs = nil
+	default:
+		Error("URL Error", "Unknown closed tabs action.")
+		return false
+	}
+	renderClosedTabsPage(t) // Reload
+	return false
+}
+
+func renderClosedTabsPage(t *tab) {
+	rawPage := "# Closed Tabs\n\n" +
+		fmt.Sprintf("The last %d tabs that were closed are kept, along with their history. ", maxClosedTabs) +
+		"Reopening a tab puts it back where it was. They are forgotten when Amfora is closed.\n\n"
+	if len(closedTabs) == 0 {
+		rawPage += "No tabs have been closed.\n"
+	} else {
+		rawPage += "=> about:closed-tabs?" + url.Values{"action": {"clear"}}.Encode() + " Forget all closed tabs\n"
+	}
+
+	// Most recently closed first
+	for i := len(closedTabs) - 1; i >= 0; i-- {
+		ct := closedTabs[i]
+		h := ct.t.history
+		pages := "1 page"
+		if len(h.urls) != 1 {
+			pages = fmt.Sprintf("%d pages", len(h.urls))
+		}
+		rawPage += fmt.Sprintf("\n### %s\nTab %d, closed %s, %s in its history\n",
+			ct.t.page.URL, ct.index+1, humanize.Time(ct.closed), pages)
+		rawPage += "=> about:closed-tabs?" + url.Values{"action": {"reopen"}, "id": {strconv.Itoa(ct.id)}}.Encode() +
+			" Reopen\n"
+	}
+
+	content, links := renderer.RenderGemini(rawPage, textWidth(), false)
+	page := structs.Page{
+		Raw:       rawPage,
+		Content:   content,
+		Links:     links,
+		URL:       "about:closed-tabs",
+		TermWidth: termW,
+		Mediatype: structs.TextGemini,
+	}
+	setPage(t, &page)
+	t.applyBottomBar()
+}
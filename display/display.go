@@ -30,7 +30,6 @@ var termH int
 var bottomBar = cview.NewInputField()
 
 var originalText []byte
-var tagsRegex = regexp.MustCompile(`\[[a-zA-Z0-9_,;: \-\."#]+[^\[]*\]`)
 var searchMode = false
 var searchString = ""
 var bottomBarText = ""
@@ -65,6 +64,7 @@ var App = cview.NewApplication()
 
 func Init(version, commit, builtBy string) {
 	aboutInit(version, commit, builtBy)
+	searchKindInit()
 
 	// Detect terminal colors for syntax highlighting
 	switch termenv.ColorProfile() {
@@ -80,6 +80,7 @@ func Init(version, commit, builtBy string) {
 
 	App.EnableMouse(false)
 	App.SetRoot(layout, true)
+	graphicsInit()
 	App.SetAfterResizeFunc(func(width int, height int) {
 		// Store for calculations
 		termW = width
@@ -160,8 +161,7 @@ func Init(version, commit, builtBy string) {
 		case tcell.KeyEnter:
 
 			if searchMode {
-				// Escape the search string to not find regexp symbols
-				searchString = regexp.QuoteMeta(bottomBar.GetText())
+				searchString = bottomBar.GetText()
 
 				if strings.TrimSpace(searchString) == "" {
 					// Ignore
@@ -169,47 +169,24 @@ func Init(version, commit, builtBy string) {
 					return
 				}
 
+				re, kind, err := searchRegexp(searchString)
+				if err != nil {
+					reset()
+					go Error("Search Error", "Invalid regex: "+err.Error())
+					return
+				}
+
 				if tabs[tab].mode != tabModeSearch {
 					originalText = tabs[curTab].view.GetBytes(false)
 				}
 				tabs[tab].mode = tabModeSearch
 
-				// find all positions of the search string
-				searchRegex := regexp.MustCompile(searchString)
-				searchIdx := searchRegex.FindAllIndex(originalText, -1)
-
-				// find all positions of tags
-				tagsIdx := tagsRegex.FindAllIndex(originalText, -1)
-
-				text := make([]byte, 0)
-				matches = 0
-				lastMatch := 0
-
-				// loops through all occurrences and check if they
-				// discard if they lie within tags.
-				// []byte text is build from the original text buffer
-				// with the actual search strings replaced by tagged regions
-				// to highlight.
-				for i, match := range searchIdx {
-					for _, tag := range tagsIdx {
-						if match[0] >= tag[0] && match[1] <= tag[1] {
-							break
-						}
-					}
-
-					matches++
-					text = append(text, originalText[lastMatch:match[0]]...)
-					replacement := []byte(fmt.Sprint(`["search-`, i, `"]`, searchString, `[""]`))
-					text = append(text, replacement...)
-					lastMatch = match[0] + len(searchString)
-				}
-				text = append(text, originalText[lastMatch:]...)
-
+				var text []byte
+				text, matches = highlightMatches(tabs[tab].page, originalText, re, kind)
 				tabs[curTab].view.SetBytes(text)
 
 				curMatch = 0
-				tabs[curTab].view.Highlight(fmt.Sprint("search-", "0"))
-				tabs[curTab].view.ScrollToHighlight()
+				showMatch(tabs[curTab])
 				App.SetFocus(tabs[tab].view)
 
 				return
@@ -294,11 +271,17 @@ func Init(version, commit, builtBy string) {
 						u := viper.GetString("a-general.search") + "?" + gemini.QueryEscape(query)
 						// Don't use the cached version of the search
 						cache.RemovePage(client.NormalizeURL(u))
+						if !offline.Load() {
+							cache.RemoveResponse(client.NormalizeURL(u))
+						}
 						URL(u)
 					} else {
 						// Full URL
 						// Don't use cached version for manually entered URL
 						cache.RemovePage(client.NormalizeURL(client.FixUserURL(query)))
+						if !offline.Load() {
+							cache.RemoveResponse(client.NormalizeURL(client.FixUserURL(query)))
+						}
 						URL(query)
 					}
 					return
@@ -317,8 +300,14 @@ func Init(version, commit, builtBy string) {
 			// Set back to what it was
 			reset()
 			return
+		case tcell.KeyTab, tcell.KeyBacktab:
+			if searchMode {
+				// Pick another kind of search
+				nextSearchKind(key == tcell.KeyBacktab)
+			}
+			return
 		}
-		// Other potential keys are Tab and Backtab, they are ignored
+		// Other potential keys are ignored
 	})
 
 	// Render the default new tab content ONCE and store it for later
@@ -378,16 +367,14 @@ func Init(version, commit, builtBy string) {
 			case config.CmdNextMatch:
 				if curMatch < (matches - 1) {
 					curMatch++
-					tabs[curTab].view.Highlight(fmt.Sprint("search-", curMatch))
 				}
-				tabs[curTab].view.ScrollToHighlight()
+				showMatch(tabs[curTab])
 				return nil
 			case config.CmdPrevMatch:
 				if curMatch > 0 {
 					curMatch--
-					tabs[curTab].view.Highlight(fmt.Sprint("search-", curMatch))
 				}
-				tabs[curTab].view.ScrollToHighlight()
+				showMatch(tabs[curTab])
 				return nil
 			case config.CmdInvalid:
 				if event.Key() == tcell.KeyEsc {
@@ -416,7 +403,7 @@ func Init(version, commit, builtBy string) {
 				App.SetFocus(bottomBar)
 				return nil
 			case config.CmdSearch:
-				bottomBar.SetLabel("[::b]Search: [::-]")
+				bottomBar.SetLabel(searchLabel())
 				bottomBarText = bottomBar.GetText()
 				bottomBar.SetText("")
 				searchMode = true
@@ -431,6 +418,15 @@ func Init(version, commit, builtBy string) {
 			case config.CmdAddSub:
 				go addSubscription()
 				return nil
+			case config.CmdOffline:
+				go ToggleOffline()
+				return nil
+			case config.CmdTitan:
+				go titanUpload(tabs[curTab])
+				return nil
+			case config.CmdPrivate:
+				go TogglePrivate()
+				return nil
 			}
 		}
 
@@ -452,6 +448,9 @@ func Init(version, commit, builtBy string) {
 		case config.CmdCloseTab:
 			CloseTab()
 			return nil
+		case config.CmdReopenTab:
+			ReopenTab()
+			return nil
 		case config.CmdQuit:
 			Stop()
 			return nil
@@ -486,6 +485,7 @@ func Init(version, commit, builtBy string) {
 // Stop stops the app gracefully.
 // In the future it will handle things like ongoing downloads, etc
 func Stop() {
+	saveSession()
 	App.Stop()
 }
 
@@ -563,6 +563,7 @@ func CloseTab() {
 		return
 	}
 
+	pushClosedTab(tabs[curTab], curTab)
 	tabs = tabs[:len(tabs)-1]
 	browser.RemoveTab(strconv.Itoa(curTab))
 
@@ -577,6 +578,10 @@ func CloseTab() {
 	tabs[curTab].applyAll()
 
 	App.SetFocus(tabs[curTab].view)
+	if tabs[curTab].unloaded {
+		loadRestoredTab(tabs[curTab])
+	}
+	sessionChanged()
 
 	// Just in case
 	App.Draw()
@@ -607,6 +612,10 @@ func SwitchTab(tab int) {
 	tabs[curTab].applyAll()
 
 	App.SetFocus(tabs[curTab].view)
+	if tabs[curTab].unloaded {
+		loadRestoredTab(tabs[curTab])
+	}
+	sessionChanged()
 
 	// Just in case
 	App.Draw()
@@ -637,6 +646,9 @@ func Reload() {
 
 	go func(t *tab) {
 		cache.RemovePage(tabs[curTab].page.URL)
+		if !offline.Load() {
+			cache.RemoveResponse(tabs[curTab].page.URL)
+		}
 		handleURL(t, t.page.URL, 0) // goURL is not used bc history shouldn't be added to
 		if t == tabs[curTab] {
 			// Display the bottomBar state that handleURL set
@@ -680,8 +692,11 @@ func NumTabs() int {
 }
 
 func resetSearch() {
-	tabs[curTab].view.SetBytes(originalText)
-	tabs[curTab].mode = tabModeDone
+	if tabs[curTab].mode == tabModeSearch {
+		// Remove the highlights
+		tabs[curTab].view.SetBytes(originalText)
+		tabs[curTab].mode = tabModeDone
+	}
 	searchMode = false
 	bottomBar.SetLabel("")
 	bottomBar.SetText(bottomBarText)
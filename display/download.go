@@ -5,6 +5,7 @@ import (
 	"io"
 	"io/ioutil"
 	"mime"
+	"net"
 	"net/url"
 	"os"
 	"os/exec"
@@ -12,15 +13,15 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"code.rocketnine.space/tslocum/cview"
 	"github.com/gdamore/tcell/v2"
+	"github.com/makeworld-the-better-one/amfora/client"
 	"github.com/makeworld-the-better-one/amfora/config"
+	"github.com/makeworld-the-better-one/amfora/downloads"
 	"github.com/makeworld-the-better-one/amfora/structs"
 	"github.com/makeworld-the-better-one/amfora/sysopen"
 	"github.com/makeworld-the-better-one/go-gemini"
-	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/viper"
 )
 
@@ -90,27 +91,68 @@ func dlInit() {
 		dlChoiceCh <- buttonLabel
 	})
 
+	dlm.AddButtons([]string{"Ok", "View downloads"})
 	dlm.SetBorder(true)
 	frame := dlm.GetFrame()
 	frame.SetTitleAlign(cview.AlignCenter)
 	frame.SetTitle(" Download ")
 	dlm.SetDoneFunc(func(buttonIndex int, buttonLabel string) {
-		if buttonLabel == "Ok" {
-			panels.HidePanel(PanelDownload)
-			App.SetFocus(tabs[curTab].view)
-			App.Draw()
+		panels.HidePanel(PanelDownload)
+		App.SetFocus(tabs[curTab].view)
+		App.Draw()
+		if buttonLabel == "View downloads" {
+			URL("about:downloads")
 		}
 	})
+
+	downloads.SetMaxActive(viper.GetInt("a-general.max_downloads"))
+	downloads.SetFetcher(fetchDownload)
+}
+
+// fetchDownload requests the URL again to retry a download, using a proxy
+// if one is set for the scheme.
+func fetchDownload(u string) (io.ReadCloser, string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var res *gemini.Response
+	proxy := strings.TrimSpace(viper.GetString("proxies." + parsed.Scheme))
+	if parsed.Scheme == "gemini" || proxy == "" || proxy == "off" {
+		res, err = client.Fetch(u)
+	} else {
+		proxyHostname, proxyPort, err2 := net.SplitHostPort(proxy)
+		if err2 != nil {
+			// Likely no port in the host
+			proxyHostname = proxy
+			proxyPort = "1965"
+		}
+		res, err = client.FetchWithProxy(proxyHostname, proxyPort, u)
+	}
+	if err != nil {
+		if res != nil {
+			// TOFU errors return the response too
+			res.Body.Close()
+		}
+		return nil, "", err
+	}
+	if gemini.SimplifyStatus(res.Status) != 20 {
+		res.Body.Close()
+		return nil, "", fmt.Errorf("server returned status %d %s", res.Status, res.Meta) //nolint:goerr113
+	}
+	client.SetReadTimeout(res, 0) //nolint:errcheck
+	return res.Body, res.Meta, nil
 }
 
-func getMediaHandler(resp *gemini.Response) config.MediaHandler {
+func getMediaHandler(meta string) config.MediaHandler {
 	def := config.MediaHandler{
 		Cmd:      nil,
 		NoPrompt: false,
 		Stream:   false,
 	}
 
-	mediatype, _, err := mime.ParseMediaType(resp.Meta)
+	mediatype, _, err := mime.ParseMediaType(meta)
 	if err != nil {
 		return def
 	}
@@ -134,7 +176,7 @@ func getMediaHandler(resp *gemini.Response) config.MediaHandler {
 // dlChoice displays the download choice modal and acts on the user's choice.
 // It should run in a goroutine.
 func dlChoice(text, u string, resp *gemini.Response) {
-	mediaHandler := getMediaHandler(resp)
+	mediaHandler := getMediaHandler(resp.Meta)
 	var choice string
 
 	if mediaHandler.NoPrompt {
@@ -151,8 +193,7 @@ func dlChoice(text, u string, resp *gemini.Response) {
 	if choice == "Download" {
 		panels.HidePanel(PanelDownloadChoiceModal)
 		App.Draw()
-		downloadURL(config.DownloadsDir, u, resp)
-		resp.Body.Close() // Only close when the file is downloaded
+		downloadURL(config.DownloadsDir, u, resp, false)
 		return
 	}
 	if choice == "Open" {
@@ -172,7 +213,7 @@ func dlChoice(text, u string, resp *gemini.Response) {
 // If there is no system viewer configured for the particular mediatype, it opens it
 // with the default system viewer.
 func open(u string, resp *gemini.Response) {
-	mediaHandler := getMediaHandler(resp)
+	mediaHandler := getMediaHandler(resp.Meta)
 
 	if mediaHandler.Stream {
 		// Run command with downloaded data from stdin
@@ -197,14 +238,12 @@ func open(u string, resp *gemini.Response) {
 		return
 	}
 
-	path := downloadURL(config.TempDownloadsDir, u, resp)
-	if path == "" {
-		return
-	}
+	downloadURL(config.TempDownloadsDir, u, resp, true)
+}
 
-	panels.HidePanel(PanelDownload)
-	App.SetFocus(tabs[curTab].view)
-	App.Draw()
+// openFile opens a downloaded file with the media handler for its mediatype.
+func openFile(path, meta string) {
+	mediaHandler := getMediaHandler(meta)
 
 	if mediaHandler.Cmd == nil {
 		// Open with system default viewer
@@ -229,73 +268,61 @@ func open(u string, resp *gemini.Response) {
 	App.Draw()
 }
 
-// downloadURL pulls up a modal to show download progress and saves the URL content.
+// downloadURL adds the URL content to the background downloads, and pulls up
+// a modal saying so. If openAfter is true the file is opened when it's done.
 // downloadPage should be used for Page content.
-// Returns location downloaded to or an empty string on error.
-func downloadURL(dir, u string, resp *gemini.Response) string {
-	_, _, width, _ := dlModal.GetInnerRect()
-	// Copy of progressbar.DefaultBytesSilent with custom width
-	bar := progressbar.NewOptions64(
-		-1,
-		progressbar.OptionSetWidth(width),
-		progressbar.OptionSetWriter(ioutil.Discard),
-		progressbar.OptionShowBytes(true),
-		progressbar.OptionThrottle(65*time.Millisecond),
-		progressbar.OptionShowCount(),
-		progressbar.OptionSpinnerType(14),
-	)
-	bar.RenderBlank() //nolint:errcheck
-
+// Returns location the file will be downloaded to or an empty string on error.
+func downloadURL(dir, u string, resp *gemini.Response, openAfter bool) string {
 	savePath, err := downloadNameFromURL(dir, u, "")
 	if err != nil {
+		resp.Body.Close()
 		Error("Download Error", "Error deciding on file name: "+err.Error())
 		return ""
 	}
-	f, err := os.OpenFile(savePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	// Create the partial file now, so other downloads in the queue don't choose the same name
+	f, err := os.OpenFile(downloads.PartPath(savePath), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
+		resp.Body.Close()
 		Error("Download Error", "Error creating download file: "+err.Error())
 		return ""
 	}
-	defer f.Close()
+	f.Close()
 
-	done := false
-
-	go func(isDone *bool) {
-		// Update the bar display
-		for !*isDone {
-			dlModal.SetText(bar.String())
-			App.Draw()
-			time.Sleep(100 * time.Millisecond)
-		}
-	}(&done)
+	downloads.Add(u, resp.Meta, savePath, resp.Body, dlDone(openAfter))
 
-	// Display
-	dlModal.ClearButtons()
-	dlModal.AddButtons([]string{"Downloading..."})
+	if openAfter {
+		dlModal.SetText("Downloading in the background, the file will be opened when it's done.")
+	} else {
+		dlModal.SetText(fmt.Sprintf("Downloading in the background, the file will be saved to %s.", savePath))
+	}
+	dlModal.GetForm().SetFocus(0)
 	panels.ShowPanel(PanelDownload)
 	panels.SendToFront(PanelDownload)
 	App.SetFocus(dlModal)
 	App.Draw()
 
-	_, err = io.Copy(io.MultiWriter(f, bar), resp.Body)
-	done = true
-	if err != nil {
-		panels.HidePanel(PanelDownload)
-		Error("Download Error", err.Error())
-		f.Close()
-		os.Remove(savePath) // Remove partial file
-		return ""
-	}
-	dlModal.SetText(fmt.Sprintf("Download complete! File saved to %s.", savePath))
-	dlModal.ClearButtons()
-	dlModal.AddButtons([]string{"Ok"})
-	dlModal.GetForm().SetFocus(100)
-	App.SetFocus(dlModal)
-	App.Draw()
-
 	return savePath
 }
 
+// dlDone returns a function to be called when a download finishes. It tells
+// the user if the download failed or was already saved, and opens the file
+// if openAfter is true.
+func dlDone(openAfter bool) func(downloads.Download) {
+	return func(d downloads.Download) {
+		switch d.Status {
+		case downloads.Done:
+			if openAfter {
+				openFile(d.Path, d.Meta)
+			} else if d.Duplicate {
+				Info(fmt.Sprintf("%s was already downloaded, so it wasn't saved again. The file is at %s.",
+					escapeMeta(d.URL), escapeMeta(d.Path)))
+			}
+		case downloads.Failed:
+			Error("Download Error", fmt.Sprintf("Error downloading %s: %v", d.URL, d.Err))
+		}
+	}
+}
+
 // downloadPage saves the passed Page to a file.
 // It returns the saved path and an error.
 // It always cleans up, so if an error is returned there is no file saved
@@ -305,6 +332,8 @@ func downloadPage(p *structs.Page) (string, error) {
 
 	if p.Mediatype == structs.TextGemini {
 		savePath, err = downloadNameFromURL(config.DownloadsDir, p.URL, ".gmi")
+	} else if p.Mediatype == structs.Image {
+		savePath, err = downloadNameFromURL(config.DownloadsDir, p.URL, "")
 	} else {
 		savePath, err = downloadNameFromURL(config.DownloadsDir, p.URL, ".txt")
 	}
@@ -392,7 +421,8 @@ func getSafeDownloadName(dir, name string, lastDot bool, n int) (string, error)
 
 	nn := newName()
 	for i := range files {
-		if nn == files[i] {
+		// The name is also taken if a download is still being saved there
+		if nn == files[i] || nn+downloads.PartExt == files[i] {
 			d.Close()
 			return getSafeDownloadName(dir, name, lastDot, n+1)
 		}
@@ -0,0 +1,185 @@
+package display
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/makeworld-the-better-one/amfora/config"
+	"github.com/makeworld-the-better-one/amfora/downloads"
+	"github.com/makeworld-the-better-one/amfora/renderer"
+	"github.com/makeworld-the-better-one/amfora/structs"
+	"github.com/spf13/viper"
+)
+
+// DownloadsPage displays the downloads page in the current tab. `u` is the URL
+// entered by the user, and it may have a query string with an action.
+// It returns whether the page should be added to history.
+func DownloadsPage(t *tab, u string) bool {
+	if len(u) <= 16 || u[:16] != "about:downloads?" {
+		renderDownloadsPage(t)
+		return true
+	}
+
+	q, err := url.ParseQuery(u[16:])
+	if err != nil {
+		Error("URL Error", "Invalid query string: "+err.Error())
+		return false
+	}
+	switch q.Get("action") {
+	case "clear":
+		downloads.ClearFinished()
+		renderDownloadsPage(t) // Reload
+		return false
+	case "resume":
+		if _, err := downloads.Resume(config.DownloadsDir, q.Get("path"), dlDone(false)); err != nil {
+			Error("Download Error", err.Error())
+			return false
+		}
+		renderDownloadsPage(t) // Reload
+		return false
+	case "delete-partial":
+		if !YesNo("Delete the partial download?") {
+			return false
+		}
+		if err := downloads.DeleteInterrupted(config.DownloadsDir, q.Get("path")); err != nil {
+			Error("Download Error", err.Error())
+			return false
+		}
+		renderDownloadsPage(t) // Reload
+		return false
+	}
+
+	id, err := strconv.Atoi(q.Get("id"))
+	if err != nil {
+		Error("URL Error", "Invalid download ID.")
+		return false
+	}
+	switch q.Get("action") {
+	case "cancel":
+		err = downloads.Cancel(id)
+	case "retry":
+		err = downloads.Retry(id)
+	case "remove":
+		err = downloads.Remove(id)
+	case "open":
+		d, ok := downloads.Get(id)
+		if !ok || d.Status != downloads.Done {
+			Error("Download Error", "That download isn't finished.")
+			return false
+		}
+		go openFile(d.Path, d.Meta)
+		return false
+	default:
+		Error("URL Error", "Unknown downloads action.")
+		return false
+	}
+	if err != nil {
+		Error("Download Error", err.Error())
+		return false
+	}
+	renderDownloadsPage(t) // Reload
+	return false
+}
+
+// downloadsAction returns the URL for doing an action on a download.
+func downloadsAction(action string, id int) string {
+	return "about:downloads?" + url.Values{"action": {action}, "id": {strconv.Itoa(id)}}.Encode()
+}
+
+func renderDownloadsPage(t *tab) {
+	all := downloads.All()
+
+	var running, finished, failed string
+	numRunning := 0
+	for _, d := range all {
+		entry := fmt.Sprintf("=> %s %s\n", d.URL, d.URL)
+		switch d.Status {
+		case downloads.Queued:
+			numRunning++
+			entry += fmt.Sprintf("Queued, saving to %s\n", d.Path)
+			entry += fmt.Sprintf("=> %s Cancel\n\n", downloadsAction("cancel", d.ID))
+			running += entry
+		case downloads.Active:
+			numRunning++
+			entry += fmt.Sprintf("%s at %s/s, saving to %s\n",
+				humanize.Bytes(uint64(d.Size)), humanize.Bytes(uint64(d.Speed())), d.Path)
+			entry += fmt.Sprintf("=> %s Cancel\n\n", downloadsAction("cancel", d.ID))
+			running += entry
+		case downloads.Done:
+			if d.Duplicate {
+				entry += fmt.Sprintf("%s, finished %s, already downloaded to %s\n",
+					humanize.Bytes(uint64(d.Size)), humanize.Time(d.Finished), d.Path)
+			} else {
+				entry += fmt.Sprintf("%s at %s/s, finished %s, saved to %s\n",
+					humanize.Bytes(uint64(d.Size)), humanize.Bytes(uint64(d.Speed())),
+					humanize.Time(d.Finished), d.Path)
+			}
+			entry += fmt.Sprintf("SHA-256: %s\n", d.SHA256)
+			entry += fmt.Sprintf("=> %s Open\n", downloadsAction("open", d.ID))
+			entry += fmt.Sprintf("=> %s Remove from list\n\n", downloadsAction("remove", d.ID))
+			finished += entry
+		case downloads.Failed, downloads.Canceled:
+			if d.Status == downloads.Failed {
+				entry += fmt.Sprintf("Failed %s after %s: %v\n",
+					humanize.Time(d.Finished), humanize.Bytes(uint64(d.Size)), d.Err)
+			} else {
+				entry += fmt.Sprintf("Canceled %s after %s\n",
+					humanize.Time(d.Finished), humanize.Bytes(uint64(d.Size)))
+			}
+			entry += fmt.Sprintf("=> %s Retry\n", downloadsAction("retry", d.ID))
+			entry += fmt.Sprintf("=> %s Remove from list\n\n", downloadsAction("remove", d.ID))
+			failed += entry
+		}
+	}
+
+	rawPage := "# Downloads\n\n"
+	if n := viper.GetInt("a-general.max_downloads"); n > 0 {
+		rawPage += fmt.Sprintf("%d running or queued, at most %d run at once. Reload to see progress.\n",
+			numRunning, n)
+	} else {
+		rawPage += fmt.Sprintf("%d running. Reload to see progress.\n", numRunning)
+	}
+	rawPage += "\n=> about:downloads?" + url.Values{"action": {"clear"}}.Encode() + " Clear finished downloads from the list\n"
+
+	if running == "" {
+		running = "No downloads are running.\n"
+	}
+	if finished == "" {
+		finished = "No downloads have finished.\n"
+	}
+	if failed == "" {
+		failed = "No downloads have failed.\n"
+	}
+	rawPage += "\n## Running\n\n" + running +
+		"\n## Finished\n\n" + finished +
+		"\n## Failed\n\n" + failed
+
+	rawPage += "\n## Interrupted\n\nPartial downloads from earlier. Gemini can't continue a download partway, so they are downloaded again from the start.\n\n"
+	partials, err := downloads.Interrupted(config.DownloadsDir)
+	if err != nil {
+		rawPage += fmt.Sprintf("Error finding partial downloads: %v\n", err)
+	} else if len(partials) == 0 {
+		rawPage += "No downloads were interrupted.\n"
+	}
+	for _, p := range partials {
+		rawPage += fmt.Sprintf("=> %s %s\n", p.URL, p.URL)
+		rawPage += fmt.Sprintf("%s of %s, started %s, saving to %s\n",
+			humanize.Bytes(uint64(p.Size)), p.Meta, humanize.Time(p.Started), p.Path)
+		rawPage += "=> about:downloads?" + url.Values{"action": {"resume"}, "path": {p.Path}}.Encode() + " Download again\n"
+		rawPage += "=> about:downloads?" + url.Values{"action": {"delete-partial"}, "path": {p.Path}}.Encode() + " Delete\n\n"
+	}
+
+	content, links := renderer.RenderGemini(rawPage, textWidth(), false)
+	page := structs.Page{
+		Raw:       rawPage,
+		Content:   content,
+		Links:     links,
+		URL:       "about:downloads",
+		TermWidth: termW,
+		Mediatype: structs.TextGemini,
+	}
+	setPage(t, &page)
+	t.applyBottomBar()
+}
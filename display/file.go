@@ -3,10 +3,8 @@ package display
 import (
 	"fmt"
 	"io/ioutil"
-	"mime"
 	"net/url"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/makeworld-the-better-one/amfora/renderer"
@@ -48,10 +46,7 @@ func handleFile(u string) (*structs.Page, bool) {
 			return page, false
 		}
 
-		mimetype := mime.TypeByExtension(filepath.Ext(uri.Path))
-		if strings.HasSuffix(u, ".gmi") || strings.HasSuffix(u, ".gemini") {
-			mimetype = "text/gemini"
-		}
+		mimetype := renderer.FileMediatype(uri.Path)
 
 		if !strings.HasPrefix(mimetype, "text/") {
 			Error("File Error", "Cannot open file, not recognized as text.")
@@ -74,6 +69,16 @@ func handleFile(u string) (*structs.Page, bool) {
 				Links:     links,
 				TermWidth: termW,
 			}
+		} else if format, ok := renderer.ConvertedMediatype(mimetype); ok {
+			rendered, links := renderer.RenderGemini(renderer.ToGemini(format, string(content)), textWidth(), false)
+			page = &structs.Page{
+				Mediatype: format,
+				URL:       u,
+				Raw:       string(content),
+				Content:   rendered,
+				Links:     links,
+				TermWidth: termW,
+			}
 		} else {
 			page = &structs.Page{
 				Mediatype: structs.TextPlain,
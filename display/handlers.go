@@ -3,6 +3,7 @@ package display
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"mime"
 	"net"
 	"net/url"
@@ -10,6 +11,8 @@ import (
 	"path"
 	"strings"
 
+	"code.rocketnine.space/tslocum/cview"
+	"github.com/makeworld-the-better-one/amfora/bookmarks"
 	"github.com/makeworld-the-better-one/amfora/cache"
 	"github.com/makeworld-the-better-one/amfora/client"
 	"github.com/makeworld-the-better-one/amfora/config"
@@ -181,10 +184,81 @@ func handleAbout(t *tab, u string) (string, bool) {
 		return "", false
 	}
 
+	if u == "about:identities" || (len(u) > 17 && u[:17] == "about:identities?") {
+		Identities(t, u)
+		// Don't count actions in history
+		if u == "about:identities" {
+			return u, true
+		}
+		return "", false
+	}
+
+	if u == "about:cache" || (len(u) > 12 && u[:12] == "about:cache?") {
+		if CachePage(t, u) {
+			return u, true
+		}
+		return "", false
+	}
+
+	if u == "about:downloads" || (len(u) > 16 && u[:16] == "about:downloads?") {
+		if DownloadsPage(t, u) {
+			return "about:downloads", true
+		}
+		return "", false
+	}
+
+	if u == "about:search" || (len(u) > 13 && u[:13] == "about:search?") {
+		return SearchPage(t, u)
+	}
+
+	if u == "about:closed-tabs" || (len(u) > 18 && u[:18] == "about:closed-tabs?") {
+		if ClosedTabsPage(t, u) {
+			return u, true
+		}
+		return "", false
+	}
+
+	if u == "about:history" || (len(u) > 14 && u[:14] == "about:history?") {
+		return HistoryPage(t, u)
+	}
+
+	if u == "about:sessions" || (len(u) > 15 && u[:15] == "about:sessions?") {
+		if SessionsPage(t, u) {
+			return u, true
+		}
+		return "", false
+	}
+
+	if u == "about:tofu" || (len(u) > 11 && u[:11] == "about:tofu?") {
+		if TofuPage(t, u) {
+			return u, true
+		}
+		return "", false
+	}
+
 	Error("Error", "Not a valid 'about:' URL.")
 	return "", false
 }
 
+// updateMovedURL changes bookmarks and subscriptions for a URL that was
+// permanently redirected, and lets the user know.
+func updateMovedURL(oldURL, newURL string) {
+	moved := make([]string, 0, 2)
+	if bookmarks.Move(oldURL, newURL) {
+		moved = append(moved, "bookmark")
+	}
+	if ok, err := subscriptions.Move(oldURL, newURL); ok {
+		moved = append(moved, "subscription")
+	} else if err != nil {
+		Error("Subscription Error", "Error saving moved subscription: "+err.Error())
+	}
+	if len(moved) == 0 {
+		return
+	}
+	Info(fmt.Sprintf("%s permanently moved to %s, so your %s was updated.",
+		cview.Escape(oldURL), cview.Escape(newURL), strings.Join(moved, " and ")))
+}
+
 // handleURL displays whatever action is needed for the provided URL,
 // and applies it to the current tab.
 // It loads documents, handles errors, brings up a download prompt, etc.
@@ -272,12 +346,13 @@ func handleURL(t *tab, u string, numRedirects int) (string, bool) {
 	}
 
 	if strings.HasPrefix(u, "http") {
-		if proxy == "" || proxy == "off" || t.preferURLHandler {
+		if t.preferURLHandler || ((proxy == "" || proxy == "off") && !viper.GetBool("a-general.builtin_http")) {
 			// No proxy available
 			handleHTTP(u, true)
 			return ret("", false)
 		}
-		usingProxy = true
+		// Otherwise it's proxied, or fetched with the built-in HTTP client
+		usingProxy = proxy != "" && proxy != "off"
 	}
 
 	if strings.HasPrefix(u, "file") {
@@ -291,24 +366,40 @@ func handleURL(t *tab, u string, numRedirects int) (string, bool) {
 
 	if !strings.HasPrefix(u, "http") && !strings.HasPrefix(u, "gemini") && !strings.HasPrefix(u, "file") {
 		// Not a Gemini URL
-		if proxy == "" || proxy == "off" || t.preferURLHandler {
+		if t.preferURLHandler || (!client.IsNative(parsed.Scheme) && (proxy == "" || proxy == "off")) {
 			// No proxy available
 			handleOther(u)
 			return ret("", false)
 		}
-		usingProxy = true
+		// Gopher and other protocols client.Fetch supports are only proxied if set
+		usingProxy = proxy != "" && proxy != "off"
 	}
 
-	// Gemini URL, or one with a Gemini proxy available
+	// Gemini URL, one with a Gemini proxy available, or one fetched natively
+	// Links without a scheme on non-Gemini pages aren't Gemini links
+	proxied := usingProxy || parsed.Scheme != "gemini"
 
 	// Load page from cache if it exists,
 	// and this isn't a page that was redirected to by the server (indicates dynamic content)
-	if numRedirects == 0 {
+	if offline.Load() {
+		return ret(handleOffline(t, u, proxied))
+	}
+	// Titan URLs upload data, so they're never cached
+	if numRedirects == 0 && parsed.Scheme != "titan" {
 		page, ok := cache.GetPage(u)
 		if ok {
 			setPage(t, page)
 			return ret(u, true)
 		}
+		// Then try the persistent cache
+		if r, ok := cache.GetFreshResponse(u); ok {
+			page, ok = pageFromResponse(u, r, proxied)
+			if ok {
+				go cache.AddPage(page)
+				setPage(t, page)
+				return ret(u, true)
+			}
+		}
 	}
 	// Otherwise download it
 	bottomBar.SetText("Loading...")
@@ -328,26 +419,25 @@ func handleURL(t *tab, u string, numRedirects int) (string, bool) {
 		return ret("", false)
 	}
 
-	if errors.Is(err, client.ErrTofu) {
+	if errors.Is(err, client.ErrTofu) || errors.Is(err, client.ErrNotPinned) {
+		tofuHostname, tofuPort, tofuHost := parsed.Hostname(), parsed.Port(), parsed.Host
 		if usingProxy {
-			// They are using a proxy
-			if Tofu(proxy, client.GetExpiry(proxyHostname, proxyPort)) {
-				// They want to continue anyway
-				client.ResetTofuEntry(proxyHostname, proxyPort, res.Cert)
-				// Response can be used further down, no need to reload
-			} else {
-				// They don't want to continue
-				return ret("", false)
-			}
-		} else {
-			if Tofu(parsed.Host, client.GetExpiry(parsed.Hostname(), parsed.Port())) {
-				// They want to continue anyway
-				client.ResetTofuEntry(parsed.Hostname(), parsed.Port(), res.Cert)
-				// Response can be used further down, no need to reload
-			} else {
-				// They don't want to continue
-				return ret("", false)
-			}
+			tofuHostname, tofuPort, tofuHost = proxyHostname, proxyPort, proxy
+		}
+		switch Tofu(tofuHost, tofuHostname, tofuPort, res.Cert) {
+		case tofuContinue:
+			// They want to continue anyway
+			client.ResetTofuEntry(tofuHostname, tofuPort, res.Cert)
+			// Response can be used further down, no need to reload
+		case tofuOnce:
+			// Continue without saving the cert, so they'll be asked again next time.
+			// It's not kept for about:tofu either, so it can't be trusted later by a link.
+			client.ForgetMismatch(tofuHostname, tofuPort)
+		case tofuView:
+			return ret(handleURL(t, tofuEntryURL(tofuHostname, tofuPort), 0))
+		default:
+			// They don't want to continue
+			return ret("", false)
 		}
 	} else if err != nil {
 		Error("URL Fetch Error", err.Error())
@@ -358,7 +448,7 @@ func handleURL(t *tab, u string, numRedirects int) (string, bool) {
 	res.Body = rr.NewRestartReader(res.Body)
 
 	if renderer.CanDisplay(res) {
-		page, err := renderer.MakePage(u, res, textWidth(), usingProxy)
+		page, err := renderer.MakePage(u, res, textWidth(), proxied)
 		// Rendering may have taken a while, make sure tab is still valid
 		if !isValidTab(t) {
 			return ret("", false)
@@ -367,7 +457,7 @@ func handleURL(t *tab, u string, numRedirects int) (string, bool) {
 		if errors.Is(err, renderer.ErrTooLarge) {
 			// Downloading now
 			// Disable read timeout and go back to start
-			res.SetReadTimeout(0) //nolint: errcheck
+			client.SetReadTimeout(res, 0) //nolint: errcheck
 			res.Body.(*rr.RestartReader).Restart()
 			dlChoice("That page is too large. What would you like to do?", u, res)
 			return ret("", false)
@@ -375,7 +465,7 @@ func handleURL(t *tab, u string, numRedirects int) (string, bool) {
 		if errors.Is(err, renderer.ErrTimedOut) {
 			// Downloading now
 			// Disable read timeout and go back to start
-			res.SetReadTimeout(0) //nolint: errcheck
+			client.SetReadTimeout(res, 0) //nolint: errcheck
 			res.Body.(*rr.RestartReader).Restart()
 			dlChoice("Loading that page timed out. What would you like to do?", u, res)
 			return ret("", false)
@@ -387,11 +477,31 @@ func handleURL(t *tab, u string, numRedirects int) (string, bool) {
 
 		page.TermWidth = termW
 
-		if !client.HasClientCert(parsed.Host, parsed.Path) {
+		if !client.HasClientCert(parsed.Host, parsed.Path) && parsed.Scheme != "titan" {
 			// Don't cache pages with client certs
 			go cache.AddPage(page)
+
+			// Pages with sensitive input in the URL, like passwords, and ones visited
+			// in private mode are never written to disk
+			if cache.DiskEnabled() && !isSensitive(u) && !private.Load() {
+				res.Body.(*rr.RestartReader).Restart()
+				body, err := ioutil.ReadAll(res.Body)
+				if err == nil {
+					go cache.AddResponse(&cache.Response{ //nolint:errcheck
+						URL:     u,
+						Status:  res.Status,
+						Meta:    res.Meta,
+						Body:    body,
+						Fetched: page.MadeAt,
+					})
+				}
+			}
 		}
 
+		if private.Load() {
+			// Pages visited in private mode aren't saved to disk, like sensitive ones
+			markSensitive(u)
+		}
 		setPage(t, page)
 		return ret(u, true)
 	}
@@ -420,6 +530,9 @@ func handleURL(t *tab, u string, numRedirects int) (string, bool) {
 				Error("Input Error", "URL for that input would be too long.")
 				return ret("", false)
 			}
+			if status == 11 {
+				markSensitive(parsed.String())
+			}
 			return ret(handleURL(t, parsed.String(), 0))
 		}
 		return ret("", false)
@@ -432,8 +545,12 @@ func handleURL(t *tab, u string, numRedirects int) (string, bool) {
 		redir := parsed.ResolveReference(parsedMeta).String()
 		justAddsSlash := (redir == u+"/")
 		// Prompt before redirecting to non-Gemini protocol
+		// Redirects within the same protocol, like for Spartan, don't count,
+		// and neither do ones from HTTP to HTTPS
+		sameProtocol := strings.HasPrefix(redir, parsed.Scheme+"://") ||
+			(strings.HasPrefix(u, "http") && strings.HasPrefix(redir, "https://"))
 		redirect := false
-		if !justAddsSlash && !strings.HasPrefix(redir, "gemini") {
+		if !justAddsSlash && !strings.HasPrefix(redir, "gemini") && !sameProtocol {
 			if YesNo("Follow redirect to non-Gemini URL?\n" + redir) {
 				redirect = true
 			} else {
@@ -444,7 +561,10 @@ func handleURL(t *tab, u string, numRedirects int) (string, bool) {
 		autoRedirect := justAddsSlash || viper.GetBool("a-general.auto_redirect")
 		if redirect || (autoRedirect && numRedirects < 5) || YesNo("Follow redirect?\n"+redir) {
 			if status == gemini.StatusRedirectPermanent {
-				go cache.AddRedir(u, redir)
+				// Only kept in memory if it shouldn't be saved to disk
+				temp := private.Load() || isSensitive(u) || isSensitive(redir)
+				go cache.AddRedir(u, redir, res.Status, temp)
+				go updateMovedURL(u, redir)
 			}
 			return ret(handleURL(t, redir, numRedirects+1))
 		}
@@ -479,14 +599,11 @@ func handleURL(t *tab, u string, numRedirects int) (string, bool) {
 	case 59:
 		Error("Bad Request", escapeMeta(res.Meta))
 		return ret("", false)
-	case 60:
-		Error("Client Certificate Required", escapeMeta(res.Meta))
-		return ret("", false)
-	case 61:
-		Error("Certificate Not Authorised", escapeMeta(res.Meta))
-		return ret("", false)
-	case 62:
-		Error("Certificate Not Valid", escapeMeta(res.Meta))
+	case 60, 61, 62:
+		if identityPrompt(parsed, status, res.Meta) {
+			// An identity is now bound to this URL, try again with it
+			return ret(handleURL(t, u, numRedirects))
+		}
 		return ret("", false)
 	default:
 		if !gemini.StatusInRange(status) {
@@ -498,6 +615,10 @@ func handleURL(t *tab, u string, numRedirects int) (string, bool) {
 
 	// Status code 20, but not a document that can be displayed
 
+	// Files from the built-in HTTP client are opened in the browser instead
+	// of being downloaded
+	builtinHTTP := strings.HasPrefix(u, "http") && !usingProxy
+
 	// First see if it's a feed, and ask the user about adding it if it is
 	filename := path.Base(parsed.Path)
 	mediatype, _, _ := mime.ParseMediaType(res.Meta)
@@ -505,10 +626,13 @@ func handleURL(t *tab, u string, numRedirects int) (string, bool) {
 	if ok {
 		go func() {
 			added := addFeedDirect(u, feed, subscriptions.IsSubscribed(u))
-			if !added {
+			if !added && builtinHTTP {
+				res.Body.Close()
+				handleHTTP(u, true)
+			} else if !added {
 				// Otherwise offer download choices
 				// Disable read timeout and go back to start
-				res.SetReadTimeout(0) //nolint: errcheck
+				client.SetReadTimeout(res, 0) //nolint: errcheck
 				res.Body.(*rr.RestartReader).Restart()
 				dlChoice("That file could not be displayed. What would you like to do?", u, res)
 			}
@@ -516,9 +640,15 @@ func handleURL(t *tab, u string, numRedirects int) (string, bool) {
 		return ret("", false)
 	}
 
+	if builtinHTTP {
+		res.Body.Close()
+		handleHTTP(u, true)
+		return ret("", false)
+	}
+
 	// Otherwise offer download choices
 	// Disable read timeout and go back to start
-	res.SetReadTimeout(0) //nolint: errcheck
+	client.SetReadTimeout(res, 0) //nolint: errcheck
 	res.Body.(*rr.RestartReader).Restart()
 	dlChoice("That file could not be displayed. What would you like to do?", u, res)
 	return ret("", false)
@@ -42,6 +42,8 @@ var helpCells = strings.TrimSpace(
 		"%s\tNew tab, or if a link is selected,\n" +
 		"\tthis will open the link in a new tab.\n" +
 		"%s\tClose tab. For now, only the right-most tab can be closed.\n" +
+		"%s\tReopen the last closed tab, with its history.\n" +
+		"\tSee about:closed-tabs for the others.\n" +
 		"%s\tReload a page, discarding the cached version.\n" +
 		"\tThis can also be used if you resize your terminal.\n" +
 		"%s\tView bookmarks\n" +
@@ -53,9 +55,14 @@ var helpCells = strings.TrimSpace(
 		"\t(Default: Alt-Shift-NUMBER)\n" +
 		"%s\tExecute a custom command using the selected URL as an argument.\n" +
 		"\t(Default: Alt-NUMBER)\n" +
-		"%s\tSearch the page content for a string\n" +
+		"%s\tSearch the page content for a string. Press Tab in the\n" +
+		"\tsearch bar to search ignoring case, with a regex, or for whole words.\n" +
 		"%s\tFind next search match\n" +
 		"%s\tFind previous search match\n" +
+		"%s\tTurn offline mode on or off, where pages are only loaded from the cache\n" +
+		"%s\tUpload to the current page with Titan. Pick a local file,\n" +
+		"\tor edit the page with $EDITOR and upload that.\n" +
+		"%s\tTurn private mode on or off, where pages aren't saved to disk\n" +
 		"%s\tQuit\n")
 
 var helpTable = cview.NewTextView()
@@ -115,6 +122,7 @@ func helpInit() {
 		config.GetKeyBinding(config.CmdHome),
 		config.GetKeyBinding(config.CmdNewTab),
 		config.GetKeyBinding(config.CmdCloseTab),
+		config.GetKeyBinding(config.CmdReopenTab),
 		config.GetKeyBinding(config.CmdReload),
 		config.GetKeyBinding(config.CmdBookmarks),
 		config.GetKeyBinding(config.CmdAddBookmark),
@@ -126,6 +134,9 @@ func helpInit() {
 		config.GetKeyBinding(config.CmdSearch),
 		config.GetKeyBinding(config.CmdNextMatch),
 		config.GetKeyBinding(config.CmdPrevMatch),
+		config.GetKeyBinding(config.CmdOffline),
+		config.GetKeyBinding(config.CmdTitan),
+		config.GetKeyBinding(config.CmdPrivate),
 		config.GetKeyBinding(config.CmdQuit),
 	)
 
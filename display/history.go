@@ -28,6 +28,7 @@ func histForward(t *tab) {
 	t.historyCachePage()
 
 	t.history.pos++
+	sessionChanged()
 	go applyHist(t)
 }
 
@@ -41,5 +42,6 @@ func histBack(t *tab) {
 	t.historyCachePage()
 
 	t.history.pos--
+	sessionChanged()
 	go applyHist(t)
 }
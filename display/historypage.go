@@ -0,0 +1,246 @@
+package display
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/makeworld-the-better-one/amfora/history"
+	"github.com/makeworld-the-better-one/amfora/renderer"
+	"github.com/makeworld-the-better-one/amfora/structs"
+	"github.com/spf13/viper"
+)
+
+// private is whether private mode is on, where visited pages aren't added
+// to the history, saved in the session, or written to the disk cache.
+var private atomic.Bool
+
+// Only this many pages are listed on about:history, searching finds the rest.
+const maxHistoryShown = 500
+
+// TogglePrivate turns private mode on or off.
+func TogglePrivate() {
+	if private.Load() {
+		private.Store(false)
+		Info("Private mode is off.")
+		return
+	}
+	private.Store(true)
+	Info("Private mode is on. Pages you visit won't be added to the history, saved in the session, " +
+		"or written to the disk cache.")
+}
+
+// recordVisit adds the page to the history, unless history is disabled or
+// the page shouldn't be recorded.
+func recordVisit(p *structs.Page) {
+	if private.Load() || !viper.GetBool("history.enabled") ||
+		strings.HasPrefix(p.URL, "about:") || !savableURL(p.URL) {
+		return
+	}
+	title := ""
+	if p.Mediatype != structs.Image {
+		if match := topHeadingRegex.FindString(p.Raw); match != "" {
+			title = strings.TrimSpace(match[1:])
+		}
+	}
+	if err := history.Add(p.URL, title); err != nil {
+		Error("History Error", "Error saving history: "+err.Error())
+	}
+}
+
+// historyClearRanges are the ranges of history that can be cleared, and
+// when they start.
+var historyClearRanges = []struct {
+	name  string
+	label string
+	from  func(now time.Time) time.Time
+}{
+	{"hour", "the last hour", func(now time.Time) time.Time { return now.Add(-time.Hour) }},
+	{"today", "today", func(now time.Time) time.Time {
+		y, m, d := now.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	}},
+	{"week", "the last 7 days", func(now time.Time) time.Time { return now.AddDate(0, 0, -7) }},
+	{"all", "everything", func(time.Time) time.Time { return time.Time{} }},
+}
+
+// historyURL returns the URL of about:history, filtered by the query.
+func historyURL(query string) string {
+	if query == "" {
+		return "about:history"
+	}
+	return "about:history?" + url.Values{"query": {query}}.Encode()
+}
+
+// historyActionURL returns the URL of an action on about:history. The query
+// is kept, so the page is still filtered after the action.
+func historyActionURL(query string, v url.Values) string {
+	if query != "" {
+		v.Set("query", query)
+	}
+	return "about:history?" + v.Encode()
+}
+
+// HistoryPage displays the history page in the current tab. `u` is the URL
+// entered by the user, and it may have a query string with a search or an
+// action. It returns the URL to add to history, and whether to add it.
+func HistoryPage(t *tab, u string) (string, bool) {
+	if len(u) <= 14 || u[:14] != "about:history?" {
+		renderHistoryPage(t, "")
+		return u, true
+	}
+
+	q, err := url.ParseQuery(u[14:])
+	if err != nil {
+		Error("URL Error", "Invalid query string: "+err.Error())
+		return "", false
+	}
+	query := q.Get("query")
+
+	switch q.Get("action") {
+	case "":
+		renderHistoryPage(t, query)
+		return historyURL(query), true
+	case "search":
+		newQuery, ok := Input("Search the history for pages with a URL or title containing:", false)
+		newQuery = strings.TrimSpace(newQuery)
+		if !ok || newQuery == "" {
+			return "", false
+		}
+		renderHistoryPage(t, newQuery)
+		return historyURL(newQuery), true
+	case "delete":
+		if err := history.Delete(q.Get("url")); err != nil {
+			Error("History Error", "Error saving history: "+err.Error())
+			return "", false
+		}
+	case "clear":
+		now := time.Now()
+		var from, to time.Time
+		var label string
+		if day := q.Get("day"); day != "" {
+			from, err = time.ParseInLocation("2006-01-02", day, time.Local)
+			if err != nil {
+				Error("URL Error", "Invalid day to clear.")
+				return "", false
+			}
+			to = from.AddDate(0, 0, 1)
+			label = "the history from " + from.Format("January 2, 2006")
+		} else {
+			for _, r := range historyClearRanges {
+				if r.name == q.Get("range") {
+					from = r.from(now)
+					label = "the history from " + r.label
+					if r.name == "all" {
+						label = "all the history"
+					}
+				}
+			}
+			if label == "" {
+				Error("URL Error", "Unknown range of history to clear.")
+				return "", false
+			}
+		}
+		if !YesNo("Clear " + label + "?") {
+			return "", false
+		}
+		if err := history.Clear(from, to); err != nil {
+			Error("History Error", "Error saving history: "+err.Error())
+			return "", false
+		}
+	default:
+		Error("URL Error", "Unknown history action.")
+		return "", false
+	}
+	renderHistoryPage(t, query) // Reload
+	return "", false
+}
+
+// historyDay returns the heading for the day of a visit.
+func historyDay(v, now time.Time) string {
+	vy, vm, vd := v.Date()
+	ny, nm, nd := now.Date()
+	if vy == ny && vm == nm && vd == nd {
+		return "Today"
+	}
+	yy, ym, yd := now.AddDate(0, 0, -1).Date()
+	if vy == yy && vm == ym && vd == yd {
+		return "Yesterday"
+	}
+	return v.Format("Monday, January 2, 2006")
+}
+
+func renderHistoryPage(t *tab, query string) {
+	rawPage := "# History\n\n" +
+		"Pages you visit in any tab are recorded here, along with their first heading. " +
+		"They are grouped by the day they were last visited.\n\n"
+	switch {
+	case private.Load():
+		rawPage += "Private mode is on, so pages aren't being recorded.\n\n"
+	case !viper.GetBool("history.enabled"):
+		rawPage += "Pages aren't being recorded, because history is disabled in the config.\n\n"
+	}
+
+	rawPage += "=> about:history?" + url.Values{"action": {"search"}}.Encode() + " Search the history\n"
+	if query != "" {
+		rawPage += "=> about:history Show all pages\n"
+	}
+	rawPage += "\n"
+	for _, r := range historyClearRanges {
+		rawPage += "=> " + historyActionURL(query, url.Values{"action": {"clear"}, "range": {r.name}}) +
+			" Clear " + r.label + "\n"
+	}
+
+	entries := history.Search(query)
+	if query != "" {
+		if len(entries) == 1 {
+			rawPage += fmt.Sprintf("\n1 page matches \"%s\".\n", query)
+		} else {
+			rawPage += fmt.Sprintf("\n%d pages match \"%s\".\n", len(entries), query)
+		}
+	}
+	if len(entries) == 0 && query == "" {
+		rawPage += "\nNo pages have been recorded.\n"
+	}
+	if len(entries) > maxHistoryShown {
+		rawPage += fmt.Sprintf("\nOnly the %d most recent are shown, search to find older pages.\n", maxHistoryShown)
+		entries = entries[:maxHistoryShown]
+	}
+
+	now := time.Now()
+	day := ""
+	for _, e := range entries {
+		last := e.Last().Local()
+		if d := historyDay(last, now); d != day {
+			day = d
+			rawPage += "\n## " + day + "\n"
+			rawPage += "=> " + historyActionURL(query, url.Values{"action": {"clear"}, "day": {last.Format("2006-01-02")}}) +
+				" Clear this day\n\n"
+		}
+		name := e.Title
+		if name == "" {
+			name = e.URL
+		}
+		times := "once"
+		if e.Count > 1 {
+			times = fmt.Sprintf("%d times", e.Count)
+		}
+		rawPage += "=> " + e.URL + " " + name + "\n" +
+			"Visited " + times + ", last at " + last.Format("15:04") + "\n" +
+			"=> " + historyActionURL(query, url.Values{"action": {"delete"}, "url": {e.URL}}) + " Delete\n\n"
+	}
+
+	content, links := renderer.RenderGemini(rawPage, textWidth(), false)
+	page := structs.Page{
+		Raw:       rawPage,
+		Content:   content,
+		Links:     links,
+		URL:       historyURL(query),
+		TermWidth: termW,
+		Mediatype: structs.TextGemini,
+	}
+	setPage(t, &page)
+	t.applyBottomBar()
+}
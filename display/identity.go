@@ -0,0 +1,330 @@
+package display
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+
+	"code.rocketnine.space/tslocum/cview"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/gdamore/tcell/v2"
+	"github.com/makeworld-the-better-one/amfora/client"
+	"github.com/makeworld-the-better-one/amfora/config"
+	"github.com/makeworld-the-better-one/amfora/renderer"
+	"github.com/makeworld-the-better-one/amfora/structs"
+	"github.com/spf13/viper"
+)
+
+// For picking or creating a client certificate identity when a server asks
+// for one. It is a clone of the bookmark modal, with more form items.
+var identityModal = cview.NewModal()
+
+// identityCh is for whether the user chose to use an identity
+var identityCh = make(chan bool)
+
+const newIdentityOption = "New identity"
+
+func identityInit() {
+	panels.AddPanel(PanelIdentityModal, identityModal, false, false)
+
+	m := identityModal
+	if viper.GetBool("a-general.color") {
+		m.SetBackgroundColor(config.GetColor("input_modal_bg"))
+		m.SetButtonBackgroundColor(config.GetColor("btn_bg"))
+		m.SetButtonTextColor(config.GetColor("btn_text"))
+		m.SetTextColor(config.GetColor("input_modal_text"))
+		form := m.GetForm()
+		form.SetLabelColor(config.GetColor("input_modal_text"))
+		form.SetFieldBackgroundColor(config.GetColor("input_modal_field_bg"))
+		form.SetFieldTextColor(config.GetColor("input_modal_field_text"))
+		form.SetFieldBackgroundColorFocused(config.GetColor("input_modal_field_text"))
+		form.SetFieldTextColorFocused(config.GetTextColor("input_modal_field_bg", "input_modal_field_text"))
+		form.SetButtonBackgroundColorFocused(config.GetColor("btn_text"))
+		form.SetButtonTextColorFocused(config.GetTextColor("btn_bg", "btn_text"))
+		frame := m.GetFrame()
+		frame.SetBorderColor(config.GetColor("input_modal_text"))
+		frame.SetTitleColor(config.GetColor("input_modal_text"))
+	} else {
+		m.SetBackgroundColor(tcell.ColorBlack)
+		m.SetButtonBackgroundColor(tcell.ColorWhite)
+		m.SetButtonTextColor(tcell.ColorBlack)
+		m.SetTextColor(tcell.ColorWhite)
+		form := m.GetForm()
+		form.SetLabelColor(tcell.ColorWhite)
+		form.SetFieldBackgroundColor(tcell.ColorWhite)
+		form.SetFieldTextColor(tcell.ColorBlack)
+		form.SetButtonBackgroundColorFocused(tcell.ColorBlack)
+		form.SetButtonTextColorFocused(tcell.ColorWhite)
+		frame := m.GetFrame()
+		frame.SetBorderColor(tcell.ColorWhite)
+		frame.SetTitleColor(tcell.ColorWhite)
+	}
+
+	m.SetBorder(true)
+	frame := m.GetFrame()
+	frame.SetTitleAlign(cview.AlignCenter)
+	frame.SetTitle(" Client Certificate ")
+	m.SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+		identityCh <- buttonLabel == "Use"
+	})
+}
+
+// openIdentityModal displays the identity modal with the provided text.
+// The host and path are used to describe the scope choices.
+//
+// It returns the chosen identity name, whether it is a new identity that
+// needs to be created, whether the whole host should be used as the scope
+// instead of the path, and whether the user chose to continue at all.
+func openIdentityModal(text, host, path string) (string, bool, bool, bool) {
+	// Reset buttons before form items, to make sure the form is in focus
+	identityModal.ClearButtons()
+	identityModal.AddButtons([]string{"Use", "Cancel"})
+	identityModal.SetText(text)
+
+	form := identityModal.GetForm()
+	form.Clear(false)
+
+	names := client.IdentityNames()
+	chosen := newIdentityOption
+	form.AddDropDownSimple("Identity: ", 0,
+		func(index int, option *cview.DropDownOption) {
+			chosen = option.GetText()
+		},
+		append([]string{newIdentityOption}, names...)...,
+	)
+	newName := host
+	form.AddInputField("New name: ", newName, 0, nil,
+		func(text string) {
+			newName = text
+		})
+	wholeHost := false
+	form.AddDropDownSimple("Use for: ", 0,
+		func(index int, option *cview.DropDownOption) {
+			wholeHost = index == 1
+		},
+		cview.Escape(path)+" and below",
+		"All of "+cview.Escape(host),
+	)
+
+	panels.ShowPanel(PanelIdentityModal)
+	panels.SendToFront(PanelIdentityModal)
+	App.SetFocus(identityModal)
+	App.Draw()
+
+	ok := <-identityCh
+	panels.HidePanel(PanelIdentityModal)
+	App.SetFocus(tabs[curTab].view)
+	App.Draw()
+
+	if chosen == newIdentityOption {
+		return newName, true, wholeHost, ok
+	}
+	return chosen, false, wholeHost, ok
+}
+
+// identityPrompt handles the client certificate statuses (60, 61, 62) by
+// letting the user pick or create an identity and binding it to the URL.
+// It returns true if an identity was bound and the request should be retried.
+func identityPrompt(parsed *url.URL, status int, meta string) bool {
+	var text string
+	switch status {
+	case 60:
+		text = fmt.Sprintf("%s requires a client certificate", cview.Escape(parsed.Host))
+	case 61:
+		text = fmt.Sprintf("The certificate sent to %s was not authorised", cview.Escape(parsed.Host))
+	default:
+		text = fmt.Sprintf("The certificate sent to %s was not valid", cview.Escape(parsed.Host))
+	}
+	if meta != "" {
+		text += ": " + escapeMeta(meta)
+	}
+	text += "\n\nChoose an identity to use, or create a new one."
+
+	name, isNew, wholeHost, ok := openIdentityModal(text, parsed.Hostname(), parsed.Path)
+	if !ok {
+		return false
+	}
+	if isNew {
+		if err := client.NewIdentity(name); err != nil {
+			Error("Identity Error", "Error creating identity: "+err.Error())
+			return false
+		}
+	}
+
+	scope := *parsed
+	scope.RawQuery = ""
+	if wholeHost {
+		scope.Path = "/"
+		scope.RawPath = ""
+	}
+	if err := client.BindIdentity(name, scope.String()); err != nil {
+		Error("Identity Error", "Error saving identity: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// Identities displays the identities page in the current tab. `u` is the
+// URL entered by the user, and it may have a query string with an action.
+func Identities(t *tab, u string) {
+	if len(u) > 17 && u[:17] == "about:identities?" {
+		identitiesQuery(t, u[17:])
+		return
+	}
+
+	rawPage := "# Identities\n\n" +
+		"Identities are client certificates, which are sent to the URLs they are used for, " +
+		"and everything below those URLs. The most specific URL wins when more than one matches.\n\n" +
+		"=> about:identities?" + url.Values{"action": {"check"}}.Encode() + " Which identity is used for a URL?\n"
+
+	infos := client.Identities()
+	if len(infos) == 0 {
+		rawPage += "\nThere are no identities. You can create one when a site asks for a client certificate.\n"
+	}
+	configHeader := false
+	for _, info := range infos {
+		if info.FromConfig && !configHeader {
+			rawPage += "\n## From config\n\nThese can only be changed by editing the [auth] section of the config file.\n"
+			configHeader = true
+		}
+
+		rawPage += "\n### " + info.Name + "\n\n"
+		if info.Err != nil {
+			rawPage += "Error reading certificate: " + info.Err.Error() + "\n"
+		} else {
+			rawPage += "* Subject: " + info.Subject + "\n"
+			if info.Issuer != info.Subject {
+				rawPage += "* Issuer: " + info.Issuer + "\n"
+			}
+			rawPage += "* Fingerprint: " + info.Fingerprint + "\n"
+			rawPage += fmt.Sprintf("* Expires: %s (%s)\n",
+				info.NotAfter.Local().Format("Jan 02, 2006"), humanize.Time(info.NotAfter))
+		}
+		if !info.Created.IsZero() {
+			rawPage += "* Created: " + info.Created.Local().Format("Jan 02, 2006") + "\n"
+		}
+
+		if len(info.Scopes) == 0 {
+			rawPage += "\nNot used for any URLs.\n"
+		} else {
+			rawPage += "\nUsed for:\n"
+		}
+		for _, scope := range info.Scopes {
+			if info.FromConfig {
+				rawPage += "=> " + scope + "\n"
+			} else {
+				rawPage += "=> about:identities?" +
+					url.Values{"action": {"unbind"}, "name": {info.Name}, "scope": {scope}}.Encode() +
+					" Stop using for " + scope + "\n"
+			}
+		}
+
+		if !info.FromConfig {
+			q := url.Values{"name": {info.Name}}
+			q.Set("action", "rename")
+			rawPage += "\n=> about:identities?" + q.Encode() + " Rename identity\n"
+			q.Set("action", "export")
+			rawPage += "=> about:identities?" + q.Encode() + " Export cert and key\n"
+			q.Set("action", "delete")
+			rawPage += "=> about:identities?" + q.Encode() + " Delete identity\n"
+		}
+	}
+
+	content, links := renderer.RenderGemini(rawPage, textWidth(), false)
+	page := structs.Page{
+		Raw:       rawPage,
+		Content:   content,
+		Links:     links,
+		URL:       "about:identities",
+		TermWidth: termW,
+		Mediatype: structs.TextGemini,
+	}
+	setPage(t, &page)
+	t.applyBottomBar()
+}
+
+// identitiesQuery performs the action in the query string of an
+// about:identities URL, then reloads the page.
+func identitiesQuery(t *tab, query string) {
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		Error("URL Error", "Invalid query string: "+err.Error())
+		return
+	}
+	name := q.Get("name")
+
+	switch q.Get("action") {
+	case "check":
+		u, ok := Input("Enter a URL to see which identity is used for it:", false)
+		if !ok {
+			return
+		}
+		id, fromConfig := client.IdentityForURL(u)
+		switch {
+		case id == "":
+			Info("No identity is used for that URL.")
+		case fromConfig:
+			Info("The certificate at " + cview.Escape(id) + " is used for that URL, as set in the config.")
+		default:
+			Info("The identity " + cview.Escape(id) + " is used for that URL.")
+		}
+		return
+	case "unbind":
+		if !YesNo("Stop using the identity " + cview.Escape(name) + " for " + cview.Escape(q.Get("scope")) + "?") {
+			return
+		}
+		err = client.UnbindIdentity(name, q.Get("scope"))
+		Identities(t, "about:identities") // Reload
+		if err != nil {
+			Error("Identity Error", "Error saving identity: "+err.Error())
+		}
+	case "delete":
+		if !YesNo("Delete the identity " + cview.Escape(name) + "? This cannot be undone, " +
+			"and sites that know you by it will no longer recognize you.") {
+			return
+		}
+		err = client.DeleteIdentity(name)
+		Identities(t, "about:identities") // Reload
+		if err != nil {
+			Error("Identity Error", "Error deleting identity: "+err.Error())
+			return
+		}
+		Info("Deleted identity " + cview.Escape(name))
+	case "rename":
+		newName, ok := Input("Enter a new name for the identity "+cview.Escape(name)+":", false)
+		if !ok {
+			return
+		}
+		err = client.RenameIdentity(name, newName)
+		Identities(t, "about:identities") // Reload
+		if err != nil {
+			Error("Identity Error", "Error renaming identity: "+err.Error())
+		}
+	case "export":
+		if !YesNo("Export the cert and private key of the identity " + cview.Escape(name) +
+			" to your downloads folder? Anyone with the file can use this identity.") {
+			return
+		}
+		pemBytes, err := client.IdentityPEM(name)
+		if err != nil {
+			Error("Identity Error", "Error reading identity: "+err.Error())
+			return
+		}
+		savePath, err := getSafeDownloadName(config.DownloadsDir, name+".pem", true, 0)
+		if err != nil {
+			Error("Identity Error", "Error deciding on file name: "+err.Error())
+			return
+		}
+		savePath = filepath.Join(config.DownloadsDir, savePath)
+		// Private key, so only the user should be able to read it
+		err = ioutil.WriteFile(savePath, pemBytes, 0600)
+		if err != nil {
+			Error("Identity Error", "Error saving identity: "+err.Error())
+			return
+		}
+		Info("Identity cert and key exported to " + cview.Escape(savePath) + ". Keep this file private.")
+	default:
+		Error("URL Error", "Unknown identities action.")
+	}
+}
@@ -0,0 +1,185 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/makeworld-the-better-one/amfora/renderer"
+	"github.com/makeworld-the-better-one/amfora/structs"
+)
+
+// Drawing inline images with sixel or the kitty graphics protocol. The page
+// has blank lines where the image goes, and after the screen is drawn the
+// image is written to the terminal over them. It is only drawn when the top
+// of the page is showing and nothing is in front of it.
+
+// imageState describes where an image was drawn, so it's only drawn again
+// when something changes.
+type imageState struct {
+	page          *structs.Page
+	mode          string
+	textWidth     int
+	x, y          int
+	width, height int
+}
+
+// The cell size in pixels that's assumed if the terminal doesn't report it.
+const (
+	defaultCellWidth  = 10
+	defaultCellHeight = 20
+)
+
+var drawnImage imageState // Zero if no image is drawn
+
+// Images are decoded and encoded in the background, so large images don't
+// block the UI. These are protected by graphicsMu.
+var graphicsMu sync.Mutex
+var graphicsState imageState // What graphicsData was made for
+var graphicsData []byte      // Nil if it's not ready, or it couldn't be made
+
+// graphicsOut is where graphics are written, the terminal if possible.
+var graphicsOut io.Writer
+
+func graphicsInit() {
+	if tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+		graphicsOut = tty
+	} else {
+		graphicsOut = os.Stdout
+	}
+	App.SetAfterDrawFunc(drawGraphics)
+}
+
+// drawGraphics is run after each draw, to draw the current page's image
+// or remove an old one.
+func drawGraphics(screen tcell.Screen) {
+	mode := renderer.ImageMode()
+	if mode != renderer.ImagesSixel && mode != renderer.ImagesKitty {
+		return
+	}
+
+	if len(tabs) == 0 {
+		return
+	}
+
+	var state imageState
+	t := tabs[curTab]
+	front, _ := panels.GetFrontPanel()
+	row, _ := t.view.GetScrollOffset()
+	if t.page != nil && t.page.Mediatype == structs.Image && front == PanelBrowser && row == 0 {
+		state.page = t.page
+		state.mode = mode
+		state.textWidth = textWidth()
+		state.x, state.y, state.width, state.height = t.view.GetInnerRect()
+	}
+	if state == drawnImage {
+		return
+	}
+
+	if drawnImage.page != nil {
+		// Remove the old image
+		if mode == renderer.ImagesKitty {
+			io.WriteString(graphicsOut, renderer.KittyDeleteAll) //nolint:errcheck
+		} else {
+			// Sixel images are only removed when the cells under them are drawn again
+			screen.Sync()
+		}
+	}
+	drawnImage = imageState{}
+	if state.page == nil {
+		return
+	}
+
+	data := graphicsFor(state)
+	if data == nil {
+		// It's drawn after it's ready
+		return
+	}
+
+	// The screen must be up to date before drawing over it
+	screen.Show()
+
+	var buf bytes.Buffer
+	// Save and restore the cursor position, because tcell assumes it doesn't move
+	buf.WriteString("\x1b7")
+	fmt.Fprintf(&buf, "\x1b[%d;%dH", state.y+1, state.x+1)
+	buf.Write(data)
+	buf.WriteString("\x1b8")
+	graphicsOut.Write(buf.Bytes()) //nolint:errcheck
+	drawnImage = state
+}
+
+// graphicsFor returns the encoded image for the state, or nil if it's not
+// ready yet. If it's not, it's made in the background and the screen is
+// drawn again once it's done.
+func graphicsFor(state imageState) []byte {
+	graphicsMu.Lock()
+	defer graphicsMu.Unlock()
+
+	if graphicsState == state {
+		return graphicsData
+	}
+	graphicsState = state
+	graphicsData = nil
+
+	go func() {
+		data := encodeGraphics(state)
+		if data == nil {
+			return
+		}
+		graphicsMu.Lock()
+		if graphicsState != state {
+			// Something changed while it was being made
+			graphicsMu.Unlock()
+			return
+		}
+		graphicsData = data
+		graphicsMu.Unlock()
+		App.Draw()
+	}()
+	return nil
+}
+
+// encodeGraphics decodes the page's image, and encodes it to fit in the view
+// using the terminal graphics protocol. It returns nil if that fails.
+func encodeGraphics(state imageState) []byte {
+	img, err := renderer.DecodeImage(state.page.Raw)
+	if err != nil {
+		return nil
+	}
+
+	// Fit the image in the view
+	cols, rows := renderer.ImageSize(img, state.textWidth)
+	if cols > state.width {
+		rows = rows * state.width / cols
+		cols = state.width
+	}
+	if rows > state.height {
+		cols = cols * state.height / rows
+		rows = state.height
+	}
+	if cols < 1 || rows < 1 {
+		return nil
+	}
+
+	if state.mode == renderer.ImagesKitty {
+		// Only the columns are given, so the terminal keeps the aspect ratio
+		data, err := renderer.EncodeKitty(img, cols, 0)
+		if err != nil {
+			return nil
+		}
+		return data
+	}
+	cellW, cellH := cellSize()
+	b := img.Bounds()
+	w := cols * cellW
+	h := b.Dy() * w / b.Dx()
+	if h > rows*cellH {
+		h = rows * cellH
+		w = b.Dx() * h / b.Dy()
+	}
+	return renderer.EncodeSixel(img, w, h)
+}
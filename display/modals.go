@@ -1,19 +1,16 @@
 package display
 
 import (
-	"fmt"
 	"strings"
-	"time"
 
 	"code.rocketnine.space/tslocum/cview"
-	humanize "github.com/dustin/go-humanize"
 	"github.com/gdamore/tcell/v2"
 	"github.com/makeworld-the-better-one/amfora/config"
 	"github.com/spf13/viper"
 )
 
 // This file contains code for the popups / modals used in the display.
-// The bookmark modal is in bookmarks.go
+// The bookmark modal is in bookmarks.go, and the TOFU modal is in tofu.go
 
 var infoModal = cview.NewModal()
 var errorModal = cview.NewModal()
@@ -179,6 +176,8 @@ func modalInit() {
 
 	bkmkInit()
 	dlInit()
+	identityInit()
+	tofuInit()
 }
 
 // Error displays an error on the screen in a modal, and blocks until dismissed by the user.
@@ -287,41 +286,3 @@ func YesNo(prompt string) bool {
 	App.Draw()
 	return resp
 }
-
-// Tofu displays the TOFU warning modal.
-// It blocks then returns a bool indicating whether the user wants to continue.
-func Tofu(host string, expiry time.Time) bool {
-	// Reuses yesNoModal, with error color
-
-	m := yesNoModal
-	frame := yesNoModal.GetFrame()
-	if viper.GetBool("a-general.color") {
-		m.SetBackgroundColor(config.GetColor("tofu_modal_bg"))
-		m.SetTextColor(config.GetColor("tofu_modal_text"))
-		frame.SetBorderColor(config.GetColor("tofu_modal_text"))
-		frame.SetTitleColor(config.GetColor("tofu_modal_text"))
-	} else {
-		m.SetBackgroundColor(tcell.ColorBlack)
-		m.SetTextColor(tcell.ColorWhite)
-		m.SetBorderColor(tcell.ColorWhite)
-		m.SetTitleColor(tcell.ColorWhite)
-	}
-	frame.SetTitle(" TOFU ")
-	m.SetText(
-		//nolint:lll
-		fmt.Sprintf("%s's certificate has changed, possibly indicating a security issue. The certificate would have expired %s. Are you sure you want to continue? ",
-			host,
-			humanize.Time(expiry),
-		),
-	)
-	panels.ShowPanel(PanelYesNoModal)
-	panels.SendToFront(PanelYesNoModal)
-	App.SetFocus(yesNoModal)
-	App.Draw()
-
-	resp := <-yesNoCh
-	panels.HidePanel(PanelYesNoModal)
-	App.SetFocus(tabs[curTab].view)
-	App.Draw()
-	return resp
-}
@@ -0,0 +1,80 @@
+package display
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync/atomic"
+
+	"github.com/makeworld-the-better-one/amfora/cache"
+	"github.com/makeworld-the-better-one/amfora/renderer"
+	"github.com/makeworld-the-better-one/amfora/structs"
+	"github.com/makeworld-the-better-one/go-gemini"
+)
+
+// offline is whether offline mode is on, where pages are only loaded from the cache.
+var offline atomic.Bool
+
+// ToggleOffline turns offline mode on or off.
+func ToggleOffline() {
+	if offline.Load() {
+		offline.Store(false)
+		Info("Offline mode is off.")
+		return
+	}
+	offline.Store(true)
+	if cache.DiskEnabled() {
+		Info("Offline mode is on. Only pages in the cache will be loaded.")
+	} else {
+		Info("Offline mode is on. Only pages in the cache will be loaded, " +
+			"and they will be lost on restart, because the persistent cache is disabled. " +
+			"Set persist to true in the [cache] section of the config to enable it.")
+	}
+}
+
+// pageFromResponse renders a response from the persistent cache.
+func pageFromResponse(u string, r *cache.Response, proxied bool) (*structs.Page, bool) {
+	res := &gemini.Response{
+		Status: r.Status,
+		Meta:   r.Meta,
+		Body:   ioutil.NopCloser(bytes.NewReader(r.Body)),
+	}
+	page, err := renderer.MakePage(u, res, textWidth(), proxied)
+	if err != nil {
+		return nil, false
+	}
+	page.MadeAt = r.Fetched
+	page.TermWidth = termW
+	return page, true
+}
+
+// handleOffline loads the URL from the cache for offline mode.
+// It returns the same values as handleURL.
+func handleOffline(t *tab, u string, proxied bool) (string, bool) {
+	var page *structs.Page
+	if p, ok := cache.GetPage(u); ok {
+		// Copy so the cached page doesn't get the banner
+		temp := *p
+		page = &temp
+	} else if r, ok := cache.GetResponse(u); ok {
+		page, ok = pageFromResponse(u, r, proxied)
+		if !ok {
+			Error("Offline", "The cached version of that page couldn't be displayed.")
+			return "", false
+		}
+	} else {
+		Error("Offline", "That page isn't cached, so it can't be loaded while offline.")
+		return "", false
+	}
+
+	page.CachedAt = page.MadeAt
+	page.TermWidth = -1 // Force reformatting, to add the banner
+	setPage(t, page)
+	return u, true
+}
+
+// offlineBanner returns the rendered banner shown above pages in offline mode.
+func offlineBanner(p *structs.Page) string {
+	text := "> Offline, cached at " + p.CachedAt.Local().Format("Jan 02, 2006 15:04") + "\n"
+	rendered, _ := renderer.RenderGemini(text, textWidth(), false)
+	return rendered + "\n"
+}
@@ -0,0 +1,334 @@
+package display
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/makeworld-the-better-one/amfora/renderer"
+	"github.com/makeworld-the-better-one/amfora/structs"
+	"github.com/spf13/viper"
+)
+
+// Searching the text of the current page, with the search keybinding.
+// The page's Raw text is searched, so link URLs can be found too. The
+// renderer records where each rendered line came from, which is used to
+// find where each match is shown, and the matches are highlighted by adding
+// regions to the tagged text. Matches that aren't shown, like link URLs,
+// highlight the text shown for their line.
+//
+// Pages converted to text/gemini, like Markdown, are searched after they're
+// converted. Pages that aren't rendered from text are searched as they're
+// shown.
+
+// searchKind is how the text typed into the search bar is matched.
+type searchKind int
+
+const (
+	searchLiteral searchKind = iota
+	searchIgnoreCase
+	searchRegex
+	searchWholeWord
+)
+
+// searchKindNames are the names of each searchKind, as used in the config.
+var searchKindNames = []string{"literal", "case-insensitive", "regex", "whole-word"}
+
+// searchKindPrefixes can be typed before a search to use that kind of
+// search, no matter which one is picked.
+var searchKindPrefixes = []string{"l:", "i:", "r:", "w:"}
+
+// curSearchKind is the kind of search that's picked, it's changed by
+// pressing Tab in the search bar.
+var curSearchKind searchKind
+
+// searchKindInit sets the kind of search from the config.
+func searchKindInit() {
+	mode := strings.ToLower(viper.GetString("a-general.search_mode"))
+	for i, name := range searchKindNames {
+		if name == mode {
+			curSearchKind = searchKind(i)
+			return
+		}
+	}
+	curSearchKind = searchLiteral
+}
+
+// nextSearchKind picks the next kind of search, or the previous one if back
+// is true, and updates the search bar.
+func nextSearchKind(back bool) {
+	n := len(searchKindNames)
+	if back {
+		curSearchKind = searchKind((int(curSearchKind) - 1 + n) % n)
+	} else {
+		curSearchKind = searchKind((int(curSearchKind) + 1) % n)
+	}
+	bottomBar.SetLabel(searchLabel())
+}
+
+// searchLabel returns the label of the search bar.
+func searchLabel() string {
+	return "[::b]Search (" + searchKindNames[curSearchKind] + ", Tab to change): [::-]"
+}
+
+// searchRegexp returns the regex for what was typed in the search bar.
+// A prefix like "r:" at the start overrides the picked kind of search.
+// Spaces in searches that aren't regex match any whitespace, so words
+// are found even if the line is wrapped between them.
+func searchRegexp(input string) (*regexp.Regexp, searchKind, error) {
+	kind := curSearchKind
+	for i, prefix := range searchKindPrefixes {
+		if strings.HasPrefix(input, prefix) && len(input) > len(prefix) {
+			kind = searchKind(i)
+			input = input[len(prefix):]
+			break
+		}
+	}
+
+	if kind == searchRegex {
+		re, err := regexp.Compile(input)
+		return re, kind, err
+	}
+	words := strings.Fields(input)
+	for i := range words {
+		words[i] = regexp.QuoteMeta(words[i])
+	}
+	pattern := strings.Join(words, `\s+`)
+	if kind != searchLiteral {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	return re, kind, err
+}
+
+// isWordRune returns whether r is part of a word, for whole-word searches.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// findMatches returns the start and end of each match in text. Empty
+// matches are skipped.
+func findMatches(re *regexp.Regexp, kind searchKind, text string) [][]int {
+	found := make([][]int, 0)
+	for _, m := range re.FindAllStringIndex(text, -1) {
+		if m[0] == m[1] {
+			continue
+		}
+		if kind == searchWholeWord {
+			before, _ := utf8.DecodeLastRuneInString(text[:m[0]])
+			after, _ := utf8.DecodeRuneInString(text[m[1]:])
+			if (m[0] > 0 && isWordRune(before)) || (m[1] < len(text) && isWordRune(after)) {
+				continue
+			}
+		}
+		found = append(found, m)
+	}
+	return found
+}
+
+// pageSource returns the text the page was rendered from, and where each
+// line of its content came from. skip is the number of lines of content
+// before those, like the offline banner. ok is false if the page isn't
+// rendered from text.
+func pageSource(p *structs.Page) (src string, sources []renderer.LineSource, skip int, ok bool) {
+	switch p.Mediatype {
+	case structs.TextGemini:
+		src = p.Raw
+		sources = renderer.GeminiSources(src, textWidth(), pageProxied(p), strings.HasPrefix(p.URL, "spartan://"))
+	case structs.TextMarkdown, structs.TextCSV, structs.TextTSV, structs.TextGophermap, structs.TextHTML:
+		src = renderer.ToGemini(p.Mediatype, p.Raw)
+		sources = renderer.GeminiSources(src, textWidth(), pageProxied(p), false)
+	case structs.TextPlain, structs.TextAnsi:
+		src = p.Raw
+		if p.Mediatype == structs.TextAnsi {
+			src = renderer.StripANSI(src)
+		}
+		// Each line is shown as it is
+		sources = make([]renderer.LineSource, strings.Count(src, "\n")+1)
+		for i := range sources {
+			sources[i].Line = i
+		}
+	default:
+		return "", nil, 0, false
+	}
+	if !p.CachedAt.IsZero() {
+		skip = strings.Count(offlineBanner(p), "\n")
+	}
+	return src, sources, skip, true
+}
+
+// sourcePositions returns where each byte of src is in text, the text that
+// is shown for the page. Bytes that aren't shown, like link URLs, are -1.
+// It also returns the start and end in text of the shown lines of each
+// source line, or -1 if the line isn't shown.
+//
+// The shown lines are lined up with their source lines by finding each
+// character shown after the prefix in the source, in order, so characters
+// the renderer adds after the source text, like link URLs with show_link,
+// are skipped.
+func sourcePositions(src string, sources []renderer.LineSource, skip int, text string) ([]int, [][2]int) {
+	pos := make([]int, len(src))
+	for i := range pos {
+		pos[i] = -1
+	}
+	lineStarts := []int{0} // Where each source line starts
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	shownLines := make([][2]int, len(lineStarts))
+	for i := range shownLines {
+		shownLines[i] = [2]int{-1, -1}
+	}
+
+	prevLine := -1
+	cur := 0 // Where to look next in the current source line
+	shownStart := 0
+	for i, shown := range strings.Split(text, "\n") {
+		start := shownStart
+		shownStart += len(shown) + 1
+
+		if i < skip || i-skip >= len(sources) {
+			continue
+		}
+		ls := sources[i-skip]
+		if ls.Line >= len(lineStarts) || ls.Prefix > len(shown) {
+			continue
+		}
+		line := src[lineStarts[ls.Line]:]
+		if end := strings.IndexByte(line, '\n'); end >= 0 {
+			line = line[:end]
+		}
+		if ls.Line != prevLine {
+			prevLine = ls.Line
+			cur = ls.Start
+		}
+
+		shown = strings.TrimSuffix(shown, "\r")
+		if shownLines[ls.Line][0] < 0 {
+			shownLines[ls.Line][0] = start
+		}
+		shownLines[ls.Line][1] = start + len(shown)
+		for j, r := range shown[ls.Prefix:] {
+			if cur > len(line) {
+				break
+			}
+			k := strings.IndexRune(line[cur:], r)
+			if k < 0 {
+				continue
+			}
+			k += cur
+			_, n := utf8.DecodeRuneInString(shown[ls.Prefix+j:])
+			for b := 0; b < n; b++ {
+				pos[lineStarts[ls.Line]+k+b] = start + ls.Prefix + j + b
+			}
+			cur = k + n
+		}
+	}
+	return pos, shownLines
+}
+
+// shownSpan returns the start and end in the shown text of the bytes of src
+// from start to end that are shown, and false if none are.
+func shownSpan(pos []int, start, end int) (int, int, bool) {
+	first, last := -1, -1
+	for i := start; i < end; i++ {
+		if pos[i] < 0 {
+			continue
+		}
+		if first < 0 {
+			first = pos[i]
+		}
+		last = pos[i]
+	}
+	return first, last + 1, first >= 0
+}
+
+// sourceMatches returns the start and end in text of each match in src. See
+// pageSource and sourcePositions for the other arguments.
+func sourceMatches(re *regexp.Regexp, kind searchKind, src string,
+	sources []renderer.LineSource, skip int, text string) [][]int {
+
+	pos, shownLines := sourcePositions(src, sources, skip, text)
+	found := make([][]int, 0)
+	for _, m := range findMatches(re, kind, src) {
+		start, end, ok := shownSpan(pos, m[0], m[1])
+		if ok {
+			found = append(found, []int{start, end})
+			continue
+		}
+
+		// Nothing in the match is shown where it is in the source. It can be
+		// shown somewhere else on its line, like a link URL with show_link,
+		// otherwise the shown text of the line is highlighted.
+		line := strings.Count(src[:m[0]], "\n")
+		if shownLines[line][0] < 0 {
+			continue
+		}
+		shown := text[shownLines[line][0]:shownLines[line][1]]
+		if i := strings.Index(shown, src[m[0]:m[1]]); i >= 0 {
+			start = shownLines[line][0] + i
+			found = append(found, []int{start, start + m[1] - m[0]})
+			continue
+		}
+		lineStart := strings.LastIndexByte(src[:m[0]], '\n') + 1
+		lineEnd := strings.IndexByte(src[m[0]:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(src)
+		} else {
+			lineEnd += m[0]
+		}
+		if start, end, ok = shownSpan(pos, lineStart, lineEnd); ok {
+			found = append(found, []int{start, end})
+		}
+	}
+	return found
+}
+
+// highlightMatches returns the tagged text of the page with a region around
+// each match, named search-N, and the number of matches.
+func highlightMatches(p *structs.Page, tagged []byte, re *regexp.Regexp, kind searchKind) ([]byte, int) {
+	text, starts, ends := renderer.VisibleText(string(tagged))
+	var found [][]int
+	if src, sources, skip, ok := pageSource(p); ok && string(tagged) == p.Content {
+		found = sourceMatches(re, kind, src, sources, skip, text)
+	} else {
+		found = findMatches(re, kind, text)
+	}
+
+	highlighted := make([]byte, 0, len(tagged)+len(found)*16)
+	last := 0
+	n := 0
+	for _, m := range found {
+		start := starts[m[0]]
+		end := ends[m[1]-1]
+		if start < last {
+			// Overlaps the last match, because of escaped brackets, or
+			// because both are on a line where nothing of them is shown
+			continue
+		}
+		highlighted = append(highlighted, tagged[last:start]...)
+		highlighted = append(highlighted, fmt.Sprintf(`["search-%d"]`, n)...)
+		highlighted = append(highlighted, tagged[start:end]...)
+		highlighted = append(highlighted, `[""]`...)
+		last = end
+		n++
+	}
+	highlighted = append(highlighted, tagged[last:]...)
+	return highlighted, n
+}
+
+// showMatch highlights the current match, scrolls to it, and shows which
+// one it is in the bottom bar.
+func showMatch(t *tab) {
+	if matches == 0 {
+		bottomBar.SetLabel("[::b]No matches: [::-]")
+		return
+	}
+	t.view.Highlight(fmt.Sprint("search-", curMatch))
+	t.view.ScrollToHighlight()
+	bottomBar.SetLabel(fmt.Sprintf("[::b]Match %d of %d: [::-]", curMatch+1, matches))
+}
@@ -6,6 +6,8 @@ const (
 	PanelDownload            = "dl"
 	PanelDownloadChoiceModal = "dlChoice"
 	PanelHelp                = "help"
+	PanelIdentityModal       = "identity"
+	PanelTofuModal           = "tofu"
 
 	PanelYesNoModal = "yesno"
 	PanelInfoModal  = "info"
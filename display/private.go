@@ -48,6 +48,14 @@ func followLink(t *tab, prev, next string) {
 	goURL(t, next)
 }
 
+// pageProxied returns whether the page is rendered as proxied when it's
+// reformatted, see renderer.RenderGemini.
+func pageProxied(p *structs.Page) bool {
+	return !strings.HasPrefix(p.URL, "gemini") &&
+		!strings.HasPrefix(p.URL, "about") &&
+		!strings.HasPrefix(p.URL, "file")
+}
+
 // reformatPage will take the raw page content and reformat it according to the current terminal dimensions.
 // It should be called when the terminal size changes.
 // It will not waste resources if the passed page is already fitted to the current terminal width, and can be
@@ -60,25 +68,36 @@ func reformatPage(p *structs.Page) {
 
 	// TODO: Setup a renderer.RenderFromMediatype func so this isn't needed
 
+	proxied := pageProxied(p)
+
 	var rendered string
 	switch p.Mediatype {
 	case structs.TextGemini:
 		// Links are not recorded because they won't change
-		proxied := true
-		if strings.HasPrefix(p.URL, "gemini") ||
-			strings.HasPrefix(p.URL, "about") ||
-			strings.HasPrefix(p.URL, "file") {
-			proxied = false
+		if strings.HasPrefix(p.URL, "spartan://") {
+			rendered, _ = renderer.RenderSpartan(p.Raw, textWidth())
+		} else {
+			rendered, _ = renderer.RenderGemini(p.Raw, textWidth(), proxied)
 		}
-		rendered, _ = renderer.RenderGemini(p.Raw, textWidth(), proxied)
+	case structs.TextMarkdown, structs.TextCSV, structs.TextTSV, structs.TextGophermap, structs.TextHTML:
+		rendered, _ = renderer.RenderGemini(renderer.ToGemini(p.Mediatype, p.Raw), textWidth(), proxied)
 	case structs.TextPlain:
 		rendered = renderer.RenderPlainText(p.Raw)
 	case structs.TextAnsi:
 		rendered = renderer.RenderANSI(p.Raw)
+	case structs.Image:
+		img, err := renderer.DecodeImage(p.Raw)
+		if err != nil {
+			return
+		}
+		rendered = renderer.RenderImagePage(img, textWidth())
 	default:
 		// Rendering this type is not implemented
 		return
 	}
+	if !p.CachedAt.IsZero() {
+		rendered = offlineBanner(p) + rendered
+	}
 	p.Content = rendered
 	p.TermWidth = termW
 }
@@ -143,6 +162,7 @@ func goURL(t *tab, u string) {
 	final, displayed := handleURL(t, u, 0)
 	if displayed {
 		t.addToHistory(final)
+		recordVisit(t.page)
 	} else if t.page.URL == "" {
 		// The tab is showing interstitial or no content. Let's go to about:newtab.
 		handleAbout(t, "about:newtab")
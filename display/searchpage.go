@@ -0,0 +1,223 @@
+package display
+
+import (
+	"fmt"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/makeworld-the-better-one/amfora/bookmarks"
+	"github.com/makeworld-the-better-one/amfora/cache"
+	"github.com/makeworld-the-better-one/amfora/history"
+	"github.com/makeworld-the-better-one/amfora/renderer"
+	"github.com/makeworld-the-better-one/amfora/search"
+	"github.com/makeworld-the-better-one/amfora/structs"
+	"github.com/makeworld-the-better-one/amfora/subscriptions"
+	"github.com/makeworld-the-better-one/go-gemini"
+)
+
+// about:search searches the pages in open tabs and the cache, bookmarks,
+// history, and subscriptions, all without using the network.
+
+// The max number of results shown for each kind of result.
+const maxSearchResults = 50
+
+// Matches in snippets are marked with these while the page is rendered, and
+// then they're replaced with tags to highlight them. They're in the Unicode
+// private use area, so pages shouldn't have them.
+const (
+	searchMarkStart = "\uE000"
+	searchMarkEnd   = "\uE001"
+)
+
+// pageSearchText returns the text of a page that can be searched, and
+// whether it has any.
+func pageSearchText(p *structs.Page) (string, bool) {
+	if p == nil || p.URL == "" || strings.HasPrefix(p.URL, "about:") || p.Raw == "" {
+		return "", false
+	}
+	switch p.Mediatype {
+	case structs.TextGemini, structs.TextPlain, structs.TextAnsi:
+		return p.Raw, true
+	case structs.TextMarkdown, structs.TextCSV, structs.TextTSV, structs.TextGophermap, structs.TextHTML:
+		return renderer.ToGemini(p.Mediatype, p.Raw), true
+	}
+	return "", false
+}
+
+// searchPageDocs returns the pages in open tabs and the cache, as documents
+// to search. Each URL is only included once. Responses in the disk cache
+// aren't rendered, only their text is used.
+func searchPageDocs() []*search.Doc {
+	seen := make(map[string]bool)
+	docs := make([]*search.Doc, 0)
+	add := func(u, text string) {
+		if seen[u] || !savableURL(u) {
+			return
+		}
+		seen[u] = true
+		title := u
+		if match := topHeadingRegex.FindString(text); match != "" {
+			title = strings.TrimSpace(match[1:])
+		}
+		docs = append(docs, &search.Doc{URL: u, Title: title, Text: text})
+	}
+
+	for _, t := range tabs {
+		if t.unloaded {
+			continue
+		}
+		if text, ok := pageSearchText(t.page); ok {
+			add(t.page.URL, text)
+		}
+	}
+	for _, p := range cache.Pages() {
+		if text, ok := pageSearchText(p); ok {
+			add(p.URL, text)
+		}
+	}
+	for _, r := range cache.AllResponses() {
+		if seen[r.URL] || gemini.SimplifyStatus(r.Status) != gemini.StatusSuccess {
+			continue
+		}
+		if text, ok := renderer.SearchableText(r.Meta, r.Body); ok && text != "" {
+			add(r.URL, text)
+		}
+	}
+	return docs
+}
+
+// SearchPage searches local data for the query in `u`, which is like
+// about:search?query, and displays the results in the current tab. If there's
+// no query the user is asked for one. It returns the URL to add to history,
+// and whether to add it.
+func SearchPage(t *tab, u string) (string, bool) {
+	query := ""
+	if len(u) > 13 {
+		var err error
+		query, err = gemini.QueryUnescape(u[13:])
+		if err != nil {
+			Error("URL Error", "Invalid query string: "+err.Error())
+			return "", false
+		}
+	}
+	if strings.TrimSpace(query) == "" {
+		var ok bool
+		query, ok = Input("Search pages you've visited, bookmarks, history, and subscriptions for:", false)
+		if !ok || strings.TrimSpace(query) == "" {
+			return "", false
+		}
+	}
+	query = strings.TrimSpace(query)
+	renderSearchPage(t, query)
+	return "about:search?" + gemini.QueryEscape(query), true
+}
+
+// searchResults adds a section of results to the page.
+func searchResults(rawPage *string, heading string, results []*search.Result, line func(r *search.Result) string) {
+	if len(results) == 0 {
+		return
+	}
+	*rawPage += fmt.Sprintf("\n## %s (%d)\n\n", heading, len(results))
+	shown := results
+	if len(shown) > maxSearchResults {
+		shown = shown[:maxSearchResults]
+	}
+	for _, r := range shown {
+		*rawPage += "=> " + r.URL + " " + r.Title + "\n"
+		if l := line(r); l != "" {
+			*rawPage += l + "\n"
+		}
+	}
+	if len(results) > len(shown) {
+		*rawPage += fmt.Sprintf("\nAnd %d more, try a longer query.\n", len(results)-len(shown))
+	}
+}
+
+func renderSearchPage(t *tab, query string) {
+	q := search.NewQuery(query)
+	width := textWidth() - 4
+
+	// Pages are searched first, so history only has the ones that aren't cached
+	pages := q.Search(searchPageDocs(), width)
+	found := make(map[string]bool)
+	for _, r := range pages {
+		found[r.URL] = true
+	}
+
+	histDocs := make([]*search.Doc, 0)
+	visits := make(map[string]*history.Entry)
+	for _, e := range history.Search("") {
+		if found[e.URL] {
+			continue
+		}
+		title := e.Title
+		if title == "" {
+			title = e.URL
+		}
+		histDocs = append(histDocs, &search.Doc{URL: e.URL, Title: title})
+		visits[e.URL] = e
+	}
+
+	bkmkDocs := make([]*search.Doc, 0)
+	names, urls := bookmarks.All()
+	for i := range names {
+		bkmkDocs = append(bkmkDocs, &search.Doc{URL: urls[i], Title: names[i]})
+	}
+
+	subDocs := make([]*search.Doc, 0)
+	published := make(map[*search.Doc]*subscriptions.PageEntry)
+	for _, e := range subscriptions.GetPageEntries().Entries {
+		title := e.Prefix
+		if e.Title != "" && e.Title != "/" {
+			title += " - " + e.Title
+		}
+		d := &search.Doc{URL: e.URL, Title: title}
+		subDocs = append(subDocs, d)
+		published[d] = e
+	}
+
+	rawPage := "# Search\n\n" +
+		"Results for \"" + query + "\" in pages you've visited that are open or cached, " +
+		"bookmarks, history, and subscriptions. Pages with all the words are found, ignoring case.\n"
+
+	bkmks := q.Search(bkmkDocs, width)
+	hist := q.Search(histDocs, width)
+	subs := q.Search(subDocs, width)
+	if len(pages)+len(bkmks)+len(hist)+len(subs) == 0 {
+		rawPage += "\nNothing was found.\n"
+	}
+
+	searchResults(&rawPage, "Pages", pages, func(r *search.Result) string {
+		if r.Snippet == "" {
+			return ""
+		}
+		return "> " + q.Highlight(strings.NewReplacer(searchMarkStart, "", searchMarkEnd, "").Replace(r.Snippet),
+			searchMarkStart, searchMarkEnd)
+	})
+	searchResults(&rawPage, "Bookmarks", bkmks, func(*search.Result) string { return "" })
+	searchResults(&rawPage, "History", hist, func(r *search.Result) string {
+		e := visits[r.URL]
+		return "Last visited " + humanize.Time(e.Last())
+	})
+	searchResults(&rawPage, "Subscriptions", subs, func(r *search.Result) string {
+		return published[r.Doc].Published.Format("Jan 02, 2006")
+	})
+	rawPage += "\n=> about:search New search\n"
+
+	content, links := renderer.RenderGemini(rawPage, textWidth(), false)
+	// The marks are only in quote lines, which are italic
+	content = strings.NewReplacer(searchMarkStart, "[::ir]", searchMarkEnd, "[::i]").Replace(content)
+	// The highlights are lost if the page is reformatted, but it can still be read
+	rawPage = strings.NewReplacer(searchMarkStart, "", searchMarkEnd, "").Replace(rawPage)
+
+	page := structs.Page{
+		Raw:       rawPage,
+		Content:   content,
+		Links:     links,
+		URL:       "about:search?" + gemini.QueryEscape(query),
+		TermWidth: termW,
+		Mediatype: structs.TextGemini,
+	}
+	setPage(t, &page)
+	t.applyBottomBar()
+}
@@ -0,0 +1,395 @@
+package display
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/makeworld-the-better-one/amfora/client"
+	"github.com/makeworld-the-better-one/amfora/renderer"
+	"github.com/makeworld-the-better-one/amfora/sessions"
+	"github.com/makeworld-the-better-one/amfora/structs"
+	"github.com/spf13/viper"
+)
+
+// The open tabs are saved as a session shortly after they change, and when
+// quitting. See the sessions package.
+
+// The name the tabs from last time are kept as, when they aren't restored
+const previousSession = "previous"
+
+var sessionName = sessions.Default // The session the open tabs are saved to
+var sessionPending *sessions.Session
+var sessionTimer *time.Timer
+var sessionErr error // The last error from saving, shown on about:sessions
+var sessionMu sync.Mutex
+
+// sessionReady is whether the tabs are being saved. It's set once the user
+// has picked whether to restore the last session, so it isn't overwritten.
+var sessionReady atomic.Bool
+
+// sensitiveURLs has the URLs with sensitive input in their query, like
+// passwords, and the pages visited in private mode. They are never saved
+// to disk.
+var sensitiveURLs sync.Map
+
+func markSensitive(u string) {
+	sensitiveURLs.Store(client.NormalizeURL(u), struct{}{})
+}
+
+func isSensitive(u string) bool {
+	_, ok := sensitiveURLs.Load(client.NormalizeURL(u))
+	return ok
+}
+
+// savableURL returns whether the URL can be saved in a session. Titan URLs
+// aren't, because the data to upload isn't saved.
+func savableURL(u string) bool {
+	return u != "" && !strings.HasPrefix(u, "titan://") && !isSensitive(u)
+}
+
+// sessionSnapshot returns the open tabs as a session.
+func sessionSnapshot() *sessions.Session {
+	s := &sessions.Session{Tabs: make([]*sessions.Tab, 0, len(tabs)), Current: curTab}
+	for _, t := range tabs {
+		st := &sessions.Tab{History: make([]*sessions.Entry, 0, len(t.history.urls))}
+		for i, u := range t.history.urls {
+			if savableURL(u) {
+				e := &sessions.Entry{URL: u}
+				if i == t.history.pos && !t.unloaded && t.page.URL == u {
+					// The page being shown is more up to date than the history
+					e.Row, e.Column = t.page.Row, t.page.Column
+					e.Selected, e.SelectedID, e.Mode = t.page.Selected, t.page.SelectedID, t.page.Mode
+				} else if i < len(t.history.pageCache) && t.history.pageCache[i] != nil {
+					pc := t.history.pageCache[i]
+					e.Row, e.Column = pc.row, pc.column
+					e.Selected, e.SelectedID, e.Mode = pc.selected, pc.selectedID, pc.mode
+				}
+				st.History = append(st.History, e)
+			}
+			if i == t.history.pos && len(st.History) > 0 {
+				st.Pos = len(st.History) - 1
+			}
+		}
+		if len(st.History) == 0 {
+			st.History = append(st.History, &sessions.Entry{URL: "about:newtab"})
+		}
+		s.Tabs = append(s.Tabs, st)
+	}
+	return s
+}
+
+// writeSession saves the latest snapshot of the tabs.
+func writeSession() {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	sessionTimer = nil
+	if sessionPending == nil {
+		return
+	}
+	sessionErr = sessions.Save(sessionName, sessionPending)
+	sessionPending = nil
+}
+
+// sessionChanged saves the open tabs soon. Saves are grouped together, so
+// opening many pages at once doesn't write the file each time.
+func sessionChanged() {
+	if !sessionReady.Load() {
+		return
+	}
+	s := sessionSnapshot()
+
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	sessionPending = s
+	if sessionTimer == nil {
+		sessionTimer = time.AfterFunc(2*time.Second, writeSession)
+	}
+}
+
+// saveSession saves the open tabs now.
+func saveSession() {
+	if !sessionReady.Load() {
+		return
+	}
+	s := sessionSnapshot()
+
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	if sessionTimer != nil {
+		sessionTimer.Stop()
+		sessionTimer = nil
+	}
+	sessionPending = nil
+	sessionErr = sessions.Save(sessionName, s)
+}
+
+// restoredTab makes a tab with the history of a tab from a session. The page
+// isn't loaded until the tab is shown, see loadRestoredTab.
+func restoredTab(st *sessions.Tab) *tab {
+	t := makeNewTab()
+	for _, e := range st.History {
+		t.history.urls = append(t.history.urls, e.URL)
+		t.history.pageCache = append(t.history.pageCache, &tabHistoryPageCache{
+			row:        e.Row,
+			column:     e.Column,
+			selected:   e.Selected,
+			selectedID: e.SelectedID,
+			mode:       e.Mode,
+		})
+	}
+	t.history.pos = st.Pos
+
+	u := st.History[st.Pos].URL
+	p := renderPageFromString("Loading " + u + "...")
+	p.URL = u // So the tab label is right
+	t.page = p
+	t.view.SetText(p.Content)
+	t.barText = u
+	t.unloaded = true
+	return t
+}
+
+// loadRestoredTab loads the page of a restored tab, and scrolls to where it
+// was.
+func loadRestoredTab(t *tab) {
+	t.unloaded = false
+	go applyHist(t)
+}
+
+// blankSession returns whether the session only has new tabs, so there's
+// nothing to restore.
+func blankSession(s *sessions.Session) bool {
+	for _, st := range s.Tabs {
+		for _, e := range st.History {
+			if e.URL != "about:newtab" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// setTabs replaces the open tabs, and switches to the one at index cur.
+func setTabs(newTabs []*tab, cur int) {
+	if curTab > -1 {
+		tabs[curTab].saveBottomBar()
+	}
+	for i := range tabs {
+		browser.RemoveTab(strconv.Itoa(i))
+	}
+	tabs = newTabs
+	for i, t := range tabs {
+		browser.AddTab(strconv.Itoa(i), t.label(), makeContentLayout(t.view, leftMargin()))
+	}
+	curTab = -1 // So the bottomBar isn't saved to the wrong tab
+	SwitchTab(cur)
+}
+
+// openSession replaces the open tabs with the ones from the session, which
+// they're saved to from then on. If keep is true, the open tabs are kept
+// after the restored ones instead, and stay selected.
+func openSession(name string, s *sessions.Session, keep bool) {
+	newTabs := make([]*tab, 0, len(s.Tabs)+len(tabs))
+	for _, st := range s.Tabs {
+		newTabs = append(newTabs, restoredTab(st))
+	}
+	cur := s.Current
+	if keep {
+		cur = len(newTabs) + curTab
+		newTabs = append(newTabs, tabs...)
+	}
+
+	sessionMu.Lock()
+	sessionName = name
+	sessionMu.Unlock()
+
+	setTabs(newTabs, cur)
+}
+
+// startSaving starts saving the open tabs.
+func startSaving() {
+	sessionReady.Store(true)
+	sessionChanged()
+}
+
+// StartSession restores the last session if the config says to, and starts
+// saving the open tabs. It should be called after the first tab is opened.
+// keep is whether the tabs already open should be kept, like when Amfora
+// was started with a URL.
+func StartSession(keep bool) {
+	name := sessions.Latest()
+	if name == "" {
+		startSaving()
+		return
+	}
+	// Kept so the tabs from last time can still be opened from about:sessions,
+	// instead of being saved over
+	keepPrevious := func() {
+		if name == sessions.Default {
+			sessions.Rename(name, previousSession) //nolint:errcheck
+		}
+	}
+	mode := viper.GetString("a-general.restore_session")
+	if mode == "never" {
+		keepPrevious()
+		startSaving()
+		return
+	}
+
+	go func() {
+		defer startSaving()
+
+		s, err := sessions.Load(name)
+		if err != nil {
+			Error("Session Error", "Couldn't load the last session: "+err.Error())
+			return
+		}
+		if blankSession(s) {
+			return
+		}
+		if mode != "always" {
+			prompt := fmt.Sprintf("Restore the %d tabs from the last session?", len(s.Tabs))
+			if len(s.Tabs) == 1 {
+				prompt = "Restore the tab from the last session?"
+			}
+			if !YesNo(prompt) {
+				keepPrevious()
+				return
+			}
+		}
+		openSession(name, s, keep)
+	}()
+}
+
+// SessionsPage displays the sessions page in the current tab. `u` is the URL
+// entered by the user, and it may have a query string with an action.
+// It returns whether the page should be added to history.
+func SessionsPage(t *tab, u string) bool {
+	if len(u) <= 15 || u[:15] != "about:sessions?" {
+		renderSessionsPage(t)
+		return true
+	}
+
+	q, err := url.ParseQuery(u[15:])
+	if err != nil {
+		Error("URL Error", "Invalid query string: "+err.Error())
+		return false
+	}
+	sessionMu.Lock()
+	current := sessionName
+	sessionMu.Unlock()
+
+	name := q.Get("name")
+	switch q.Get("action") {
+	case "open":
+		if name == current {
+			Info("That session is already open.")
+			return false
+		}
+		s, err := sessions.Load(name)
+		if err != nil {
+			Error("Session Error", err.Error())
+			return false
+		}
+		// Save the open tabs first, so they can be opened again
+		saveSession()
+		openSession(name, s, false)
+		return false
+	case "save":
+		newName, ok := Input("Enter a name for the session. The open tabs will be saved to it from now on.", false)
+		newName = strings.TrimSpace(newName)
+		if !ok || newName == "" {
+			return false
+		}
+		if !sessions.ValidName(newName) {
+			Error("Session Error", sessions.ErrInvalidName.Error())
+			return false
+		}
+		if newName != current {
+			for _, info := range sessions.List() {
+				if info.Name == newName && !YesNo("A session named "+newName+" already exists. Replace it?") {
+					return false
+				}
+			}
+		}
+		sessionMu.Lock()
+		sessionName = newName
+		sessionMu.Unlock()
+		saveSession()
+	case "delete":
+		if name == current {
+			Error("Session Error", "The open session can't be deleted, open another one first.")
+			return false
+		}
+		if !YesNo("Delete the session " + name + "?") {
+			return false
+		}
+		if err := sessions.Delete(name); err != nil {
+			Error("Session Error", err.Error())
+			return false
+		}
+	default:
+		Error("URL Error", "Unknown sessions action.")
+		return false
+	}
+	renderSessionsPage(t) // Reload
+	return false
+}
+
+func renderSessionsPage(t *tab) {
+	// Make sure the list is up to date
+	saveSession()
+
+	sessionMu.Lock()
+	current := sessionName
+	saveErr := sessionErr
+	sessionMu.Unlock()
+
+	rawPage := "# Sessions\n\n" +
+		"The open tabs and their history are saved as you browse, so they can be restored later. " +
+		"Whether the last session is restored when Amfora starts is set by restore_session in the config.\n\n" +
+		"The open tabs are saved to the session: " + current + "\n"
+	if saveErr != nil {
+		rawPage += "\nThe session couldn't be saved: " + saveErr.Error() + "\n"
+	}
+	rawPage += "\n=> about:sessions?" + url.Values{"action": {"save"}}.Encode() + " Save the open tabs as a new session\n"
+
+	rawPage += "\n## Saved Sessions\n\nMost recently saved first. Opening a session replaces the open tabs.\n\n"
+	infos := sessions.List()
+	if len(infos) == 0 {
+		rawPage += "No sessions are saved.\n"
+	}
+	for _, info := range infos {
+		tabWord := "tabs"
+		if info.Tabs == 1 {
+			tabWord = "tab"
+		}
+		if info.Name == current {
+			rawPage += fmt.Sprintf("### %s (open)\n%d %s, saved %s\n\n",
+				info.Name, info.Tabs, tabWord, humanize.Time(info.Saved))
+			continue
+		}
+		rawPage += fmt.Sprintf("### %s\n%d %s, saved %s\n", info.Name, info.Tabs, tabWord, humanize.Time(info.Saved))
+		rawPage += "=> about:sessions?" + url.Values{"action": {"open"}, "name": {info.Name}}.Encode() + " Open\n"
+		rawPage += "=> about:sessions?" + url.Values{"action": {"delete"}, "name": {info.Name}}.Encode() + " Delete\n\n"
+	}
+
+	content, links := renderer.RenderGemini(rawPage, textWidth(), false)
+	page := structs.Page{
+		Raw:       rawPage,
+		Content:   content,
+		Links:     links,
+		URL:       "about:sessions",
+		TermWidth: termW,
+		Mediatype: structs.TextGemini,
+	}
+	setPage(t, &page)
+	t.applyBottomBar()
+}
@@ -47,6 +47,7 @@ type tab struct {
 	barLabel         string // The bottomBar label for the tab
 	barText          string // The bottomBar text for the tab
 	preferURLHandler bool   // For #143, use URL handler over proxy
+	unloaded         bool   // Restored from a session, and loaded when it's first shown
 }
 
 // makeNewTab initializes an tab struct with no content.
@@ -372,6 +373,8 @@ func (t *tab) addToHistory(u string) {
 	// Cache page info for #122
 	t.history.pageCache = append(t.history.pageCache, &tabHistoryPageCache{}) // Add new spot
 	t.historyCachePage()                                                      // Fill it with data
+
+	sessionChanged()
 }
 
 // pageUp scrolls up 75% of the height of the terminal, like Bombadillo.
@@ -0,0 +1,153 @@
+package display
+
+import (
+	"errors"
+	"io/ioutil"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"code.rocketnine.space/tslocum/cview"
+	"github.com/makeworld-the-better-one/amfora/client"
+	"github.com/makeworld-the-better-one/amfora/structs"
+	"github.com/mitchellh/go-homedir"
+)
+
+var errEditor = errors.New("editor failed")
+
+// editorCommand returns the user's text editor command, from $VISUAL or $EDITOR.
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if cmd := strings.Fields(os.Getenv(env)); len(cmd) > 0 {
+			return cmd
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// editText opens the text in the user's editor, with the file extension so
+// the editor can highlight it. Amfora is suspended until the editor quits.
+// The edited text is returned.
+func editText(text, ext string) (string, error) {
+	f, err := ioutil.TempFile("", "amfora-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(text)
+	f.Close()
+	if err != nil {
+		return "", err
+	}
+
+	cmd := editorCommand()
+	proc := exec.Command(cmd[0], append(cmd[1:], f.Name())...)
+	proc.Stdin = os.Stdin
+	proc.Stdout = os.Stdout
+	proc.Stderr = os.Stderr
+
+	var runErr error
+	if !App.Suspend(func() { runErr = proc.Run() }) {
+		return "", errEditor
+	}
+	if runErr != nil {
+		return "", runErr
+	}
+
+	edited, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(edited), nil
+}
+
+// fileMediatype returns the mediatype to upload a local file as.
+func fileMediatype(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gmi", ".gemini":
+		return "text/gemini"
+	}
+	if m := mime.TypeByExtension(filepath.Ext(path)); m != "" {
+		return m
+	}
+	return "application/octet-stream"
+}
+
+// titanUpload uploads to the current page with Titan. The user can upload
+// a local file, or edit the page's text in their editor and upload that.
+// The server's response is handled like any other page.
+func titanUpload(t *tab) {
+	if !t.hasContent() || !(strings.HasPrefix(t.page.URL, "gemini://") || strings.HasPrefix(t.page.URL, "titan://")) {
+		Error("Titan Error", "Only Gemini pages can be uploaded to.")
+		return
+	}
+	target := t.page.URL
+	if strings.HasPrefix(target, "titan://") {
+		// Upload to the same place again
+		target = "gemini://" + strings.TrimPrefix(strings.SplitN(target, ";", 2)[0], "titan://")
+	}
+
+	path, ok := Input("Upload to "+cview.Escape(target)+
+		"\nEnter the path of a local file to upload, or leave it empty to edit this page.", false)
+	if !ok {
+		return
+	}
+
+	var data []byte
+	var mediatype string
+	if path = strings.TrimSpace(path); path != "" {
+		expanded, err := homedir.Expand(path)
+		if err == nil {
+			path = expanded
+		}
+		data, err = ioutil.ReadFile(path)
+		if err != nil {
+			Error("Titan Error", "Couldn't read the file: "+err.Error())
+			return
+		}
+		mediatype = fileMediatype(path)
+	} else {
+		if t.page.Mediatype == structs.Image {
+			Error("Titan Error", "Images can't be edited, upload a local file instead.")
+			return
+		}
+		ext := ".txt"
+		mediatype = t.page.RawMediatype
+		if t.page.Mediatype == structs.TextGemini {
+			ext = ".gmi"
+		}
+		if mediatype == "" {
+			mediatype = "text/gemini"
+		}
+
+		edited, err := editText(t.page.Raw, ext)
+		if err != nil {
+			Error("Titan Error", "Couldn't edit the page: "+err.Error())
+			return
+		}
+		if edited == t.page.Raw && !YesNo("The page wasn't changed. Upload it anyway?") {
+			return
+		}
+		data = []byte(edited)
+	}
+
+	token, ok := Input("Enter the token for uploading, if the server needs one.", true)
+	if !ok {
+		return
+	}
+
+	u, err := client.TitanURL(target, mediatype, len(data), strings.TrimSpace(token))
+	if err != nil {
+		Error("Titan Error", err.Error())
+		return
+	}
+	u = client.NormalizeURL(u)
+	client.SetTitanData(u, data)
+	goURL(t, u)
+}
@@ -0,0 +1,340 @@
+package display
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"code.rocketnine.space/tslocum/cview"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/gdamore/tcell/v2"
+	"github.com/makeworld-the-better-one/amfora/client"
+	"github.com/makeworld-the-better-one/amfora/config"
+	"github.com/makeworld-the-better-one/amfora/renderer"
+	"github.com/makeworld-the-better-one/amfora/structs"
+	"github.com/spf13/viper"
+)
+
+// tofuChoice is what the user chose to do in the TOFU modal.
+type tofuChoice int
+
+const (
+	tofuCancel   tofuChoice = iota
+	tofuContinue            // Trust the new cert and save it
+	tofuOnce                // Trust the new cert for this request only
+	tofuView                // View the host's entry in about:tofu
+)
+
+var tofuModal = cview.NewModal()
+var tofuCh = make(chan tofuChoice)
+
+func tofuInit() {
+	panels.AddPanel(PanelTofuModal, tofuModal, false, false)
+
+	m := tofuModal
+	frame := m.GetFrame()
+	if viper.GetBool("a-general.color") {
+		m.SetBackgroundColor(config.GetColor("tofu_modal_bg"))
+		m.SetTextColor(config.GetColor("tofu_modal_text"))
+		m.SetButtonBackgroundColor(config.GetColor("btn_bg"))
+		m.SetButtonTextColor(config.GetColor("btn_text"))
+		form := m.GetForm()
+		form.SetButtonBackgroundColorFocused(config.GetColor("btn_text"))
+		form.SetButtonTextColorFocused(config.GetTextColor("btn_bg", "btn_text"))
+		frame.SetBorderColor(config.GetColor("tofu_modal_text"))
+		frame.SetTitleColor(config.GetColor("tofu_modal_text"))
+	} else {
+		m.SetBackgroundColor(tcell.ColorBlack)
+		m.SetTextColor(tcell.ColorWhite)
+		m.SetButtonBackgroundColor(tcell.ColorWhite)
+		m.SetButtonTextColor(tcell.ColorBlack)
+		form := m.GetForm()
+		form.SetButtonBackgroundColorFocused(tcell.ColorBlack)
+		form.SetButtonTextColorFocused(tcell.ColorWhite)
+		frame.SetBorderColor(tcell.ColorWhite)
+		frame.SetTitleColor(tcell.ColorWhite)
+	}
+
+	m.SetBorder(true)
+	frame.SetTitleAlign(cview.AlignCenter)
+	frame.SetTitle(" TOFU ")
+	// Cancel is first, so it's picked by default
+	m.AddButtons([]string{"Cancel", "Trust once", "Trust", "Details"})
+	m.SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+		switch buttonLabel {
+		case "Trust":
+			tofuCh <- tofuContinue
+		case "Trust once":
+			tofuCh <- tofuOnce
+		case "Details":
+			tofuCh <- tofuView
+		default:
+			tofuCh <- tofuCancel
+		}
+	})
+}
+
+// Tofu displays the TOFU warning modal, comparing the stored cert for
+// the host with the new one it sent.
+// It blocks then returns what the user chose to do.
+func Tofu(host, hostname, port string, cert *x509.Certificate) tofuChoice {
+	old := client.GetTofuEntry(hostname, port)
+	var text string
+	if old == nil {
+		// Using the pinned-only policy
+		text = fmt.Sprintf("%s is not in the TOFU database, and only hosts already there are trusted.\n\n",
+			cview.Escape(host))
+	} else {
+		text = fmt.Sprintf("%s's certificate has changed, possibly indicating a security issue.\n\n", cview.Escape(host))
+		text += "Old fingerprint: " + old.Fingerprint + "\n"
+		if old.Subject != "" {
+			text += "Subject: " + cview.Escape(old.Subject) + "\n"
+		}
+		if old.Issuer != "" {
+			text += "Issuer: " + cview.Escape(old.Issuer) + "\n"
+		}
+		if !old.NotBefore.IsZero() {
+			text += "Valid: " + formatValidity(old.NotBefore, old.Expiry) + "\n"
+		} else if !old.Expiry.IsZero() {
+			// Saved by an older version, without the start date
+			text += "Would have expired " + humanize.Time(old.Expiry) + "\n"
+		}
+		text += "\n"
+	}
+	text += "New fingerprint: " + client.CertFingerprint(cert) + "\n" +
+		"Subject: " + cview.Escape(client.CertText(cert.Subject.String())) + "\n" +
+		"Issuer: " + cview.Escape(client.CertText(cert.Issuer.String())) + "\n" +
+		"Valid: " + formatValidity(cert.NotBefore, cert.NotAfter) + "\n" +
+		cview.Escape(caStatus(cert, hostname)) + "\n\n" +
+		"Are you sure you want to continue?"
+
+	tofuModal.SetText(text)
+	tofuModal.GetForm().SetFocus(0)
+	panels.ShowPanel(PanelTofuModal)
+	panels.SendToFront(PanelTofuModal)
+	App.SetFocus(tofuModal)
+	App.Draw()
+
+	resp := <-tofuCh
+	panels.HidePanel(PanelTofuModal)
+	App.SetFocus(tabs[curTab].view)
+	App.Draw()
+	return resp
+}
+
+// tofuEntryURL returns the about:tofu URL that shows a single host.
+// The port string can be empty, to indicate port 1965.
+func tofuEntryURL(hostname, port string) string {
+	q := url.Values{"host": {hostname}}
+	if port != "" && port != "1965" {
+		q.Set("port", port)
+	}
+	return "about:tofu?" + q.Encode()
+}
+
+// tofuHost returns the host and port as they would appear in a URL.
+func tofuHost(e *client.TofuEntry) string {
+	if e.Port == "" || e.Port == "1965" {
+		if net.ParseIP(e.Host) != nil && net.ParseIP(e.Host).To4() == nil {
+			return "[" + e.Host + "]"
+		}
+		return e.Host
+	}
+	return net.JoinHostPort(e.Host, e.Port)
+}
+
+// formatValidity describes the validity window of a cert.
+func formatValidity(notBefore, notAfter time.Time) string {
+	const layout = "Jan 02, 2006"
+	now := time.Now()
+	switch {
+	case notBefore.IsZero() && notAfter.IsZero():
+		return "unknown"
+	case notBefore.IsZero():
+		return "until " + notAfter.Local().Format(layout)
+	case now.Before(notBefore):
+		return fmt.Sprintf("%s to %s, not valid yet", notBefore.Local().Format(layout), notAfter.Local().Format(layout))
+	case now.After(notAfter):
+		return fmt.Sprintf("%s to %s, expired", notBefore.Local().Format(layout), notAfter.Local().Format(layout))
+	}
+	return fmt.Sprintf("%s to %s", notBefore.Local().Format(layout), notAfter.Local().Format(layout))
+}
+
+// caStatus describes whether the cert is signed by a trusted CA for the hostname.
+func caStatus(cert *x509.Certificate, hostname string) string {
+	if err := client.VerifyCA(cert, hostname); err != nil {
+		// The error can have names from the cert in it
+		return "Not verified by a CA: " + client.CertText(err.Error())
+	}
+	return "Signed by a trusted CA for " + hostname
+}
+
+// formatTofuTime formats a time for display on the TOFU page.
+func formatTofuTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s (%s)", t.Local().Format("Jan 02, 2006 15:04"), humanize.Time(t))
+}
+
+// TofuPage displays the TOFU database in the current tab. `u` is the URL
+// entered by the user, and it may have a query string to view a single
+// host or perform an action. It returns whether the page should be
+// added to history.
+func TofuPage(t *tab, u string) bool {
+	var q url.Values
+	if len(u) > 11 && u[:11] == "about:tofu?" {
+		var err error
+		q, err = url.ParseQuery(u[11:])
+		if err != nil {
+			Error("URL Error", "Invalid query string: "+err.Error())
+			return false
+		}
+	}
+	host := q.Get("host")
+	port := q.Get("port")
+
+	switch q.Get("action") {
+	case "":
+		// Just viewing
+	case "forget":
+		if !YesNo("Forget " + cview.Escape(host) + "? The next certificate it sends will be trusted.") {
+			return false
+		}
+		if err := client.ForgetTofuEntry(host, port); err != nil {
+			Error("TOFU Error", "Error saving TOFU database: "+err.Error())
+		}
+		renderTofuPage(t, "", "") // Reload
+		return false
+	case "trust":
+		e := client.GetTofuEntry(host, port)
+		if e == nil || e.Mismatch == nil {
+			Error("TOFU Error", "There is no new certificate to trust for that host.")
+			return false
+		}
+		fingerprint := client.CertFingerprint(e.Mismatch)
+		if !YesNo("Trust and save the new certificate for " + cview.Escape(host) + "?\n\n" +
+			"Fingerprint: " + fingerprint) {
+			return false
+		}
+		if !client.TrustMismatch(host, port, fingerprint) {
+			Error("TOFU Error", "The new certificate changed, look at it again before trusting it.")
+		}
+		renderTofuPage(t, host, port) // Reload
+		return false
+	case "repin":
+		if !YesNo("Re-pin " + cview.Escape(host) + "? The next certificate it sends will be trusted.") {
+			return false
+		}
+		if err := client.RepinTofuEntry(host, port); err != nil {
+			Error("TOFU Error", "Error saving TOFU database: "+err.Error())
+		}
+		renderTofuPage(t, host, port) // Reload
+		return false
+	default:
+		Error("URL Error", "Unknown TOFU action.")
+		return false
+	}
+
+	renderTofuPage(t, host, port)
+	return true
+}
+
+// renderTofuPage displays the TOFU database, or just one host of it if
+// the host string isn't empty.
+func renderTofuPage(t *tab, host, port string) {
+	if port == "1965" {
+		port = ""
+	}
+
+	rawPage := "# TOFU Database\n\n" +
+		"Amfora remembers the certificate of every Gemini server it visits, " +
+		"and warns you if it changes before it expires. This is called Trust On First Use (TOFU).\n\n"
+	pageURL := "about:tofu"
+	if host != "" {
+		pageURL = tofuEntryURL(host, port)
+		rawPage += "=> about:tofu View all hosts\n"
+	}
+
+	found := false
+	for _, e := range client.TofuEntries() {
+		if host != "" && (e.Host != host || e.Port != port) {
+			continue
+		}
+		found = true
+
+		hostPort := tofuHost(e)
+		rawPage += "\n## " + hostPort + "\n\n"
+		if e.Mismatch != nil {
+			rawPage += "### Pinned certificate\n\n"
+		}
+		if e.Algorithm == client.AlgoSHA256SPKI {
+			rawPage += "* Fingerprint: " + e.Fingerprint + "\n"
+		} else {
+			// Imported from elsewhere
+			rawPage += "* Fingerprint (" + e.Algorithm + "): " + e.Fingerprint + "\n"
+		}
+		if e.Subject != "" {
+			rawPage += "* Subject: " + e.Subject + "\n"
+		}
+		if e.Issuer != "" {
+			rawPage += "* Issuer: " + e.Issuer + "\n"
+		}
+		if e.Repin {
+			rawPage += "* Expires: unknown, the next certificate seen will be trusted\n"
+		} else if e.NotBefore.IsZero() {
+			rawPage += "* Expires: " + formatTofuTime(e.Expiry) + "\n"
+		} else {
+			rawPage += "* Valid: " + formatValidity(e.NotBefore, e.Expiry) + "\n"
+		}
+		rawPage += "* First seen: " + formatTofuTime(e.FirstSeen) + "\n"
+		rawPage += "* Last seen: " + formatTofuTime(e.LastSeen) + "\n\n"
+
+		q := url.Values{"host": {e.Host}}
+		if e.Port != "" {
+			q.Set("port", e.Port)
+		}
+
+		if e.Mismatch != nil {
+			c := e.Mismatch
+			rawPage += "### New certificate\n\n" +
+				"This certificate was sent recently, and doesn't match the pinned one.\n\n" +
+				"* Fingerprint: " + client.CertFingerprint(c) + "\n" +
+				"* Subject: " + client.CertText(c.Subject.String()) + "\n" +
+				"* Issuer: " + client.CertText(c.Issuer.String()) + "\n" +
+				"* Valid: " + formatValidity(c.NotBefore, c.NotAfter) + "\n" +
+				"* " + caStatus(c, e.Host) + "\n\n"
+			q.Set("action", "trust")
+			rawPage += "=> about:tofu?" + q.Encode() + " Trust new certificate\n"
+		}
+
+		rawPage += "=> gemini://" + hostPort + "/ Visit\n"
+		if !e.Repin {
+			q.Set("action", "repin")
+			rawPage += "=> about:tofu?" + q.Encode() + " Re-pin on next visit\n"
+		}
+		q.Set("action", "forget")
+		rawPage += "=> about:tofu?" + q.Encode() + " Forget\n"
+	}
+	if !found {
+		if host == "" {
+			rawPage += "\nNo hosts have been visited yet.\n"
+		} else {
+			rawPage += "\nThat host is not in the database.\n"
+		}
+	}
+
+	content, links := renderer.RenderGemini(rawPage, textWidth(), false)
+	page := structs.Page{
+		Raw:       rawPage,
+		Content:   content,
+		Links:     links,
+		URL:       pageURL,
+		TermWidth: termW,
+		Mediatype: structs.TextGemini,
+	}
+	setPage(t, &page)
+	t.applyBottomBar()
+}
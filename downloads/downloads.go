@@ -0,0 +1,441 @@
+// Package downloads runs downloads in the background, with a limit on how
+// many run at once. Downloads past the limit wait in a queue.
+package downloads
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("no download with that ID")
+	ErrRunning    = errors.New("download is still running")
+	ErrNotRunning = errors.New("download isn't running")
+	ErrNotFailed  = errors.New("only failed or canceled downloads can be retried")
+	ErrNoFetcher  = errors.New("downloads can't be retried")
+)
+
+// Status is the state a download is in.
+type Status int
+
+const (
+	Queued Status = iota
+	Active
+	Done
+	Failed
+	Canceled
+)
+
+func (s Status) String() string {
+	switch s {
+	case Queued:
+		return "queued"
+	case Active:
+		return "downloading"
+	case Done:
+		return "done"
+	case Failed:
+		return "failed"
+	case Canceled:
+		return "canceled"
+	}
+	return "unknown"
+}
+
+// Finished returns whether the download has stopped for good, until it's retried.
+func (s Status) Finished() bool {
+	return s == Done || s == Failed || s == Canceled
+}
+
+// Fetcher requests the URL again, so a download can be retried.
+// It returns the response body and meta.
+type Fetcher func(u string) (io.ReadCloser, string, error)
+
+// Download is a copy of the state of a download.
+type Download struct {
+	ID       int
+	URL      string
+	Meta     string
+	Path     string // Where the file is saved
+	Status   Status
+	Err      error // Set when the download failed
+	Size     int64 // Bytes downloaded so far
+	Started  time.Time
+	Finished time.Time
+
+	// Set when the download is done
+	SHA256 string
+	// Duplicate is true if the same URL and content was already downloaded.
+	// Path is set to the earlier file, and nothing new is saved.
+	Duplicate bool
+}
+
+// Speed returns the average download speed in bytes per second.
+func (d *Download) Speed() float64 {
+	var elapsed time.Duration
+	switch {
+	case d.Started.IsZero():
+		return 0
+	case d.Status == Active:
+		elapsed = time.Since(d.Started)
+	default:
+		elapsed = d.Finished.Sub(d.Started)
+	}
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(d.Size) / elapsed.Seconds()
+}
+
+// attempt is a single try at downloading, a download has more than one
+// if it's retried.
+type attempt struct {
+	body     io.ReadCloser
+	size     int64 // Updated atomically
+	canceled int32 // Set atomically, to 1 if canceled
+
+	// The attempt before this one, if it was retried. This attempt waits
+	// for it to stop, so they don't use the same files at once.
+	prev *attempt
+	done chan struct{} // Closed when run returns
+}
+
+func newAttempt(body io.ReadCloser, prev *attempt) *attempt {
+	return &attempt{body: body, prev: prev, done: make(chan struct{})}
+}
+
+type download struct {
+	Download
+	cur    *attempt
+	onDone func(Download)
+}
+
+// snapshot returns a copy of the download state. The caller must hold mu.
+func (d *download) snapshot() Download {
+	s := d.Download
+	s.Size = atomic.LoadInt64(&d.cur.size)
+	return s
+}
+
+var (
+	mu        = sync.Mutex{}
+	dls       = make(map[int]*download)
+	nextID    = 1
+	active    = 0
+	maxActive = 3
+	fetcher   Fetcher
+)
+
+// SetMaxActive sets how many downloads can run at once.
+// A value <= 0 means there is no limit.
+func SetMaxActive(n int) {
+	mu.Lock()
+	defer mu.Unlock()
+	maxActive = n
+	schedule()
+}
+
+// SetFetcher sets the function used to request URLs again when retrying.
+func SetFetcher(f Fetcher) {
+	mu.Lock()
+	defer mu.Unlock()
+	fetcher = f
+}
+
+// Add queues the body to be saved at path, and returns the download ID.
+// While downloading the body is saved to a .part file beside path.
+// The body will be closed when the download finishes.
+// onDone is called in its own goroutine whenever the download finishes,
+// whether it succeeded, failed, or was canceled. It can be nil.
+func Add(u, meta, path string, body io.ReadCloser, onDone func(Download)) int {
+	mu.Lock()
+	defer mu.Unlock()
+
+	d := &download{
+		Download: Download{
+			ID:     nextID,
+			URL:    u,
+			Meta:   meta,
+			Path:   path,
+			Status: Queued,
+		},
+		cur:    newAttempt(body, nil),
+		onDone: onDone,
+	}
+	nextID++
+	dls[d.ID] = d
+	schedule()
+	return d.ID
+}
+
+// schedule starts queued downloads, oldest first, until the limit is reached.
+// The caller must hold mu.
+func schedule() {
+	queued := make([]*download, 0)
+	for _, d := range dls {
+		if d.Status == Queued {
+			queued = append(queued, d)
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool { return queued[i].ID < queued[j].ID })
+
+	for _, d := range queued {
+		if maxActive > 0 && active >= maxActive {
+			return
+		}
+		d.Status = Active
+		d.Started = time.Now()
+		active++
+		go run(d, d.cur)
+	}
+}
+
+func run(d *download, a *attempt) {
+	defer close(a.done)
+	if a.prev != nil {
+		<-a.prev.done
+		a.prev = nil
+	}
+
+	mu.Lock()
+	p := &Partial{URL: d.URL, Meta: d.Meta, Path: d.Path, Started: d.Started}
+	mu.Unlock()
+	sum, err := save(p, a)
+	a.body.Close()
+
+	mu.Lock()
+	if d.cur != a || atomic.LoadInt32(&a.canceled) == 1 {
+		// Cancel has already updated the state. If it was retried, the next
+		// attempt is waiting for this one, so the files are only its own.
+		removePartial(d.Path) // In case the files were made after canceling
+		mu.Unlock()
+		return
+	}
+
+	dupPath := ""
+	if err == nil {
+		if path, ok := findDuplicate(d.URL, sum, filepath.Dir(d.Path)); ok && path != d.Path {
+			dupPath = path
+			removePartial(d.Path)
+		} else {
+			err = finish(d.URL, d.Path, sum, p.Size)
+		}
+	}
+
+	active--
+	d.Finished = time.Now()
+	if err != nil {
+		// The partial file is kept so it can be fetched again later
+		d.Status = Failed
+		d.Err = err
+	} else {
+		d.Status = Done
+		d.SHA256 = sum
+		if dupPath != "" {
+			d.Duplicate = true
+			d.Path = dupPath
+		}
+	}
+	snap := d.snapshot()
+	onDone := d.onDone
+	schedule()
+	mu.Unlock()
+
+	if onDone != nil {
+		onDone(snap)
+	}
+}
+
+var errCanceled = errors.New("download canceled")
+
+// save copies the attempt's body to the .part file, stopping early if it's
+// canceled. The sidecar file is kept up to date while downloading.
+// The hex SHA-256 hash of the content is returned.
+func save(p *Partial, a *attempt) (string, error) {
+	f, err := os.OpenFile(PartPath(p.Path), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := writeSidecar(p); err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	w := io.MultiWriter(f, h)
+	buf := make([]byte, 32*1024)
+	lastWrite := time.Now()
+	for {
+		if atomic.LoadInt32(&a.canceled) == 1 {
+			return "", errCanceled
+		}
+		n, err := a.body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return "", werr
+			}
+			p.Size = atomic.AddInt64(&a.size, int64(n))
+			if time.Since(lastWrite) > time.Second {
+				writeSidecar(p) //nolint:errcheck
+				lastWrite = time.Now()
+			}
+		}
+		if err == io.EOF {
+			return hex.EncodeToString(h.Sum(nil)), f.Close()
+		}
+		if err != nil {
+			writeSidecar(p) //nolint:errcheck
+			return "", err
+		}
+	}
+}
+
+// finish moves the finished .part file into place and records its hash.
+func finish(u, path, sum string, size int64) error {
+	if err := os.Rename(PartPath(path), path); err != nil {
+		return err
+	}
+	os.Remove(sidecarPath(path))
+	return addRecord(u, path, sum, size)
+}
+
+// Cancel stops a queued or active download, and removes the partial files.
+func Cancel(id int) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	d, ok := dls[id]
+	if !ok {
+		return ErrNotFound
+	}
+	switch d.Status {
+	case Queued:
+		d.cur.body.Close()
+		close(d.cur.done) // It never runs
+	case Active:
+		// Closing the body stops a read that's waiting on a stalled server
+		atomic.StoreInt32(&d.cur.canceled, 1)
+		d.cur.body.Close()
+		active--
+	default:
+		return ErrNotRunning
+	}
+	d.Status = Canceled
+	d.Finished = time.Now()
+	removePartial(d.Path)
+	onDone := d.onDone
+	snap := d.snapshot()
+	schedule()
+	if onDone != nil {
+		go onDone(snap)
+	}
+	return nil
+}
+
+// Retry requests the URL of a failed or canceled download again, and queues it.
+func Retry(id int) error {
+	mu.Lock()
+	d, ok := dls[id]
+	if !ok {
+		mu.Unlock()
+		return ErrNotFound
+	}
+	if d.Status != Failed && d.Status != Canceled {
+		mu.Unlock()
+		return ErrNotFailed
+	}
+	if fetcher == nil {
+		mu.Unlock()
+		return ErrNoFetcher
+	}
+	f := fetcher
+	u := d.URL
+	mu.Unlock()
+
+	// Don't hold the lock while using the network
+	body, meta, err := f(u)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if d.Status != Failed && d.Status != Canceled {
+		// It was retried at the same time
+		body.Close()
+		return nil
+	}
+	d.cur = newAttempt(body, d.cur)
+	d.Meta = meta
+	d.Status = Queued
+	d.Err = nil
+	d.SHA256 = ""
+	d.Duplicate = false
+	d.Started = time.Time{}
+	d.Finished = time.Time{}
+	schedule()
+	return nil
+}
+
+// Remove removes a finished download from the list.
+// The file isn't deleted, and the files of failed downloads can still be
+// found with Interrupted.
+func Remove(id int) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	d, ok := dls[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if !d.Status.Finished() {
+		return ErrRunning
+	}
+	delete(dls, id)
+	return nil
+}
+
+// ClearFinished removes all finished downloads from the list.
+func ClearFinished() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for id, d := range dls {
+		if d.Status.Finished() {
+			delete(dls, id)
+		}
+	}
+}
+
+// Get returns the download with the ID, and whether it exists.
+func Get(id int) (Download, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	d, ok := dls[id]
+	if !ok {
+		return Download{}, false
+	}
+	return d.snapshot(), true
+}
+
+// All returns all the downloads, newest first.
+func All() []Download {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ret := make([]Download, 0, len(dls))
+	for _, d := range dls {
+		ret = append(ret, d.snapshot())
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID > ret[j].ID })
+	return ret
+}
@@ -0,0 +1,276 @@
+package downloads
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func reset() {
+	mu.Lock()
+	dls = make(map[int]*download)
+	nextID = 1
+	active = 0
+	maxActive = 3
+	fetcher = nil
+	mu.Unlock()
+
+	recordsMu.Lock()
+	records = make([]*record, 0)
+	recordsPath = ""
+	recordsMu.Unlock()
+}
+
+// waitFor waits until the download has the status, or fails the test.
+func waitFor(t *testing.T, id int, s Status) Download {
+	for i := 0; i < 200; i++ {
+		d, _ := Get(id)
+		if d.Status == s {
+			return d
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	d, _ := Get(id)
+	t.Fatalf("download %d is %s, not %s", id, d.Status, s)
+	return d
+}
+
+func TestAdd(t *testing.T) {
+	reset()
+	path := filepath.Join(t.TempDir(), "file.txt")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var got Download
+	id := Add("gemini://example.com/file.txt", "text/plain", path,
+		ioutil.NopCloser(strings.NewReader("hello")),
+		func(d Download) {
+			got = d
+			wg.Done()
+		},
+	)
+	wg.Wait()
+
+	assert.Equal(t, Done, got.Status)
+	assert.Equal(t, int64(5), got.Size)
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	assert.NoFileExists(t, PartPath(path))
+	assert.NoFileExists(t, sidecarPath(path))
+	// echo -n hello | sha256sum
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", got.SHA256)
+
+	d, ok := Get(id)
+	assert.True(t, ok)
+	assert.Equal(t, Done, d.Status)
+}
+
+func TestQueue(t *testing.T) {
+	reset()
+	SetMaxActive(1)
+	dir := t.TempDir()
+
+	r1, w1 := io.Pipe()
+	id1 := Add("1", "", filepath.Join(dir, "1"), r1, nil)
+	id2 := Add("2", "", filepath.Join(dir, "2"), ioutil.NopCloser(strings.NewReader("2")), nil)
+
+	waitFor(t, id1, Active)
+	d, _ := Get(id2)
+	assert.Equal(t, Queued, d.Status, "second download should wait for the first")
+
+	w1.Close()
+	waitFor(t, id1, Done)
+	waitFor(t, id2, Done)
+}
+
+func TestCancel(t *testing.T) {
+	reset()
+	SetMaxActive(1)
+	dir := t.TempDir()
+
+	r1, w1 := io.Pipe()
+	defer w1.Close()
+	id1 := Add("1", "", filepath.Join(dir, "1"), r1, nil)
+	id2 := Add("2", "", filepath.Join(dir, "2"), ioutil.NopCloser(strings.NewReader("2")), nil)
+	waitFor(t, id1, Active)
+
+	assert.NoError(t, Cancel(id1))
+	d, _ := Get(id1)
+	assert.Equal(t, Canceled, d.Status)
+	waitFor(t, id2, Done)
+	assert.ErrorIs(t, Cancel(id2), ErrNotRunning)
+	assert.FileExists(t, filepath.Join(dir, "2"))
+}
+
+func TestCancelStalled(t *testing.T) {
+	reset()
+	path := filepath.Join(t.TempDir(), "file")
+
+	// Nothing is ever written, like a stalled server
+	r, _ := io.Pipe()
+	id := Add("gemini://example.com/file", "", path, r, nil)
+	waitFor(t, id, Active)
+	mu.Lock()
+	a := dls[id].cur
+	mu.Unlock()
+
+	assert.NoError(t, Cancel(id))
+	select {
+	case <-a.done:
+	case <-time.After(time.Second):
+		t.Fatal("canceling didn't stop the stalled download")
+	}
+	assert.NoFileExists(t, PartPath(path))
+	assert.NoFileExists(t, sidecarPath(path))
+
+	// Retrying right after canceling only saves the new attempt
+	SetFetcher(func(u string) (io.ReadCloser, string, error) {
+		return ioutil.NopCloser(strings.NewReader("retried")), "", nil
+	})
+	assert.NoError(t, Retry(id))
+	waitFor(t, id, Done)
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "retried", string(data))
+}
+
+func TestRetry(t *testing.T) {
+	reset()
+	path := filepath.Join(t.TempDir(), "file")
+
+	r, w := io.Pipe()
+	id := Add("gemini://example.com/file", "", path, r, nil)
+	w.CloseWithError(errors.New("connection reset")) //nolint:goerr113
+	d := waitFor(t, id, Failed)
+	assert.EqualError(t, d.Err, "connection reset")
+	assert.NoFileExists(t, path)
+	assert.FileExists(t, PartPath(path), "partial file should be kept")
+
+	assert.ErrorIs(t, Retry(id), ErrNoFetcher)
+	SetFetcher(func(u string) (io.ReadCloser, string, error) {
+		return ioutil.NopCloser(strings.NewReader("retried")), "text/plain", nil
+	})
+	assert.NoError(t, Retry(id))
+	d = waitFor(t, id, Done)
+	assert.Equal(t, "text/plain", d.Meta)
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "retried", string(data))
+	assert.ErrorIs(t, Retry(id), ErrNotFailed)
+}
+
+func TestRemove(t *testing.T) {
+	reset()
+	dir := t.TempDir()
+
+	r, w := io.Pipe()
+	defer w.Close()
+	id1 := Add("1", "", filepath.Join(dir, "1"), r, nil)
+	id2 := Add("2", "", filepath.Join(dir, "2"), ioutil.NopCloser(strings.NewReader("2")), nil)
+	waitFor(t, id2, Done)
+
+	assert.ErrorIs(t, Remove(id1), ErrRunning)
+	ClearFinished()
+	all := All()
+	assert.Equal(t, 1, len(all))
+	assert.Equal(t, id1, all[0].ID)
+	Cancel(id1) //nolint:errcheck
+}
+
+func TestInterrupted(t *testing.T) {
+	reset()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+
+	r, w := io.Pipe()
+	id := Add("gemini://example.com/file", "text/plain", path, r, nil)
+	waitFor(t, id, Active)
+	w.Write([]byte("part")) //nolint:errcheck
+	w.CloseWithError(errors.New("connection reset")) //nolint:goerr113
+	waitFor(t, id, Failed)
+
+	ps, err := Interrupted(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(ps), "downloads in the list aren't interrupted")
+
+	assert.NoError(t, Remove(id))
+	ps, _ = Interrupted(dir)
+	assert.Equal(t, 1, len(ps))
+	assert.Equal(t, "gemini://example.com/file", ps[0].URL)
+	assert.Equal(t, "text/plain", ps[0].Meta)
+	assert.Equal(t, int64(4), ps[0].Size)
+	assert.Equal(t, path, ps[0].Path)
+
+	SetFetcher(func(u string) (io.ReadCloser, string, error) {
+		return ioutil.NopCloser(strings.NewReader("whole")), "text/plain", nil
+	})
+	id, err = Resume(dir, path, nil)
+	assert.NoError(t, err)
+	waitFor(t, id, Done)
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "whole", string(data))
+	ps, _ = Interrupted(dir)
+	assert.Equal(t, 0, len(ps))
+
+	_, err = Resume(dir, path, nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestDeleteInterrupted(t *testing.T) {
+	reset()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	assert.NoError(t, writeSidecar(&Partial{URL: "gemini://example.com/file", Path: path}))
+	assert.NoError(t, ioutil.WriteFile(PartPath(path), []byte("part"), 0644))
+
+	assert.NoError(t, DeleteInterrupted(dir, path))
+	assert.NoFileExists(t, PartPath(path))
+	assert.NoFileExists(t, sidecarPath(path))
+	assert.ErrorIs(t, DeleteInterrupted(dir, filepath.Join(dir, "other")), ErrNotFound)
+}
+
+func TestDuplicate(t *testing.T) {
+	reset()
+	dir := t.TempDir()
+	assert.NoError(t, LoadHashes(filepath.Join(dir, "hashes.json")))
+
+	add := func(name, content string) Download {
+		id := Add("gemini://example.com/file", "", filepath.Join(dir, name),
+			ioutil.NopCloser(strings.NewReader(content)), nil)
+		return waitFor(t, id, Done)
+	}
+
+	d := add("file", "same")
+	assert.False(t, d.Duplicate)
+	d = add("file(1)", "same")
+	assert.True(t, d.Duplicate)
+	assert.Equal(t, filepath.Join(dir, "file"), d.Path)
+	assert.NoFileExists(t, filepath.Join(dir, "file(1)"))
+	assert.NoFileExists(t, PartPath(filepath.Join(dir, "file(1)")))
+
+	d = add("file(1)", "different")
+	assert.False(t, d.Duplicate, "changed content isn't a duplicate")
+
+	// Records are saved and loaded
+	records = make([]*record, 0)
+	assert.NoError(t, LoadHashes(filepath.Join(dir, "hashes.json")))
+	assert.Equal(t, 2, len(records))
+
+	// Changed files aren't duplicates
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte("edited"), 0644))
+	d = add("file(2)", "same")
+	assert.False(t, d.Duplicate)
+
+	// Files in other dirs, like temp files that were opened, aren't duplicates
+	otherPath := filepath.Join(t.TempDir(), "file")
+	id := Add("gemini://example.com/file", "", otherPath, ioutil.NopCloser(strings.NewReader("same")), nil)
+	d = waitFor(t, id, Done)
+	assert.False(t, d.Duplicate)
+	assert.FileExists(t, otherPath)
+}
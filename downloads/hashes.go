@@ -0,0 +1,142 @@
+package downloads
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The SHA-256 hash of every finished download is recorded, so downloading
+// the same URL with the same content again doesn't save another copy.
+
+type record struct {
+	URL    string    `json:"url"`
+	Path   string    `json:"path"`
+	SHA256 string    `json:"sha256"`
+	Size   int64     `json:"size"`
+	Saved  time.Time `json:"saved"`
+}
+
+type recordsJSON struct {
+	Downloads []*record `json:"downloads"`
+}
+
+var records = make([]*record, 0)
+var recordsMu = sync.Mutex{}
+var recordsPath string // Empty if records aren't saved
+
+// LoadHashes loads the records of finished downloads from the file, and saves
+// all future records there. It is fine if the file doesn't exist yet.
+func LoadHashes(path string) error {
+	recordsMu.Lock()
+	defer recordsMu.Unlock()
+
+	recordsPath = path
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	var j recordsJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	records = make([]*record, 0, len(j.Downloads))
+	for _, r := range j.Downloads {
+		if r != nil && r.Path != "" {
+			records = append(records, r)
+		}
+	}
+	return nil
+}
+
+// writeRecords saves the records to the file, if there is one.
+// The caller must hold recordsMu.
+func writeRecords() error {
+	if recordsPath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(&recordsJSON{Downloads: records}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(recordsPath, data, 0666)
+}
+
+// hashFile returns the hex SHA-256 hash of the file.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// findDuplicate returns the path of an earlier download of the URL with the
+// same hash, if the file is still there and unchanged. Only files in dir
+// count, so a copy in the temporary downloads dir that was opened isn't
+// mistaken for one that was saved.
+// Records of files that are gone are removed.
+func findDuplicate(u, sum, dir string) (string, bool) {
+	recordsMu.Lock()
+	defer recordsMu.Unlock()
+
+	kept := records[:0]
+	found := ""
+	for _, r := range records {
+		if found == "" && r.URL == u && r.SHA256 == sum && filepath.Dir(r.Path) == dir {
+			if cur, err := hashFile(r.Path); err == nil && cur == sum {
+				found = r.Path
+			}
+		}
+		if _, err := os.Stat(r.Path); err == nil {
+			kept = append(kept, r)
+		}
+	}
+	changed := len(kept) != len(records)
+	records = kept
+	if changed {
+		writeRecords() //nolint:errcheck
+	}
+	return found, found != ""
+}
+
+// addRecord records a finished download.
+func addRecord(u, path, sum string, size int64) error {
+	recordsMu.Lock()
+	defer recordsMu.Unlock()
+
+	for i, r := range records {
+		if r.Path == path {
+			// The file was overwritten
+			records = append(records[:i], records[i+1:]...)
+			break
+		}
+	}
+	records = append(records, &record{
+		URL:    u,
+		Path:   path,
+		SHA256: sum,
+		Size:   size,
+		Saved:  time.Now(),
+	})
+	return writeRecords()
+}
@@ -0,0 +1,144 @@
+package downloads
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Downloads are written to a .part file until they're done, with a JSON
+// sidecar file beside it describing the download. If Amfora quits or the
+// connection fails, the sidecar is used to find the download again later.
+//
+// Gemini doesn't support requesting part of a file, so interrupted
+// downloads are fetched again from the start.
+
+const (
+	PartExt    = ".part"
+	sidecarExt = ".part.json"
+)
+
+// Partial describes a download that hasn't finished. It is stored in the sidecar file.
+type Partial struct {
+	URL     string    `json:"url"`
+	Meta    string    `json:"meta"`
+	Path    string    `json:"path"` // Where the file will be saved when it's done
+	Size    int64     `json:"size"` // Bytes downloaded so far
+	Started time.Time `json:"started"`
+}
+
+// PartPath returns the path of the .part file for the download path.
+func PartPath(path string) string {
+	return path + PartExt
+}
+
+func sidecarPath(path string) string {
+	return path + sidecarExt
+}
+
+// writeSidecar saves the partial download info beside the .part file.
+func writeSidecar(p *Partial) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(sidecarPath(p.Path), data, 0644)
+}
+
+// removePartial removes the .part and sidecar files for the download path.
+func removePartial(path string) {
+	os.Remove(PartPath(path))
+	os.Remove(sidecarPath(path))
+}
+
+// Interrupted returns the partial downloads in dir that aren't in the
+// downloads list, oldest first. These are usually from a previous session,
+// or were removed from the list after failing.
+func Interrupted(dir string) ([]Partial, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	known := make(map[string]bool, len(dls))
+	for _, d := range dls {
+		known[d.Path] = true
+	}
+	mu.Unlock()
+
+	ret := make([]Partial, 0)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), sidecarExt) {
+			continue
+		}
+		path := filepath.Join(dir, strings.TrimSuffix(f.Name(), sidecarExt))
+		if known[path] {
+			continue
+		}
+		data, err := ioutil.ReadFile(sidecarPath(path))
+		if err != nil {
+			continue
+		}
+		var p Partial
+		if err := json.Unmarshal(data, &p); err != nil || p.URL == "" {
+			continue
+		}
+		// The files may have been moved, the sidecar location is what matters
+		p.Path = path
+		ret = append(ret, p)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Started.Before(ret[j].Started) })
+	return ret, nil
+}
+
+// findInterrupted returns the partial download in dir that will be saved
+// at path, and whether it was found.
+func findInterrupted(dir, path string) (Partial, bool) {
+	ps, err := Interrupted(dir)
+	if err != nil {
+		return Partial{}, false
+	}
+	for _, p := range ps {
+		if p.Path == path {
+			return p, true
+		}
+	}
+	return Partial{}, false
+}
+
+// Resume fetches an interrupted download in dir again, and queues it.
+// path is where the file will be saved, as in Partial.Path.
+// onDone works the same as for Add.
+func Resume(dir, path string, onDone func(Download)) (int, error) {
+	p, ok := findInterrupted(dir, path)
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	mu.Lock()
+	f := fetcher
+	mu.Unlock()
+	if f == nil {
+		return 0, ErrNoFetcher
+	}
+	body, meta, err := f(p.URL)
+	if err != nil {
+		return 0, err
+	}
+	return Add(p.URL, meta, p.Path, body, onDone), nil
+}
+
+// DeleteInterrupted removes the files of an interrupted download in dir.
+func DeleteInterrupted(dir, path string) error {
+	p, ok := findInterrupted(dir, path)
+	if !ok {
+		return ErrNotFound
+	}
+	removePartial(p.Path)
+	return nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/makeworld-the-better-one/amfora/client"
+	"github.com/makeworld-the-better-one/amfora/renderer"
+	"github.com/makeworld-the-better-one/go-gemini"
+	"github.com/muesli/termenv"
+	"github.com/spf13/viper"
+)
+
+const headlessUsage = `Usage:
+amfora fetch [--header | --render] [--follow] [--width N] [--color | --no-color] URL
+amfora render [--type MEDIATYPE] [--width N] [--color | --no-color] [FILE]
+
+Fetch requests the URL using the same TOFU database, client certificates, and
+proxies as the browser, and prints the body of the response. Use --header to
+print the status and meta instead, or --render to print the page the way the
+browser shows it. Redirects are only followed if --follow is used.
+
+Render prints a local file the way the browser shows it, or stdin if FILE is -
+or not given. The mediatype is guessed from the file name, or set with --type.
+
+Pages are wrapped to the max_width in the config, or to --width. Colors are
+used if they are enabled in the config and stdout is a terminal.
+
+Exit codes:
+0      Success
+1      Bad arguments, or a local error
+2      The URL couldn't be fetched
+3      The server's certificate isn't trusted, load the URL in the browser first
+10-69  The status of the response, if it isn't a success`
+
+// Exit codes for errors that aren't a response status.
+const (
+	exitError     = 1
+	exitFetch     = 2
+	exitUntrusted = 3
+)
+
+// Gemini allows 5 redirects in a row
+const maxRedirects = 5
+
+// headlessOptions are the flags shared by the fetch and render subcommands.
+type headlessOptions struct {
+	header    bool
+	render    bool
+	follow    bool
+	width     int
+	color     bool
+	mediatype string
+	arg       string // The URL or file
+}
+
+// parseHeadlessArgs parses the flags for fetch or render. Flags can come
+// before or after the URL or file.
+func parseHeadlessArgs(args []string) (*headlessOptions, bool) {
+	opts := &headlessOptions{
+		width: viper.GetInt("a-general.max_width"),
+		color: viper.GetBool("a-general.color") && termenv.ColorProfile() != termenv.Ascii,
+	}
+	argSet := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--header":
+			opts.header = true
+		case "--render":
+			opts.render = true
+		case "--follow":
+			opts.follow = true
+		case "--color":
+			opts.color = true
+		case "--no-color":
+			opts.color = false
+		case "--width", "--type":
+			if i+1 >= len(args) {
+				return nil, false
+			}
+			i++
+			if args[i-1] == "--type" {
+				opts.mediatype = args[i]
+				continue
+			}
+			w, err := strconv.Atoi(args[i])
+			if err != nil || w < 1 {
+				return nil, false
+			}
+			opts.width = w
+		default:
+			if argSet || (strings.HasPrefix(args[i], "-") && args[i] != "-") {
+				return nil, false
+			}
+			opts.arg = args[i]
+			argSet = true
+		}
+	}
+	if opts.header && opts.render {
+		return nil, false
+	}
+	return opts, true
+}
+
+// setColor sets up the renderer for printing with or without colors.
+func setColor(color bool) {
+	// The setting is only changed for this process, the config isn't saved
+	viper.Set("a-general.color", color)
+	if !color {
+		renderer.TermColor = ""
+		return
+	}
+	switch termenv.ColorProfile() {
+	case termenv.TrueColor:
+		renderer.TermColor = "terminal16m"
+	case termenv.ANSI:
+		renderer.TermColor = "terminal16"
+	default:
+		// Includes colors being forced when stdout isn't a terminal
+		renderer.TermColor = "terminal256"
+	}
+}
+
+// statusExitCode returns the exit code for a response status.
+func statusExitCode(status int) int {
+	if gemini.SimplifyStatus(status) == gemini.StatusSuccess {
+		return 0
+	}
+	return status
+}
+
+// headlessFetch fetches the URL like the browser does, using a proxy if one
+// is set for the scheme. It returns whether the URL was proxied.
+func headlessFetch(u string) (*gemini.Response, bool, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, false, err
+	}
+	proxy := strings.TrimSpace(viper.GetString("proxies." + parsed.Scheme))
+	if proxy == "" || proxy == "off" {
+		if parsed.Scheme != "gemini" && !client.IsNative(parsed.Scheme) &&
+			parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return nil, false, fmt.Errorf("unsupported scheme %s", parsed.Scheme) //nolint:goerr113
+		}
+		res, err := client.Fetch(u)
+		return res, parsed.Scheme != "gemini", err
+	}
+
+	proxyHostname, proxyPort, err := net.SplitHostPort(proxy)
+	if err != nil {
+		// Error likely means there's no port in the host
+		proxyHostname = proxy
+		proxyPort = "1965"
+	}
+	res, err := client.FetchWithProxy(proxyHostname, proxyPort, u)
+	return res, true, err
+}
+
+// printPage renders the response like the browser does and prints it.
+func printPage(u string, res *gemini.Response, opts *headlessOptions, proxied bool) int {
+	setColor(opts.color)
+	page, err := renderer.MakePage(u, res, opts.width, proxied)
+	if err != nil {
+		if errors.Is(err, renderer.ErrCantDisplay) {
+			fmt.Fprintf(os.Stderr, "Error rendering: %s can't be displayed\n", res.Meta)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error rendering: %v\n", err)
+		}
+		return exitError
+	}
+	fmt.Println(renderer.TagsToANSI(strings.TrimRight(page.Content, "\r\n"), opts.color))
+	return 0
+}
+
+// fetchCommand runs the fetch subcommand and returns the exit code.
+func fetchCommand(args []string) int {
+	opts, ok := parseHeadlessArgs(args)
+	if !ok || opts.arg == "" || opts.mediatype != "" {
+		fmt.Fprintln(os.Stderr, headlessUsage)
+		return exitError
+	}
+
+	u := client.NormalizeURL(client.FixUserURL(opts.arg))
+	for redirects := 0; ; redirects++ {
+		res, proxied, err := headlessFetch(u)
+		if errors.Is(err, client.ErrTofu) || errors.Is(err, client.ErrNotPinned) ||
+			errors.Is(err, client.ErrTitanUntrusted) {
+			if res != nil {
+				res.Body.Close()
+			}
+			fmt.Fprintf(os.Stderr, "Error fetching %s: %v\n", u, err)
+			return exitUntrusted
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching %s: %v\n", u, err)
+			return exitFetch
+		}
+
+		if opts.header {
+			res.Body.Close()
+			fmt.Printf("%d %s\n", res.Status, res.Meta)
+			return statusExitCode(res.Status)
+		}
+
+		switch gemini.SimplifyStatus(res.Status) {
+		case gemini.StatusSuccess:
+			if opts.render {
+				code := printPage(u, res, opts, proxied)
+				res.Body.Close()
+				return code
+			}
+			// Large files can take longer than the page timeout
+			client.SetReadTimeout(res, 0) //nolint:errcheck
+			_, err = io.Copy(os.Stdout, res.Body)
+			res.Body.Close()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading response: %v\n", err)
+				return exitFetch
+			}
+			return 0
+		case gemini.StatusRedirect:
+			res.Body.Close()
+			next, err := url.Parse(res.Meta)
+			base, _ := url.Parse(u)
+			if err != nil || base == nil {
+				fmt.Fprintf(os.Stderr, "Invalid redirect: %s\n", res.Meta)
+				return res.Status
+			}
+			target := client.NormalizeURL(base.ResolveReference(next).String())
+			if !opts.follow {
+				fmt.Fprintf(os.Stderr, "Redirect to %s\n", target)
+				return res.Status
+			}
+			if redirects >= maxRedirects {
+				fmt.Fprintln(os.Stderr, "Error: too many redirects")
+				return res.Status
+			}
+			u = target
+		default:
+			res.Body.Close()
+			// Like "51 Not found", or the input prompt
+			fmt.Fprintf(os.Stderr, "%d %s\n", res.Status, res.Meta)
+			return res.Status
+		}
+	}
+}
+
+// renderCommand runs the render subcommand and returns the exit code.
+func renderCommand(args []string) int {
+	opts, ok := parseHeadlessArgs(args)
+	if !ok || opts.header || opts.render || opts.follow {
+		fmt.Fprintln(os.Stderr, headlessUsage)
+		return exitError
+	}
+
+	r := io.Reader(os.Stdin)
+	mediatype := "text/gemini"
+	if opts.arg != "" && opts.arg != "-" {
+		f, err := os.Open(opts.arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening file: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		r = f
+		if m := renderer.FileMediatype(opts.arg); m != "" {
+			mediatype = m
+		}
+	}
+	if opts.mediatype != "" {
+		mediatype = opts.mediatype
+	}
+
+	// Rendered the same way as a response, so all mediatypes work the same
+	res := &gemini.Response{Status: gemini.StatusSuccess, Meta: mediatype, Body: io.NopCloser(r)}
+	return printPage("file://"+opts.arg, res, opts, false)
+}
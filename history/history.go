@@ -0,0 +1,268 @@
+// Package history keeps a record of the pages that were visited, across all
+// tabs and after restarts. It is stored as a JSON file.
+package history
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Only the most recent visit times are kept for each URL, the count has
+// the total.
+const maxVisits = 50
+
+// Entry is a visited URL.
+type Entry struct {
+	URL    string      `json:"url"`
+	Title  string      `json:"title,omitempty"` // The first heading of the page
+	Count  int         `json:"count"`           // How many times it was visited
+	Visits []time.Time `json:"visits"`          // Oldest first
+}
+
+// Last returns when the URL was last visited.
+func (e *Entry) Last() time.Time {
+	return e.Visits[len(e.Visits)-1]
+}
+
+// historyJSON is the format of the history file.
+type historyJSON struct {
+	Entries []*Entry `json:"entries"`
+}
+
+var entries = make(map[string]*Entry) // Map URL to entry
+var mu sync.Mutex
+var path string // The file history is saved to, empty if it isn't saved
+var maxAge = time.Duration(0)
+var excluded []string
+
+// SetMaxAge sets the max number of days visits are kept for.
+// A value <= 0 means forever.
+func SetMaxAge(days int) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if days <= 0 {
+		maxAge = time.Duration(0)
+		return
+	}
+	maxAge = time.Duration(days) * 24 * time.Hour
+}
+
+// SetExcluded sets the hosts that aren't recorded. Their subdomains aren't
+// recorded either.
+func SetExcluded(hosts []string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	excluded = make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		h = strings.Trim(strings.ToLower(strings.TrimSpace(h)), ".")
+		if h != "" {
+			excluded = append(excluded, h)
+		}
+	}
+}
+
+// Excluded returns whether the URL is on a host that isn't recorded.
+func Excluded(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if host == "" {
+		return false
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, h := range excluded {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// prune removes visits that are too old, and the entries that have no
+// visits left. The caller must hold mu.
+func prune() {
+	if maxAge == 0 {
+		return
+	}
+	cutoff := time.Now().Add(-maxAge)
+	for u, e := range entries {
+		i := sort.Search(len(e.Visits), func(i int) bool {
+			return e.Visits[i].After(cutoff)
+		})
+		if i == len(e.Visits) {
+			delete(entries, u)
+			continue
+		}
+		e.Visits = e.Visits[i:]
+	}
+}
+
+// Init loads the history saved in the file, and saves all future visits
+// there. It is fine if the file doesn't exist yet.
+func Init(historyPath string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	path = historyPath
+	entries = make(map[string]*Entry)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	var j historyJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	for _, e := range j.Entries {
+		if e == nil || e.URL == "" || len(e.Visits) == 0 {
+			continue
+		}
+		sort.Slice(e.Visits, func(i, k int) bool { return e.Visits[i].Before(e.Visits[k]) })
+		if e.Count < len(e.Visits) {
+			e.Count = len(e.Visits)
+		}
+		entries[e.URL] = e
+	}
+	prune()
+	return nil
+}
+
+// write saves the history to the file, if there is one.
+// The caller must hold mu.
+func write() error {
+	if path == "" {
+		return nil
+	}
+	j := historyJSON{Entries: make([]*Entry, 0, len(entries))}
+	for _, e := range entries {
+		j.Entries = append(j.Entries, e)
+	}
+	sort.Slice(j.Entries, func(i, k int) bool { return j.Entries[i].URL < j.Entries[k].URL })
+	data, err := json.MarshalIndent(&j, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Written to another file first, so a crash while saving doesn't lose
+	// the history
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Add records a visit to the URL now. The title is kept from the last
+// visit if it's empty. Nothing is recorded if the URL is excluded.
+func Add(u, title string) error {
+	if Excluded(u) {
+		return nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	e, ok := entries[u]
+	if !ok {
+		e = &Entry{URL: u}
+		entries[u] = e
+	}
+	if title != "" {
+		e.Title = title
+	}
+	e.Count++
+	e.Visits = append(e.Visits, time.Now())
+	if len(e.Visits) > maxVisits {
+		e.Visits = e.Visits[len(e.Visits)-maxVisits:]
+	}
+	prune()
+	return write()
+}
+
+// Delete removes the URL from the history.
+func Delete(u string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := entries[u]; !ok {
+		return nil
+	}
+	delete(entries, u)
+	return write()
+}
+
+// Clear removes the visits from the time range, including from and not to.
+// A zero time leaves that side of the range open, so Clear(time.Time{},
+// time.Time{}) removes everything. URLs that have no visits left are
+// removed.
+func Clear(from, to time.Time) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	inRange := func(v time.Time) bool {
+		return (from.IsZero() || !v.Before(from)) && (to.IsZero() || v.Before(to))
+	}
+	for u, e := range entries {
+		kept := e.Visits[:0]
+		for _, v := range e.Visits {
+			if !inRange(v) {
+				kept = append(kept, v)
+			}
+		}
+		if len(kept) == 0 {
+			delete(entries, u)
+			continue
+		}
+		e.Count -= len(e.Visits) - len(kept)
+		if e.Count < len(kept) {
+			e.Count = len(kept)
+		}
+		e.Visits = kept
+	}
+	return write()
+}
+
+// Search returns copies of the entries whose URL or title contain the
+// query, ignoring case, most recently visited first. An empty query
+// returns all of them.
+func Search(query string) []*Entry {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	results := make([]*Entry, 0)
+	for _, e := range entries {
+		if query != "" && !strings.Contains(strings.ToLower(e.URL), query) &&
+			!strings.Contains(strings.ToLower(e.Title), query) {
+			continue
+		}
+		c := *e
+		c.Visits = append([]time.Time(nil), e.Visits...)
+		results = append(results, &c)
+	}
+	sort.SliceStable(results, func(i, k int) bool {
+		if results[i].Last().Equal(results[k].Last()) {
+			return results[i].URL < results[k].URL
+		}
+		return results[i].Last().After(results[k].Last())
+	})
+	return results
+}
@@ -0,0 +1,69 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddSearch(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "history.json")
+	assert.NoError(t, Init(p))
+	SetExcluded(nil)
+
+	assert.NoError(t, Add("gemini://example.com/", "Example"))
+	assert.NoError(t, Add("gemini://example.com/", ""))
+	assert.NoError(t, Add("gemini://other.org/log.gmi", "Gemlog"))
+
+	all := Search("")
+	assert.Len(t, all, 2)
+	assert.Equal(t, "gemini://other.org/log.gmi", all[0].URL, "most recent first")
+	assert.Equal(t, 2, all[1].Count)
+	assert.Equal(t, "Example", all[1].Title, "title is kept")
+
+	assert.Len(t, Search("GEMLOG"), 1)
+	assert.Len(t, Search("example.com"), 1)
+	assert.Empty(t, Search("nothing"))
+
+	// Loaded from the file again
+	assert.NoError(t, Init(p))
+	assert.Len(t, Search(""), 2)
+
+	assert.NoError(t, Delete("gemini://example.com/"))
+	assert.Len(t, Search(""), 1)
+}
+
+func TestClear(t *testing.T) {
+	assert.NoError(t, Init(filepath.Join(t.TempDir(), "history.json")))
+
+	assert.NoError(t, Add("gemini://example.com/", ""))
+	mid := time.Now()
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, Add("gemini://example.com/", ""))
+	assert.NoError(t, Add("gemini://other.org/", ""))
+
+	// Only the visits since mid are removed
+	assert.NoError(t, Clear(mid, time.Time{}))
+	all := Search("")
+	assert.Len(t, all, 1)
+	assert.Equal(t, 1, all[0].Count)
+
+	assert.NoError(t, Clear(time.Time{}, time.Time{}))
+	assert.Empty(t, Search(""))
+}
+
+func TestExcluded(t *testing.T) {
+	assert.NoError(t, Init(""))
+	SetExcluded([]string{"Private.example", " .bank.com "})
+	defer SetExcluded(nil)
+
+	assert.True(t, Excluded("gemini://private.example/"))
+	assert.True(t, Excluded("https://www.bank.com/login"))
+	assert.False(t, Excluded("gemini://notbank.com/"))
+	assert.False(t, Excluded("about:newtab"))
+
+	assert.NoError(t, Add("gemini://sub.private.example/", ""))
+	assert.Empty(t, Search(""))
+}
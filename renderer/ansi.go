@@ -0,0 +1,180 @@
+package renderer
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"code.rocketnine.space/tslocum/cview"
+	"github.com/gdamore/tcell/v2"
+)
+
+// Regex for cview tags, in the order cview checks for them: escaped brackets,
+// regions, and colors. The patterns are the same as the ones in cview.
+var tagRegex = regexp.MustCompile(
+	`\[([a-zA-Z0-9_,;: \-\."#]+)\[(\[*)\]` +
+		`|\["[a-zA-Z0-9_,;: \-\.]*"\]` +
+		`|\[([a-zA-Z]+|#[0-9a-zA-Z]{6}|\-)?(:([a-zA-Z]+|#[0-9a-zA-Z]{6}|\-)?(:([bdilrsu]+|\-)?)?)?\]`,
+)
+
+// ansiColor returns the SGR parameters for a cview color. The base is 30
+// for the foreground and 40 for the background.
+func ansiColor(color string, base int) string {
+	if color == "" || color == "-" {
+		return ""
+	}
+	c := tcell.GetColor(color)
+	if c == tcell.ColorDefault || !c.Valid() {
+		return ""
+	}
+	if c.IsRGB() {
+		r, g, b := c.RGB()
+		return strconv.Itoa(base+8) + ";2;" + strconv.Itoa(int(r)) + ";" + strconv.Itoa(int(g)) + ";" + strconv.Itoa(int(b))
+	}
+	n := int(c - tcell.ColorValid)
+	if n < 8 {
+		return strconv.Itoa(base + n)
+	}
+	if n < 16 {
+		return strconv.Itoa(base + 60 + n - 8)
+	}
+	return strconv.Itoa(base+8) + ";5;" + strconv.Itoa(n)
+}
+
+// ansiStyle returns the escape codes for the style set by cview tags.
+// Everything is reset first, because cview tags don't add to each other.
+func ansiStyle(fg, bg, attrs string) string {
+	params := []string{"0"}
+	if p := ansiColor(fg, 30); p != "" {
+		params = append(params, p)
+	}
+	if p := ansiColor(bg, 40); p != "" {
+		params = append(params, p)
+	}
+	if attrs != "-" {
+		for _, a := range attrs {
+			switch a {
+			case 'b':
+				params = append(params, "1")
+			case 'd':
+				params = append(params, "2")
+			case 'i':
+				params = append(params, "3")
+			case 'u':
+				params = append(params, "4")
+			case 'l':
+				params = append(params, "5")
+			case 'r':
+				params = append(params, "7")
+			case 's':
+				params = append(params, "9")
+			}
+		}
+	}
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+// TagsToANSI converts text with cview color tags, like rendered pages, into
+// text with ANSI escape codes so it can be printed to a terminal. Region tags
+// are removed, and escaped brackets are unescaped. Lines end with \n.
+//
+// Set color to false to remove the color tags instead.
+func TagsToANSI(s string, color bool) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if !color {
+		return string(cview.StripTags([]byte(s), true, true))
+	}
+
+	var b strings.Builder
+	var fg, bg, attrs string
+	style := "" // Current escape code, empty if nothing is set
+	last := 0
+
+	text := func(t string) {
+		if style != "" {
+			// Reset at the end of each line, so colors don't fill the rest of it
+			t = strings.ReplaceAll(t, "\n", "\x1b[0m\n"+style)
+		}
+		b.WriteString(t)
+	}
+
+	for _, m := range tagRegex.FindAllStringSubmatchIndex(s, -1) {
+		text(s[last:m[0]])
+		last = m[1]
+		switch {
+		case m[2] >= 0:
+			// Escaped brackets, like [red[]
+			text("[" + s[m[2]:m[3]] + s[m[4]:m[5]] + "]")
+		case strings.HasPrefix(s[m[0]:], `["`):
+			// Region
+		case m[1]-m[0] == 2:
+			// [] isn't a tag
+			text("[]")
+		default:
+			if m[6] >= 0 && s[m[6]:m[7]] != "" {
+				fg = s[m[6]:m[7]]
+			}
+			if m[8] >= 0 && m[9]-m[8] > 1 && m[10] >= 0 {
+				bg = s[m[10]:m[11]]
+			}
+			if m[12] >= 0 && m[13]-m[12] > 1 && m[14] >= 0 {
+				attrs = s[m[14]:m[15]]
+			}
+			style = ansiStyle(fg, bg, attrs)
+			if style == "\x1b[0m" {
+				style = ""
+				b.WriteString("\x1b[0m")
+			} else {
+				b.WriteString(style)
+			}
+		}
+	}
+	text(s[last:])
+	if style != "" {
+		b.WriteString("\x1b[0m")
+	}
+	return b.String()
+}
+
+// VisibleText returns the text that is shown for s, which has cview tags,
+// like rendered pages. Tags are removed and escaped brackets are unescaped.
+//
+// It also returns where each byte of the text is in s. Before byte i of the
+// text, a tag can be added to s at starts[i], and after it at ends[i].
+// Escaped brackets are treated as one unit, so added tags never split them.
+func VisibleText(s string) (string, []int, []int) {
+	var b strings.Builder
+	starts := make([]int, 0, len(s))
+	ends := make([]int, 0, len(s))
+
+	// add adds visible text, that is made from s[start:end]
+	add := func(t string, start, end int, whole bool) {
+		b.WriteString(t)
+		for i := 0; i < len(t); i++ {
+			if whole {
+				starts = append(starts, start)
+				ends = append(ends, end)
+			} else {
+				starts = append(starts, start+i)
+				ends = append(ends, start+i+1)
+			}
+		}
+	}
+
+	last := 0
+	for _, m := range tagRegex.FindAllStringSubmatchIndex(s, -1) {
+		add(s[last:m[0]], last, m[0], false)
+		last = m[1]
+		switch {
+		case m[2] >= 0:
+			// Escaped brackets, like [red[]
+			add("["+s[m[2]:m[3]]+s[m[4]:m[5]]+"]", m[0], m[1], true)
+		case m[1]-m[0] == 2:
+			// [] isn't a tag
+			add("[]", m[0], m[1], false)
+		}
+		// Other tags aren't shown
+	}
+	add(s[last:], last, len(s), false)
+	return b.String(), starts, ends
+}
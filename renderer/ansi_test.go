@@ -0,0 +1,39 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+
+	"code.rocketnine.space/tslocum/cview"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagsToANSI(t *testing.T) {
+	assert.Equal(t, "\x1b[0;31mred\x1b[0m plain", TagsToANSI("[maroon]red[-] plain", true))
+	assert.Equal(t, "\x1b[0;38;2;255;0;0;44;1mbold\x1b[0m", TagsToANSI("[#ff0000:navy:b]bold", true))
+	// Tags add to the style, like in cview
+	assert.Equal(t, "\x1b[0;91m\x1b[0;91;4mu\x1b[0m", TagsToANSI("[red][::u]u", true))
+	// Colors are reset at the end of each line
+	assert.Equal(t, "\x1b[0;97ma\x1b[0m\n\x1b[0;97mb\x1b[0m", TagsToANSI("[white]a\r\nb", true))
+	assert.Equal(t, "[1] link", TagsToANSI(`["0"][1] link[""]`, true))
+	assert.Equal(t, "[red] [] [x]", TagsToANSI(cview.Escape("[red] [] [x]"), true))
+}
+
+func TestTagsToANSINoColor(t *testing.T) {
+	assert.Equal(t, "red [x]\nlink", TagsToANSI(`[red]red[-] `+cview.Escape("[x]")+"\r\n[\"1\"]link[\"\"]", false))
+}
+
+func TestVisibleText(t *testing.T) {
+	s := `[red]a[-] ["0"]` + cview.Escape("[x]") + `[""] []`
+	text, starts, ends := VisibleText(s)
+	assert.Equal(t, "a [x] []", text)
+	assert.Len(t, starts, len(text))
+	assert.Len(t, ends, len(text))
+
+	assert.Equal(t, "a", s[starts[0]:ends[0]])
+	// The escaped brackets are kept whole
+	x := strings.Index(text, "x")
+	assert.Equal(t, cview.Escape("[x]"), s[starts[x]:ends[x]])
+	assert.Equal(t, starts[x], starts[x-1])
+	assert.Equal(t, "[]", s[starts[len(text)-2]:ends[len(text)-1]])
+}
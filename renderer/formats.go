@@ -0,0 +1,522 @@
+package renderer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"mime"
+	urlPkg "net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/makeworld-the-better-one/amfora/structs"
+	"github.com/mattn/go-runewidth"
+)
+
+// Text formats that are rendered by converting them to text/gemini first,
+// so that links are numbered and code is highlighted the same way.
+
+// convertedMediatypes maps mediatypes sent by servers to the formats that
+// are converted to text/gemini.
+var convertedMediatypes = map[string]structs.Mediatype{
+	"text/markdown":             structs.TextMarkdown,
+	"text/x-markdown":           structs.TextMarkdown,
+	"text/csv":                  structs.TextCSV,
+	"text/tab-separated-values": structs.TextTSV,
+	"text/gophermap":            structs.TextGophermap,
+	"application/gopher-menu":   structs.TextGophermap,
+	"text/html":                 structs.TextHTML,
+	"application/xhtml+xml":     structs.TextHTML,
+}
+
+// ConvertedMediatype returns the format for a mediatype that is converted
+// to text/gemini for rendering, and whether there is one.
+func ConvertedMediatype(mediatype string) (structs.Mediatype, bool) {
+	m, ok := convertedMediatypes[strings.ToLower(mediatype)]
+	return m, ok
+}
+
+// FileMediatype returns the mediatype of a local file, from its name.
+func FileMediatype(path string) string {
+	if filepath.Base(path) == "gophermap" {
+		return "text/gophermap"
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gmi", ".gemini":
+		return "text/gemini"
+	case ".md", ".markdown":
+		return "text/markdown"
+	case ".csv":
+		return "text/csv"
+	case ".tsv":
+		return "text/tab-separated-values"
+	}
+	mediatype, _, _ := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(path)))
+	return mediatype
+}
+
+// ToGemini converts text in one of the converted formats to text/gemini.
+// Text in other formats is returned unchanged.
+func ToGemini(mediatype structs.Mediatype, s string) string {
+	switch mediatype {
+	case structs.TextMarkdown:
+		return MarkdownToGemini(s)
+	case structs.TextCSV:
+		return TableToGemini(s, ',')
+	case structs.TextTSV:
+		return TableToGemini(s, '\t')
+	case structs.TextGophermap:
+		return GophermapToGemini(s)
+	case structs.TextHTML:
+		return HTMLToGemini(s)
+	}
+	return s
+}
+
+// formatTable lays out rows of cells as an aligned table, with a line
+// under the first row.
+func formatTable(rows [][]string) string {
+	widths := make([]int, 0)
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := runewidth.StringWidth(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	var b strings.Builder
+	for r, row := range rows {
+		cells := make([]string, len(widths))
+		for i := range widths {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			cells[i] = runewidth.FillRight(cell, widths[i])
+		}
+		b.WriteString(strings.TrimRight(strings.Join(cells, " │ "), " "))
+		b.WriteString("\n")
+
+		if r == 0 && len(rows) > 1 {
+			lines := make([]string, len(widths))
+			for i, w := range widths {
+				lines[i] = strings.Repeat("─", w)
+			}
+			b.WriteString(strings.Join(lines, "─┼─"))
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// absURLRegex matches cells that are just an absolute URL.
+var absURLRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*://\S+$`)
+
+// TableToGemini converts CSV or TSV data to an aligned table in a
+// preformatted block. Cells that are URLs are added as links after the table.
+func TableToGemini(s string, comma rune) string {
+	r := csv.NewReader(strings.NewReader(s))
+	r.Comma = comma
+	r.FieldsPerRecord = -1 // Rows can have different lengths
+	r.LazyQuotes = true
+	if comma == '\t' {
+		// TSV doesn't use quotes
+		r.LazyQuotes = false
+	}
+
+	rows := make([][]string, 0)
+	links := make([]string, 0)
+	seen := make(map[string]bool)
+	for {
+		row, err := r.Read()
+		if err != nil {
+			// EOF, or the rest can't be parsed
+			break
+		}
+		for i := range row {
+			row[i] = strings.TrimSpace(strings.ReplaceAll(row[i], "\n", " "))
+			if absURLRegex.MatchString(row[i]) && !seen[row[i]] {
+				seen[row[i]] = true
+				links = append(links, row[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		// Not valid, show it as it is
+		return "```\n" + s + "\n```\n"
+	}
+
+	ret := "```\n" + formatTable(rows) + "```\n"
+	if len(links) > 0 {
+		ret += "\n"
+		for _, l := range links {
+			ret += "=> " + l + "\n"
+		}
+	}
+	return ret
+}
+
+// gopherURL returns the URL for a gophermap item.
+func gopherURL(itemType byte, selector, host, port string) string {
+	if itemType == 'h' && strings.HasPrefix(selector, "URL:") {
+		// Link to a non-gopher URL
+		return selector[4:]
+	}
+	if port != "" && port != "70" {
+		host += ":" + port
+	}
+	if itemType == '8' || itemType == 'T' {
+		return "telnet://" + host
+	}
+	u := urlPkg.URL{
+		Scheme: "gopher",
+		Host:   host,
+		Path:   "/" + string(itemType) + selector,
+	}
+	return u.String()
+}
+
+// GophermapToGemini converts a gopher menu to text/gemini. Information
+// lines are put in preformatted blocks, because they're often ASCII art.
+func GophermapToGemini(s string) string {
+	var b strings.Builder
+	info := make([]string, 0) // Information lines waiting to be added
+
+	flushInfo := func() {
+		if len(info) == 0 {
+			return
+		}
+		b.WriteString("```\n")
+		for _, line := range info {
+			b.WriteString(line + "\n")
+		}
+		b.WriteString("```\n")
+		info = info[:0]
+	}
+
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "." {
+			// End of the menu
+			break
+		}
+		if line == "" {
+			info = append(info, "")
+			continue
+		}
+
+		itemType := line[0]
+		fields := strings.Split(line[1:], "\t")
+		if itemType == 'i' || itemType == '3' || len(fields) < 3 || fields[2] == "" || fields[2] == "(NULL)" {
+			// Information, errors, and lines that aren't items
+			if len(fields) < 2 && itemType != 'i' && itemType != '3' {
+				// Not a menu item at all, just text
+				info = append(info, line)
+			} else {
+				info = append(info, fields[0])
+			}
+			continue
+		}
+
+		flushInfo()
+		port := ""
+		if len(fields) > 3 {
+			port = strings.TrimSpace(fields[3])
+		}
+		text := fields[0]
+		if strings.TrimSpace(text) == "" {
+			text = fields[1]
+		}
+		fmt.Fprintf(&b, "=> %s %s\n", gopherURL(itemType, fields[1], fields[2], port), text)
+	}
+	flushInfo()
+	return b.String()
+}
+
+// Markdown
+
+var (
+	mdFenceRegex   = regexp.MustCompile("^ {0,3}(```+|~~~+)\\s*([^`\\s]*)")
+	mdHeadingRegex = regexp.MustCompile(`^ {0,3}(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	mdSetext1Regex = regexp.MustCompile(`^ {0,3}=+\s*$`)
+	mdSetext2Regex = regexp.MustCompile(`^ {0,3}-+\s*$`)
+	mdRuleRegex    = regexp.MustCompile(`^ {0,3}(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	mdQuoteRegex   = regexp.MustCompile(`^ {0,3}> ?(.*)$`)
+	mdListRegex    = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	mdRefDefRegex  = regexp.MustCompile(`^ {0,3}\[([^\]]+)\]:\s*<?(\S+?)>?(?:\s+.*)?$`)
+	mdTableSep     = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(?:\|\s*:?-+:?\s*)*\|?\s*$`)
+
+	mdCodeSpan    = regexp.MustCompile("`+([^`]+)`+")
+	mdInlineLink  = regexp.MustCompile(`(!?)\[([^\]]*)\]\(\s*<?([^\s)>]+)>?(?:\s+"[^"]*")?\s*\)`)
+	mdRefLink     = regexp.MustCompile(`(!?)\[([^\]]+)\]\[([^\]]*)\]`)
+	mdAutoLink    = regexp.MustCompile(`<([a-zA-Z][a-zA-Z0-9+.-]*:[^\s>]+)>`)
+	mdStrong      = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	mdEmphasis    = regexp.MustCompile(`(^|[^\w*])[*_](\S(?:.*?\S)?)[*_]([^\w*]|$)`)
+	mdStrike      = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	mdEscape      = regexp.MustCompile(`\\([\\` + "`" + `*_{}\[\]()#+\-.!|>~])`)
+	mdPlaceholder = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// mdLink is a link found in Markdown text.
+type mdLink struct {
+	url  string
+	text string
+}
+
+// mdInline converts inline Markdown to plain text, and returns the links in it.
+func mdInline(s string, refs map[string]string) (string, []mdLink) {
+	links := make([]mdLink, 0)
+
+	// Code spans are kept as they are, so they're taken out first
+	codes := make([]string, 0)
+	s = mdCodeSpan.ReplaceAllStringFunc(s, func(m string) string {
+		codes = append(codes, strings.TrimSpace(mdCodeSpan.FindStringSubmatch(m)[1]))
+		return fmt.Sprintf("\x00%d\x00", len(codes)-1)
+	})
+
+	addLink := func(image bool, text, url string) string {
+		text = strings.TrimSpace(text)
+		linkText := text
+		if linkText == "" {
+			linkText = url
+		}
+		if image {
+			linkText = "Image: " + linkText
+		}
+		links = append(links, mdLink{url: url, text: linkText})
+		return text
+	}
+	s = mdInlineLink.ReplaceAllStringFunc(s, func(m string) string {
+		sm := mdInlineLink.FindStringSubmatch(m)
+		return addLink(sm[1] == "!", sm[2], sm[3])
+	})
+	s = mdRefLink.ReplaceAllStringFunc(s, func(m string) string {
+		sm := mdRefLink.FindStringSubmatch(m)
+		ref := sm[3]
+		if ref == "" {
+			ref = sm[2]
+		}
+		url, ok := refs[strings.ToLower(ref)]
+		if !ok {
+			return m
+		}
+		return addLink(sm[1] == "!", sm[2], url)
+	})
+	s = mdAutoLink.ReplaceAllStringFunc(s, func(m string) string {
+		url := mdAutoLink.FindStringSubmatch(m)[1]
+		return addLink(false, url, url)
+	})
+
+	s = mdStrong.ReplaceAllString(s, "$2")
+	s = mdEmphasis.ReplaceAllString(s, "$1$2$3")
+	s = mdStrike.ReplaceAllString(s, "$1")
+	s = mdEscape.ReplaceAllString(s, "$1")
+
+	s = mdPlaceholder.ReplaceAllStringFunc(s, func(m string) string {
+		var i int
+		fmt.Sscanf(mdPlaceholder.FindStringSubmatch(m)[1], "%d", &i) //nolint:errcheck
+		return codes[i]
+	})
+	return s, links
+}
+
+// splitTableRow splits a Markdown table row into cells.
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+	cells := strings.Split(line, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// MarkdownToGemini converts Markdown to text/gemini. Paragraphs are joined
+// into single lines, and links are put on their own lines after the
+// paragraph, list item, or table they're in. Code blocks keep their language,
+// so they're highlighted.
+func MarkdownToGemini(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+
+	// Find reference link definitions first, they can be anywhere
+	refs := make(map[string]string)
+	for _, line := range lines {
+		if m := mdRefDefRegex.FindStringSubmatch(line); m != nil {
+			refs[strings.ToLower(m[1])] = m[2]
+		}
+	}
+
+	var b strings.Builder
+	para := make([]string, 0) // Lines of the current paragraph
+	paraPrefix := ""          // Added to the start of the paragraph, for list items
+	table := make([][]string, 0)
+	pending := make([]mdLink, 0) // Links to add after the current block
+
+	writeLinks := func() {
+		for _, l := range pending {
+			fmt.Fprintf(&b, "=> %s %s\n", l.url, l.text)
+		}
+		pending = pending[:0]
+	}
+	flushPara := func() {
+		if len(para) > 0 {
+			text, links := mdInline(strings.Join(para, " "), refs)
+			b.WriteString(paraPrefix + text + "\n")
+			pending = append(pending, links...)
+			para = para[:0]
+		}
+		paraPrefix = ""
+		writeLinks()
+	}
+	flushTable := func() {
+		if len(table) == 0 {
+			return
+		}
+		for _, row := range table {
+			for i := range row {
+				var links []mdLink
+				row[i], links = mdInline(row[i], refs)
+				pending = append(pending, links...)
+			}
+		}
+		b.WriteString("```\n" + formatTable(table) + "```\n")
+		table = table[:0]
+		writeLinks()
+	}
+
+	fence := ""       // The fence that opened the current code block
+	indented := false // In an indented code block
+	prevBlank := true
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		raw := lines[i]
+
+		if fence != "" {
+			if m := mdFenceRegex.FindStringSubmatch(line); m != nil &&
+				m[1][0] == fence[0] && len(m[1]) >= len(fence) && m[2] == "" {
+				b.WriteString("```\n")
+				fence = ""
+				continue
+			}
+			if strings.HasPrefix(raw, "```") {
+				// It would end the block early
+				raw = " " + raw
+			}
+			b.WriteString(raw + "\n")
+			continue
+		}
+
+		if indented {
+			if strings.HasPrefix(raw, "    ") || strings.HasPrefix(raw, "\t") || line == "" {
+				b.WriteString(strings.TrimPrefix(strings.TrimPrefix(raw, "\t"), "    ") + "\n")
+				continue
+			}
+			b.WriteString("```\n")
+			indented = false
+		}
+
+		if len(table) > 0 && !strings.Contains(line, "|") {
+			flushTable()
+		}
+
+		switch {
+		case line == "":
+			flushPara()
+			b.WriteString("\n")
+		case mdFenceRegex.MatchString(line):
+			flushPara()
+			m := mdFenceRegex.FindStringSubmatch(line)
+			fence = m[1]
+			b.WriteString("```" + m[2] + "\n")
+		case prevBlank && len(para) == 0 && (strings.HasPrefix(raw, "    ") || strings.HasPrefix(raw, "\t")):
+			indented = true
+			b.WriteString("```\n")
+			b.WriteString(strings.TrimPrefix(strings.TrimPrefix(raw, "\t"), "    ") + "\n")
+		case mdRefDefRegex.MatchString(line):
+			// Already used
+			flushPara()
+		case len(para) > 0 && paraPrefix == "" && mdSetext1Regex.MatchString(line):
+			paraPrefix = "# "
+			flushPara()
+		case len(para) > 0 && paraPrefix == "" && mdSetext2Regex.MatchString(line):
+			paraPrefix = "## "
+			flushPara()
+		case mdRuleRegex.MatchString(line):
+			flushPara()
+			b.WriteString(strings.Repeat("─", 20) + "\n")
+		case mdHeadingRegex.MatchString(line):
+			flushPara()
+			m := mdHeadingRegex.FindStringSubmatch(line)
+			level := len(m[1])
+			if level > 3 {
+				level = 3
+			}
+			para = append(para, m[2])
+			paraPrefix = strings.Repeat("#", level) + " "
+			flushPara()
+		case mdQuoteRegex.MatchString(line):
+			flushPara()
+			text, links := mdInline(mdQuoteRegex.FindStringSubmatch(line)[1], refs)
+			b.WriteString("> " + text + "\n")
+			// Links are added after the whole quote
+			pending = append(pending, links...)
+			if i+1 >= len(lines) || !mdQuoteRegex.MatchString(lines[i+1]) {
+				writeLinks()
+			}
+		case strings.HasPrefix(strings.TrimSpace(line), "|") ||
+			(len(table) > 0 && strings.Contains(line, "|")) ||
+			(strings.Contains(line, "|") && i+1 < len(lines) && mdTableSep.MatchString(lines[i+1]) &&
+				strings.Contains(lines[i+1], "-")):
+			if len(para) > 0 {
+				flushPara()
+			}
+			if mdTableSep.MatchString(line) && strings.Contains(line, "-") {
+				// The line under the header
+				break
+			}
+			table = append(table, splitTableRow(line))
+		case mdListRegex.MatchString(line):
+			flushPara()
+			m := mdListRegex.FindStringSubmatch(line)
+			indent := strings.Repeat("  ", len(strings.ReplaceAll(m[1], "\t", "    "))/2)
+			if m[2] == "-" || m[2] == "*" || m[2] == "+" {
+				if indent == "" {
+					paraPrefix = "* "
+				} else {
+					// Nested lists can't be made in gemtext, so they're indented text
+					paraPrefix = indent + "• "
+				}
+			} else {
+				paraPrefix = indent + m[2] + " "
+			}
+			para = append(para, m[3])
+		default:
+			if strings.HasSuffix(raw, "  ") || strings.HasSuffix(line, "\\") {
+				// Hard line break
+				para = append(para, strings.TrimSuffix(strings.TrimSpace(line), "\\"))
+				text, links := mdInline(strings.Join(para, " "), refs)
+				b.WriteString(paraPrefix + text + "\n")
+				pending = append(pending, links...)
+				para = para[:0]
+				paraPrefix = ""
+				break
+			}
+			para = append(para, strings.TrimSpace(line))
+		}
+		prevBlank = line == ""
+	}
+
+	flushTable()
+	flushPara()
+	if fence != "" || indented {
+		b.WriteString("```\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,109 @@
+package renderer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkdownToGemini(t *testing.T) {
+	md := "Title\n" +
+		"=====\n" +
+		"\n" +
+		"Some **bold** text with [a link](gemini://example.com/) and\n" +
+		"`[not a link](x)` in it.\n" +
+		"\n" +
+		"#### Deep heading\n" +
+		"\n" +
+		"- one\n" +
+		"- two [ref][r]\n" +
+		"\n" +
+		"> quoted\n" +
+		"\n" +
+		"```go\n" +
+		"func main() {}\n" +
+		"```\n" +
+		"\n" +
+		"[r]: https://example.org/ref\n"
+
+	expected := "# Title\n" +
+		"\n" +
+		"Some bold text with a link and [not a link](x) in it.\n" +
+		"=> gemini://example.com/ a link\n" +
+		"\n" +
+		"### Deep heading\n" +
+		"\n" +
+		"* one\n" +
+		"* two ref\n" +
+		"=> https://example.org/ref ref\n" +
+		"\n" +
+		"> quoted\n" +
+		"\n" +
+		"```go\n" +
+		"func main() {}\n" +
+		"```\n" +
+		"\n" +
+		"\n"
+	assert.Equal(t, expected, MarkdownToGemini(md))
+}
+
+func TestMarkdownTable(t *testing.T) {
+	md := "| Name | Size |\n|---|---:|\n| a | 1 |\n| bbb | 22 |\n"
+	expected := "```\n" +
+		"Name │ Size\n" +
+		"─────┼─────\n" +
+		"a    │ 1\n" +
+		"bbb  │ 22\n" +
+		"```\n" +
+		"\n"
+	assert.Equal(t, expected, MarkdownToGemini(md))
+}
+
+func TestTableToGemini(t *testing.T) {
+	csv := "name,url\nfoo,gemini://foo.example/\n\"b, ar\",x\n"
+	expected := "```\n" +
+		"name  │ url\n" +
+		"──────┼──────────────────────\n" +
+		"foo   │ gemini://foo.example/\n" +
+		"b, ar │ x\n" +
+		"```\n" +
+		"\n" +
+		"=> gemini://foo.example/\n"
+	assert.Equal(t, expected, TableToGemini(csv, ','))
+
+	tsv := "a\tb\n1\t2\n"
+	assert.Equal(t, "```\na │ b\n──┼──\n1 │ 2\n```\n", TableToGemini(tsv, '\t'))
+}
+
+func TestGophermapToGemini(t *testing.T) {
+	gm := "iWelcome\t\terror.host\t1\r\n" +
+		"1Menu\t/menu\texample.com\t70\r\n" +
+		"0Text file\t/file.txt\texample.com\t7070\r\n" +
+		"hWeb\tURL:https://example.org/\texample.com\t70\r\n" +
+		"7Search\t/search\texample.com\t70\r\n" +
+		".\r\n" +
+		"iIgnored\t\terror.host\t1\r\n"
+	expected := "```\nWelcome\n```\n" +
+		"=> gopher://example.com/1/menu Menu\n" +
+		"=> gopher://example.com:7070/0/file.txt Text file\n" +
+		"=> https://example.org/ Web\n" +
+		"=> gopher://example.com/7/search Search\n"
+	assert.Equal(t, expected, GophermapToGemini(gm))
+}
+
+func TestSearchableText(t *testing.T) {
+	text, ok := SearchableText("", []byte("# Title"))
+	assert.True(t, ok, "empty meta is gemtext")
+	assert.Equal(t, "# Title", text)
+
+	text, ok = SearchableText("text/markdown; charset=utf-8", []byte("Title\n====="))
+	assert.True(t, ok)
+	assert.Equal(t, "# Title\n", text, "converted formats are searched as gemtext")
+
+	text, ok = SearchableText("text/plain; charset=iso-8859-1", []byte("caf\xe9"))
+	assert.True(t, ok)
+	assert.Equal(t, "café", text)
+
+	_, ok = SearchableText("image/png", []byte("\x89PNG"))
+	assert.False(t, ok)
+}
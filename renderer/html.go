@@ -0,0 +1,269 @@
+package renderer
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlConverter converts HTML to text/gemini. Only the structure of simple
+// pages is kept: headings, paragraphs, lists, quotes, preformatted text,
+// and links, which are put on their own lines after the block they're in.
+type htmlConverter struct {
+	out       strings.Builder
+	text      strings.Builder // Inline text of the current block
+	prefix    string          // Added to the start of the current block, like "# "
+	links     []mdLink        // Links in the current block
+	quote     int             // Depth of blockquotes
+	lists     []int           // Stack of lists, the next item number or -1 for unordered
+	lastBlank bool
+}
+
+// blank adds an empty line, unless there already is one.
+func (c *htmlConverter) blank() {
+	if !c.lastBlank && c.out.Len() > 0 {
+		c.out.WriteString("\n")
+		c.lastBlank = true
+	}
+}
+
+// line adds a line of text to the output.
+func (c *htmlConverter) line(s string) {
+	c.out.WriteString(s + "\n")
+	c.lastBlank = false
+}
+
+// flush adds the current block to the output, followed by its links.
+func (c *htmlConverter) flush() {
+	text := strings.Join(strings.Fields(c.text.String()), " ")
+	c.text.Reset()
+	if text != "" {
+		if c.prefix == "" && (strings.HasPrefix(text, "=>") || strings.HasPrefix(text, "```") ||
+			strings.HasPrefix(text, "#") || strings.HasPrefix(text, "* ") || strings.HasPrefix(text, ">")) {
+			// It would be parsed as another kind of line
+			text = " " + text
+		}
+		if c.quote > 0 {
+			c.line("> " + c.prefix + text)
+		} else {
+			c.line(c.prefix + text)
+		}
+	}
+	c.prefix = ""
+	for _, l := range c.links {
+		c.line("=> " + l.url + " " + l.text)
+	}
+	c.links = c.links[:0]
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// nodeText returns all the text inside the node, as it is.
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if ch.Type == html.ElementNode && ch.DataAtom == atom.Br {
+			b.WriteString("\n")
+			continue
+		}
+		b.WriteString(nodeText(ch))
+	}
+	return b.String()
+}
+
+// preLanguage returns the language of the code in a pre element, from a
+// class like "language-go", so it can be highlighted.
+func preLanguage(n *html.Node) string {
+	classes := attr(n, "class")
+	if code := n.FirstChild; code != nil && code.Type == html.ElementNode && code.DataAtom == atom.Code {
+		classes += " " + attr(code, "class")
+	}
+	for _, class := range strings.Fields(classes) {
+		if strings.HasPrefix(class, "language-") {
+			return strings.TrimPrefix(class, "language-")
+		}
+		if strings.HasPrefix(class, "lang-") {
+			return strings.TrimPrefix(class, "lang-")
+		}
+	}
+	return ""
+}
+
+func (c *htmlConverter) children(n *html.Node) {
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		c.walk(ch)
+	}
+}
+
+// block walks an element that starts a new block.
+func (c *htmlConverter) block(n *html.Node, prefix string) {
+	c.flush()
+	c.prefix = prefix
+	c.children(n)
+	c.flush()
+}
+
+//nolint:exhaustive
+func (c *htmlConverter) walk(n *html.Node) {
+	if n.Type == html.TextNode {
+		c.text.WriteString(n.Data)
+		return
+	}
+	if n.Type != html.ElementNode {
+		c.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Template, atom.Noscript, atom.Svg, atom.Iframe,
+		atom.Select, atom.Button, atom.Input, atom.Textarea, atom.Object, atom.Video, atom.Audio:
+		// Not shown
+	case atom.H1:
+		c.blank()
+		c.block(n, "# ")
+		c.blank()
+	case atom.H2:
+		c.blank()
+		c.block(n, "## ")
+		c.blank()
+	case atom.H3, atom.H4, atom.H5, atom.H6:
+		c.blank()
+		c.block(n, "### ")
+		c.blank()
+	case atom.P, atom.Figure, atom.Table, atom.Dl, atom.Details, atom.Form:
+		c.blank()
+		c.block(n, "")
+		c.blank()
+	case atom.Br:
+		c.flush()
+	case atom.Hr:
+		c.flush()
+		c.blank()
+		c.line(strings.Repeat("─", 20))
+		c.blank()
+	case atom.Pre:
+		c.flush()
+		c.blank()
+		c.line("```" + preLanguage(n))
+		for _, l := range strings.Split(strings.TrimRight(nodeText(n), "\n"), "\n") {
+			if strings.HasPrefix(l, "```") {
+				// It would end the block early
+				l = " " + l
+			}
+			c.line(l)
+		}
+		c.line("```")
+		c.blank()
+	case atom.Blockquote:
+		c.flush()
+		c.blank()
+		c.quote++
+		c.children(n)
+		c.flush()
+		c.quote--
+		c.blank()
+	case atom.Ul, atom.Ol, atom.Menu:
+		c.flush()
+		if len(c.lists) == 0 {
+			c.blank()
+		}
+		next := -1
+		if n.DataAtom == atom.Ol {
+			next = 1
+			if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+				next = start
+			}
+		}
+		c.lists = append(c.lists, next)
+		c.children(n)
+		c.flush()
+		c.lists = c.lists[:len(c.lists)-1]
+		if len(c.lists) == 0 {
+			c.blank()
+		}
+	case atom.Li:
+		prefix := "* "
+		if len(c.lists) > 0 {
+			depth := len(c.lists) - 1
+			if next := c.lists[depth]; next >= 0 {
+				// Gemtext doesn't have numbered lists, so it's just text
+				prefix = strings.Repeat("  ", depth) + strconv.Itoa(next) + ". "
+				c.lists[depth]++
+			} else if depth > 0 {
+				prefix = strings.Repeat("  ", depth) + "• "
+			}
+		}
+		c.block(n, prefix)
+	case atom.Tr:
+		c.flush()
+		cells := make([]string, 0)
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			if ch.Type == html.ElementNode && (ch.DataAtom == atom.Td || ch.DataAtom == atom.Th) {
+				start := c.text.Len()
+				c.children(ch)
+				cells = append(cells, strings.TrimSpace(c.text.String()[start:]))
+				// Links are kept, but the text is put back together below
+				c.text.Reset()
+				c.text.WriteString(strings.Join(cells, " │ "))
+			}
+		}
+		c.flush()
+	case atom.A:
+		start := c.text.Len()
+		c.children(n)
+		href := strings.TrimSpace(attr(n, "href"))
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			return
+		}
+		text := strings.Join(strings.Fields(c.text.String()[start:]), " ")
+		if text == "" {
+			text = href
+		}
+		c.links = append(c.links, mdLink{url: strings.ReplaceAll(href, " ", "%20"), text: text})
+	case atom.Img:
+		src := strings.TrimSpace(attr(n, "src"))
+		if src == "" || strings.HasPrefix(src, "data:") {
+			return
+		}
+		alt := strings.TrimSpace(attr(n, "alt"))
+		if alt == "" {
+			alt = "Image"
+		} else {
+			alt = "Image: " + alt
+		}
+		c.links = append(c.links, mdLink{url: strings.ReplaceAll(src, " ", "%20"), text: alt})
+	case atom.Div, atom.Section, atom.Article, atom.Main, atom.Header, atom.Footer, atom.Nav, atom.Aside,
+		atom.Address, atom.Figcaption, atom.Caption, atom.Dt, atom.Dd, atom.Summary, atom.Fieldset,
+		atom.Center, atom.Body, atom.Html:
+		c.block(n, "")
+	default:
+		// Inline elements
+		c.children(n)
+	}
+}
+
+// HTMLToGemini converts simple HTML to text/gemini. Anything that can't be
+// shown in gemtext, like styles, scripts, and forms, is left out.
+func HTMLToGemini(s string) string {
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		// The parser doesn't return errors for bad HTML, only for reading
+		return "```\n" + s + "\n```\n"
+	}
+	c := &htmlConverter{lastBlank: true}
+	c.walk(doc)
+	c.flush()
+	return strings.TrimRight(c.out.String(), "\n") + "\n"
+}
@@ -0,0 +1,58 @@
+package renderer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTMLToGemini(t *testing.T) {
+	page := `<!DOCTYPE html>
+<html><head><title>Title</title><style>p { color: red; }</style></head>
+<body>
+<nav><a href="/">Home</a></nav>
+<h1>A   post</h1>
+<p>Some <b>bold</b> text with
+<a href="/other">a link</a> in it.<script>alert(1)</script></p>
+<h4>Small heading</h4>
+<ul><li>One</li><li>Two <a href="https://example.com/">ex</a></li></ul>
+<ol start="3"><li>Three</li></ol>
+<blockquote><p>Quoted</p></blockquote>
+<pre><code class="language-go">func main() {
+	fmt.Println("&lt;hi&gt;")
+}</code></pre>
+<p>#notaheading <img src="/cat.png" alt="A cat"></p>
+<table><tr><th>A</th><th>B</th></tr><tr><td>1</td><td>2</td></tr></table>
+</body></html>`
+
+	expected := "Home\n" +
+		"=> / Home\n" +
+		"\n" +
+		"# A post\n" +
+		"\n" +
+		"Some bold text with a link in it.\n" +
+		"=> /other a link\n" +
+		"\n" +
+		"### Small heading\n" +
+		"\n" +
+		"* One\n" +
+		"* Two ex\n" +
+		"=> https://example.com/ ex\n" +
+		"\n" +
+		"3. Three\n" +
+		"\n" +
+		"> Quoted\n" +
+		"\n" +
+		"```go\n" +
+		"func main() {\n" +
+		"\tfmt.Println(\"<hi>\")\n" +
+		"}\n" +
+		"```\n" +
+		"\n" +
+		" #notaheading\n" +
+		"=> /cat.png Image: A cat\n" +
+		"\n" +
+		"A │ B\n" +
+		"1 │ 2\n"
+	assert.Equal(t, expected, HTMLToGemini(page))
+}
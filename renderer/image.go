@@ -0,0 +1,327 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // Register decoders
+	_ "image/jpeg"
+	"image/png"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Ways of displaying images inline, from "a-general.images" in config.
+const (
+	ImagesOff       = "off"
+	ImagesHalfBlock = "halfblock" // Unicode half blocks, two pixels per cell
+	ImagesSixel     = "sixel"
+	ImagesKitty     = "kitty" // The kitty terminal graphics protocol
+)
+
+// ImageMode returns the configured way of displaying images inline.
+func ImageMode() string {
+	switch m := strings.ToLower(viper.GetString("a-general.images")); m {
+	case ImagesHalfBlock, ImagesSixel, ImagesKitty:
+		return m
+	}
+	return ImagesOff
+}
+
+// isDisplayableImage returns whether the mediatype is an image that can be
+// decoded and shown inline.
+func isDisplayableImage(mediatype string) bool {
+	switch mediatype {
+	case "image/png", "image/jpeg", "image/gif":
+		return ImageMode() != ImagesOff
+	}
+	return false
+}
+
+// ErrImageTooLarge is returned when an image is wider or taller than
+// "a-general.image_max_dimension" allows.
+var ErrImageTooLarge = errors.New("image dimensions are too large to display")
+
+// DecodeImage decodes a PNG, JPEG, or GIF image. Only the first frame of
+// animated GIFs is used. The dimensions are checked before decoding,
+// because a small file can describe an image that needs gigabytes of memory.
+func DecodeImage(raw string) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(strings.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	max := viper.GetInt("a-general.image_max_dimension")
+	if max <= 0 {
+		max = 8192
+	}
+	if cfg.Width > max || cfg.Height > max {
+		return nil, ErrImageTooLarge
+	}
+	img, _, err := image.Decode(strings.NewReader(raw))
+	return img, err
+}
+
+// ImageSize returns the size in cells an image will take up when it's
+// scaled to fit in the width, keeping the aspect ratio. Cells are
+// assumed to be twice as tall as they are wide.
+func ImageSize(img image.Image, width int) (int, int) {
+	b := img.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 || width <= 0 {
+		return 0, 0
+	}
+	cols := b.Dx()
+	if cols > width {
+		cols = width
+	}
+	// Each cell is two pixels tall when using half blocks
+	rows := (b.Dy()*cols/b.Dx() + 1) / 2
+	if rows < 1 {
+		rows = 1
+	}
+	return cols, rows
+}
+
+// scaleImage resizes the image to w×h pixels, averaging the pixels that
+// are combined when shrinking.
+func scaleImage(img image.Image, w, h int) *image.NRGBA {
+	b := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := b.Min.Y + (y+1)*b.Dy()/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := b.Min.X + (x+1)*b.Dx()/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBAModel.Convert(img.At(sx, sy)).(color.NRGBA)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					bl += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			out.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / n), G: uint8(g / n), B: uint8(bl / n), A: uint8(a / n),
+			})
+		}
+	}
+	return out
+}
+
+// colorTag returns the cview color for a pixel, or "-" for the default color
+// if it's mostly transparent.
+func colorTag(c color.NRGBA) string {
+	if c.A < 128 {
+		return "-"
+	}
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// shades are used for images when color is disabled, from dark to light.
+var shades = []rune{' ', '░', '▒', '▓', '█'}
+
+func shade(c color.NRGBA) rune {
+	if c.A < 128 {
+		return ' '
+	}
+	// Rec. 601 luma
+	y := (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000
+	return shades[y*len(shades)/256]
+}
+
+// RenderImage renders an image with Unicode half blocks and true color,
+// scaled to fit in the width. Each cell shows two pixels, one above the other.
+// If color is disabled, shaded blocks are used instead.
+func RenderImage(img image.Image, width int) string {
+	cols, rows := ImageSize(img, width)
+	if cols == 0 {
+		return ""
+	}
+	px := scaleImage(img, cols, rows*2)
+	useColor := viper.GetBool("a-general.color")
+
+	var buf strings.Builder
+	for row := 0; row < rows; row++ {
+		prevFg, prevBg := "", ""
+		for col := 0; col < cols; col++ {
+			top := px.NRGBAAt(col, row*2)
+			bottom := px.NRGBAAt(col, row*2+1)
+
+			if !useColor {
+				buf.WriteRune(shade(top))
+				continue
+			}
+
+			fg, bg, char := colorTag(top), colorTag(bottom), "▀"
+			if fg == "-" {
+				// Only the bottom pixel is shown, use the other half block
+				fg, bg, char = bg, "-", "▄"
+			}
+			if fg == "-" {
+				// Fully transparent
+				char = " "
+			}
+			if fg != prevFg || bg != prevBg {
+				fmt.Fprintf(&buf, "[%s:%s]", fg, bg)
+				prevFg, prevBg = fg, bg
+			}
+			buf.WriteString(char)
+		}
+		if useColor {
+			buf.WriteString("[-:-:-]")
+		}
+		buf.WriteString("\r\n")
+	}
+	return buf.String()
+}
+
+// RenderImagePage renders an image for displaying as a page. When a terminal
+// graphics protocol is used, the page only has space for the image, which
+// is drawn over it later.
+func RenderImagePage(img image.Image, width int) string {
+	if ImageMode() == ImagesHalfBlock {
+		return RenderImage(img, width)
+	}
+	_, rows := ImageSize(img, width)
+	return ImagePlaceholder(rows)
+}
+
+// ImagePlaceholder returns blank lines that take up the space of an image
+// that is drawn using a terminal graphics protocol.
+func ImagePlaceholder(rows int) string {
+	return strings.Repeat("\r\n", rows)
+}
+
+// EncodeSixel encodes the image as sixel graphics w×h pixels in size, using
+// a 6×6×6 color cube for the palette.
+func EncodeSixel(img image.Image, w, h int) []byte {
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+	px := scaleImage(img, w, h)
+
+	// Map each pixel to a palette index, -1 for transparent
+	level := func(v uint8) int { return (int(v)*5 + 127) / 255 }
+	idx := make([]int, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := px.NRGBAAt(x, y)
+			if c.A < 128 {
+				idx[y*w+x] = -1
+				continue
+			}
+			idx[y*w+x] = level(c.R)*36 + level(c.G)*6 + level(c.B)
+		}
+	}
+
+	var buf bytes.Buffer
+	// P2=1 means transparent pixels are left alone
+	buf.WriteString("\x1bP0;1;0q")
+	fmt.Fprintf(&buf, "\"1;1;%d;%d", w, h)
+	for i := 0; i < 216; i++ {
+		// Sixel colors are percentages
+		fmt.Fprintf(&buf, "#%d;2;%d;%d;%d", i, i/36*20, i/6%6*20, i%6*20)
+	}
+
+	for band := 0; band < h; band += 6 {
+		// Find the colors used in this band
+		used := make(map[int]bool)
+		for y := band; y < band+6 && y < h; y++ {
+			for x := 0; x < w; x++ {
+				if i := idx[y*w+x]; i >= 0 {
+					used[i] = true
+				}
+			}
+		}
+		for c := 0; c < 216; c++ {
+			if !used[c] {
+				continue
+			}
+			fmt.Fprintf(&buf, "#%d", c)
+			// Run-length encode the sixels for this color
+			prev, run := byte(0), 0
+			flush := func() {
+				switch {
+				case run > 3:
+					fmt.Fprintf(&buf, "!%d%c", run, prev)
+				case run > 0:
+					buf.Write(bytes.Repeat([]byte{prev}, run))
+				}
+			}
+			for x := 0; x < w; x++ {
+				var bits byte
+				for i := 0; i < 6 && band+i < h; i++ {
+					if idx[(band+i)*w+x] == c {
+						bits |= 1 << i
+					}
+				}
+				ch := bits + 63
+				if ch == prev {
+					run++
+					continue
+				}
+				flush()
+				prev, run = ch, 1
+			}
+			flush()
+			buf.WriteByte('$') // Back to the start of the band
+		}
+		buf.WriteByte('-') // Next band
+	}
+	buf.WriteString("\x1b\\")
+	return buf.Bytes()
+}
+
+// EncodeKitty encodes the image using the kitty graphics protocol, scaled by
+// the terminal to fill cols×rows cells. Either can be zero. Responses from the terminal are
+// turned off, so they aren't mistaken for input.
+func EncodeKitty(img image.Image, cols, rows int) ([]byte, error) {
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, img); err != nil {
+		return nil, err
+	}
+	data := base64.StdEncoding.EncodeToString(pngBuf.Bytes())
+
+	var buf bytes.Buffer
+	const chunkSize = 4096
+	for i := 0; i < len(data); i += chunkSize {
+		end := i + chunkSize
+		more := 1
+		if end >= len(data) {
+			end = len(data)
+			more = 0
+		}
+		if i == 0 {
+			buf.WriteString("\x1b_Ga=T,f=100,q=2,C=1")
+			// If only one of these is set, the terminal keeps the aspect ratio
+			if cols > 0 {
+				fmt.Fprintf(&buf, ",c=%d", cols)
+			}
+			if rows > 0 {
+				fmt.Fprintf(&buf, ",r=%d", rows)
+			}
+			fmt.Fprintf(&buf, ",m=%d;", more)
+		} else {
+			fmt.Fprintf(&buf, "\x1b_Gm=%d;", more)
+		}
+		buf.WriteString(data[i:end])
+		buf.WriteString("\x1b\\")
+	}
+	return buf.Bytes(), nil
+}
+
+// KittyDeleteAll is the kitty graphics command to remove all images from the screen.
+const KittyDeleteAll = "\x1b_Ga=d,q=2\x1b\\"
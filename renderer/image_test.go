@@ -0,0 +1,94 @@
+package renderer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// testImage returns a w×h image with a red top half and a blue bottom half.
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if y < h/2 {
+				img.SetNRGBA(x, y, color.NRGBA{255, 0, 0, 255})
+			} else {
+				img.SetNRGBA(x, y, color.NRGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestImageSize(t *testing.T) {
+	cols, rows := ImageSize(testImage(10, 10), 80)
+	assert.Equal(t, 10, cols, "small images aren't scaled up")
+	assert.Equal(t, 5, rows, "each cell is two pixels tall")
+
+	cols, rows = ImageSize(testImage(160, 80), 80)
+	assert.Equal(t, 80, cols)
+	assert.Equal(t, 20, rows)
+}
+
+func TestDecodeImage(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, testImage(4, 2)))
+	img, err := DecodeImage(buf.String())
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 4, 2), img.Bounds())
+
+	_, err = DecodeImage("not an image")
+	assert.Error(t, err)
+
+	viper.Set("a-general.image_max_dimension", 3)
+	defer viper.Set("a-general.image_max_dimension", nil)
+	_, err = DecodeImage(buf.String())
+	assert.ErrorIs(t, err, ErrImageTooLarge, "images are checked before they're decoded")
+}
+
+func TestRenderImage(t *testing.T) {
+	viper.Set("a-general.color", true)
+	defer viper.Set("a-general.color", nil)
+
+	// One row of cells, with red pixels above blue ones
+	assert.Equal(t, "[#ff0000:#0000ff]▀▀[-:-:-]\r\n", RenderImage(testImage(2, 2), 80))
+
+	transparent := image.NewNRGBA(image.Rect(0, 0, 1, 2))
+	transparent.SetNRGBA(0, 1, color.NRGBA{0, 0, 255, 255})
+	assert.Equal(t, "[#0000ff:-]▄[-:-:-]\r\n", RenderImage(transparent, 80),
+		"transparent top pixels should use the lower half block")
+
+	viper.Set("a-general.color", false)
+	assert.Equal(t, "░░\r\n", RenderImage(testImage(2, 2), 80), "red is dark")
+}
+
+func TestEncodeSixel(t *testing.T) {
+	data := string(EncodeSixel(testImage(4, 6), 4, 6))
+	assert.True(t, strings.HasPrefix(data, "\x1bP0;1;0q\"1;1;4;6"))
+	assert.True(t, strings.HasSuffix(data, "\x1b\\"))
+	// Red is color 180 in the cube and covers the top three pixels of the band,
+	// blue is color 5 and covers the bottom three
+	assert.Contains(t, data, "#180!4F$")
+	assert.Contains(t, data, "#5!4w$")
+}
+
+func TestEncodeKitty(t *testing.T) {
+	// Noise doesn't compress well, so the PNG is large enough to be split
+	img := testImage(100, 100)
+	rand.New(rand.NewSource(1)).Read(img.Pix) //nolint:gosec
+	data, err := EncodeKitty(img, 10, 0)
+	assert.NoError(t, err)
+	s := string(data)
+	assert.True(t, strings.HasPrefix(s, "\x1b_Ga=T,f=100,q=2,C=1,c=10,m="))
+	assert.NotContains(t, s, ",r=")
+	assert.Contains(t, s, "\x1b_Gm=0;", "the image should be split into chunks")
+	assert.True(t, strings.HasSuffix(s, "\x1b\\"))
+}
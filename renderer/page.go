@@ -49,6 +49,41 @@ func decodeMeta(meta string) (string, map[string]string, error) {
 	return mediatype, params, err
 }
 
+// decodeText converts text in the charset to UTF-8.
+func decodeText(charset, s string) (string, error) {
+	if isUTF8(charset) {
+		return s, nil
+	}
+	encoding, err := ianaindex.MIME.Encoding(charset)
+	if encoding == nil || err != nil {
+		// Some encoding doesn't exist and wasn't caught in CanDisplay()
+		return "", ErrBadEncoding
+	}
+	return encoding.NewDecoder().String(s)
+}
+
+// SearchableText returns the text of a response body for searching, without
+// rendering it. Formats that are rendered as gemtext are converted to it,
+// and other text is returned as is. It returns false if the body isn't text.
+func SearchableText(meta string, body []byte) (string, bool) {
+	mediatype, params, err := decodeMeta(meta)
+	if err != nil {
+		return "", false
+	}
+	format, converted := ConvertedMediatype(mediatype)
+	if !converted && !strings.HasPrefix(mediatype, "text/") {
+		return "", false
+	}
+	text, err := decodeText(params["charset"], string(body))
+	if err != nil {
+		return "", false
+	}
+	if converted {
+		return ToGemini(format, text), true
+	}
+	return text, true
+}
+
 // CanDisplay returns true if the response is supported by Amfora
 // for displaying on the screen.
 // It also doubles as a function to detect whether something can be stored in a Page struct.
@@ -61,7 +96,11 @@ func CanDisplay(res *gemini.Response) bool {
 	if err != nil {
 		return false
 	}
-	if !strings.HasPrefix(mediatype, "text/") {
+	if isDisplayableImage(mediatype) {
+		return true
+	}
+	if _, ok := ConvertedMediatype(mediatype); !ok && !strings.HasPrefix(mediatype, "text/") {
+		// Converted types include some that aren't text/*, like gopher menus
 		// Amfora doesn't support other filetypes
 		return false
 	}
@@ -101,24 +140,36 @@ func MakePage(url string, res *gemini.Response, width int, proxied bool) (*struc
 
 	mediatype, params, _ := decodeMeta(res.Meta)
 
-	// Convert content first
-	var utfText string
-	if isUTF8(params["charset"]) {
-		utfText = buf.String()
-	} else {
-		encoding, err := ianaindex.MIME.Encoding(params["charset"])
-		if encoding == nil || err != nil {
-			// Some encoding doesn't exist and wasn't caught in CanDisplay()
-			return nil, ErrBadEncoding
-		}
-		utfText, err = encoding.NewDecoder().String(buf.String())
+	if isDisplayableImage(mediatype) {
+		img, err := DecodeImage(buf.String())
 		if err != nil {
 			return nil, err
 		}
+		return &structs.Page{
+			Mediatype:    structs.Image,
+			RawMediatype: mediatype,
+			URL:          url,
+			Raw:          buf.String(),
+			Content:      RenderImagePage(img, width),
+			Links:        []string{},
+			MadeAt:       time.Now(),
+		}, nil
+	}
+
+	// Convert content first
+	utfText, err := decodeText(params["charset"], buf.String())
+	if err != nil {
+		return nil, err
 	}
 
 	if mediatype == "text/gemini" {
-		rendered, links := RenderGemini(utfText, width, proxied)
+		var rendered string
+		var links []string
+		if strings.HasPrefix(url, "spartan://") {
+			rendered, links = RenderSpartan(utfText, width)
+		} else {
+			rendered, links = RenderGemini(utfText, width, proxied)
+		}
 		return &structs.Page{
 			Mediatype:    structs.TextGemini,
 			RawMediatype: mediatype,
@@ -128,6 +179,17 @@ func MakePage(url string, res *gemini.Response, width int, proxied bool) (*struc
 			Links:        links,
 			MadeAt:       time.Now(),
 		}, nil
+	} else if format, ok := ConvertedMediatype(mediatype); ok {
+		rendered, links := RenderGemini(ToGemini(format, utfText), width, proxied)
+		return &structs.Page{
+			Mediatype:    format,
+			RawMediatype: mediatype,
+			URL:          url,
+			Raw:          utfText,
+			Content:      rendered,
+			Links:        links,
+			MadeAt:       time.Now(),
+		}, nil
 	} else if strings.HasPrefix(mediatype, "text/") {
 		if mediatype == "text/x-ansi" || strings.HasSuffix(url, ".ans") || strings.HasSuffix(url, ".ansi") {
 			// ANSI
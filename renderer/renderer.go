@@ -32,6 +32,21 @@ var langRegex = regexp.MustCompile(`^([a-zA-Z0-9]+/)?[a-zA-Z0-9]+([a-zA-Z0-9!_\#
 // Regex for removing trailing newline (without disturbing ANSI codes) from code formatted with Chroma
 var trailingNewline = regexp.MustCompile(`(\r?\n)(?:\x1b\[[0-9;]*m)*$`)
 
+// LineSource is where a line of rendered text/gemini came from, so text found
+// in the source can be found in the rendered page too.
+type LineSource struct {
+	Line   int // Index of the source line
+	Start  int // Byte offset in the source line where the shown text starts, after markup like "=> url"
+	Prefix int // Bytes of shown text the renderer added before it, like link numbers, bullets, and indents
+}
+
+// shownLen returns the number of bytes of text that are shown for s, which
+// has cview tags.
+func shownLen(s string) int {
+	text, _, _ := VisibleText(s)
+	return len(text)
+}
+
 // RenderANSI renders plain text pages containing ANSI codes.
 // Practically, it is used for the text/x-ansi.
 func RenderANSI(s string) string {
@@ -44,6 +59,12 @@ func RenderANSI(s string) string {
 	return s
 }
 
+// StripANSI removes ANSI color codes from s, leaving the text that
+// RenderANSI shows for it.
+func StripANSI(s string) string {
+	return ansiRegex.ReplaceAllString(s, "")
+}
+
 // RenderPlainText should be used to format plain text pages.
 func RenderPlainText(s string) string {
 	// It used to add a left margin, now this is done elsewhere.
@@ -100,13 +121,33 @@ func wrapLine(line string, width int, prefix, suffix string, includeFirst bool)
 //
 // proxied is whether the request is through the gemini:// scheme.
 // If it's not a gemini:// page, set this to true.
-func convertRegularGemini(s string, numLinks, width int, proxied bool) (string, []string) {
+//
+// prompts is whether Spartan prompt lines (=:) are links that ask for input.
+// On other pages they're regular text.
+//
+// Where each line came from is returned last, with line indexes in s.
+func convertRegularGemini(s string, numLinks, width int, proxied, prompts bool) (string, []string, []LineSource) {
 	links := make([]string, 0)
 	lines := strings.Split(s, "\n")
 	wrappedLines := make([]string, 0) // Final result
+	sources := make([]LineSource, 0)
+
+	// add adds the wrapped lines of source line i, which show it from byte start on.
+	// first and rest are the bytes of shown text added before it on the first line and the others.
+	add := func(wrapped []string, i, start, first, rest int) {
+		for j := range wrapped {
+			prefix := rest
+			if j == 0 {
+				prefix = first
+			}
+			sources = append(sources, LineSource{Line: i, Start: start, Prefix: prefix})
+		}
+		wrappedLines = append(wrappedLines, wrapped...)
+	}
 
 	for i := range lines {
 		lines[i] = strings.TrimRight(lines[i], " \r\t\n")
+		line := lines[i] // Before the markup is removed
 
 		if strings.HasPrefix(lines[i], "#") {
 			// Headings
@@ -119,19 +160,25 @@ func convertRegularGemini(s string, numLinks, width int, proxied bool) (string,
 				} else if strings.HasPrefix(lines[i], "#") {
 					tag = fmt.Sprintf("[%s::b]", config.GetColorString("hdg_1"))
 				}
-				wrappedLines = append(wrappedLines, wrapLine(lines[i], width, tag, "[-::-]", true)...)
+				add(wrapLine(lines[i], width, tag, "[-::-]", true), i, 0, 0, 0)
 			} else {
 				// Just bold, no colors
-				wrappedLines = append(wrappedLines, wrapLine(lines[i], width, "[::b]", "[-::-]", true)...)
+				add(wrapLine(lines[i], width, "[::b]", "[-::-]", true), i, 0, 0, 0)
 			}
 
 			// Links
-		} else if strings.HasPrefix(lines[i], "=>") && len([]rune(lines[i])) >= 3 {
+		} else if (strings.HasPrefix(lines[i], "=>") || (prompts && strings.HasPrefix(lines[i], "=:"))) &&
+			len([]rune(lines[i])) >= 3 {
 			// Trim whitespace and separate link from link text
+			// Spartan prompt lines (=:) are links that ask for input
 
+			prompt := lines[i][1] == ':'
 			lines[i] = strings.Trim(lines[i][2:], " \t") // Remove `=>` part too
 			delim := strings.IndexAny(lines[i], " \t")   // Whitespace between link and link text
 
+			// Where the link text starts in the line
+			start := len(line) - len(strings.TrimLeft(line[2:], " \t"))
+
 			var url string
 			var linkText string
 			if delim == -1 {
@@ -142,6 +189,7 @@ func convertRegularGemini(s string, numLinks, width int, proxied bool) (string,
 				// There is link text
 				url = lines[i][:delim]
 				linkText = strings.Trim(lines[i][delim:], " \t")
+				start += len(lines[i]) - len(strings.TrimLeft(lines[i][delim:], " \t"))
 				if viper.GetBool("a-general.show_link") {
 					linkText += " (" + url + ")"
 				}
@@ -150,10 +198,14 @@ func convertRegularGemini(s string, numLinks, width int, proxied bool) (string,
 			if strings.TrimSpace(lines[i]) == "" || strings.TrimSpace(url) == "" {
 				// Link was just whitespace, reset it and move on
 				lines[i] = "=>"
-				wrappedLines = append(wrappedLines, lines[i])
+				add([]string{lines[i]}, i, 0, 0, 0)
 				continue
 			}
 
+			if prompt && !strings.Contains(url, "?") {
+				// An empty query means input is needed, see client.FetchSpartan
+				url += "?"
+			}
 			links = append(links, url)
 			num := numLinks + len(links) // Visible link number, one-indexed
 
@@ -190,6 +242,7 @@ func convertRegularGemini(s string, numLinks, width int, proxied bool) (string,
 			// Add them to the first line
 
 			var wrappedLink []string
+			var first string // Added before the first line
 
 			pU, err := urlPkg.Parse(url)
 			if !proxied && err == nil &&
@@ -208,10 +261,10 @@ func convertRegularGemini(s string, numLinks, width int, proxied bool) (string,
 					)
 
 					// Add special stuff to first line, like the link number
-					wrappedLink[0] = fmt.Sprintf(`[%s::b][`, config.GetColorString("link_number")) +
+					first = fmt.Sprintf(`[%s::b][`, config.GetColorString("link_number")) +
 						strconv.Itoa(num) + "[]" + "[-::-]" + spacing +
-						`["` + strconv.Itoa(num-1) + `"][` + config.GetColorString("amfora_link") + `]` +
-						wrappedLink[0] + `[-][""]`
+						`["` + strconv.Itoa(num-1) + `"][` + config.GetColorString("amfora_link") + `]`
+					wrappedLink[0] = first + wrappedLink[0] + `[-][""]`
 				} else {
 					// No color
 
@@ -222,9 +275,9 @@ func convertRegularGemini(s string, numLinks, width int, proxied bool) (string,
 						false, // Don't indent the first line, it's the one with link number
 					)
 
-					wrappedLink[0] = `[::b][` + strconv.Itoa(num) + "[][::-]  " +
-						`["` + strconv.Itoa(num-1) + `"]` +
-						wrappedLink[0] + `[""]`
+					first = `[::b][` + strconv.Itoa(num) + "[][::-]  " +
+						`["` + strconv.Itoa(num-1) + `"]`
+					wrappedLink[0] = first + wrappedLink[0] + `[""]`
 				}
 			} else {
 				// Not a gemini link
@@ -239,10 +292,10 @@ func convertRegularGemini(s string, numLinks, width int, proxied bool) (string,
 						false, // Don't indent the first line, it's the one with link number
 					)
 
-					wrappedLink[0] = fmt.Sprintf(`[%s::b][`, config.GetColorString("link_number")) +
+					first = fmt.Sprintf(`[%s::b][`, config.GetColorString("link_number")) +
 						strconv.Itoa(num) + "[][-::-]" + spacing +
-						`["` + strconv.Itoa(num-1) + `"]` + linkTag +
-						wrappedLink[0] + `[-::-][""]`
+						`["` + strconv.Itoa(num-1) + `"]` + linkTag
+					wrappedLink[0] = first + wrappedLink[0] + `[-::-][""]`
 				} else {
 					// No color
 
@@ -253,13 +306,13 @@ func convertRegularGemini(s string, numLinks, width int, proxied bool) (string,
 						false, // Don't indent the first line, it's the one with link number
 					)
 
-					wrappedLink[0] = `[::b][` + strconv.Itoa(num) + "[][::-]" + spacing +
-						`["` + strconv.Itoa(num-1) + `"]` +
-						wrappedLink[0] + `[::-][""]`
+					first = `[::b][` + strconv.Itoa(num) + "[][::-]" + spacing +
+						`["` + strconv.Itoa(num-1) + `"]`
+					wrappedLink[0] = first + wrappedLink[0] + `[::-][""]`
 				}
 			}
 
-			wrappedLines = append(wrappedLines, wrappedLink...)
+			add(wrappedLink, i, shownLen(line[:start]), shownLen(first), indent)
 
 			// Lists
 		} else if strings.HasPrefix(lines[i], "* ") {
@@ -272,7 +325,7 @@ func convertRegularGemini(s string, numLinks, width int, proxied bool) (string,
 				// Add bullet
 				wrappedItem[0] = fmt.Sprintf(" [%s]\u2022", config.GetColorString("list_text")) +
 					wrappedItem[0] + "[-]"
-				wrappedLines = append(wrappedLines, wrappedItem...)
+				add(wrappedItem, i, 1, len(" \u2022"), 4)
 			} else {
 				wrappedItem := wrapLine(lines[i][1:],
 					width-4, // Subtract the 4 indent spaces
@@ -281,7 +334,7 @@ func convertRegularGemini(s string, numLinks, width int, proxied bool) (string,
 				// Add "*"
 				wrappedItem[0] = fmt.Sprintf(" [%s]*", config.GetColorString("list_text")) +
 					wrappedItem[0] + "[-]"
-				wrappedLines = append(wrappedLines, wrappedItem...)
+				add(wrappedItem, i, 1, len(" *"), 4)
 
 			}
 			// Optionally list lines could be colored here too, if color is enabled
@@ -290,31 +343,31 @@ func convertRegularGemini(s string, numLinks, width int, proxied bool) (string,
 
 			if len(lines[i]) == 1 {
 				// Just an empty quote line
-				wrappedLines = append(wrappedLines, fmt.Sprintf("[%s::i]>[-::-]", config.GetColorString("quote_text")))
+				add([]string{fmt.Sprintf("[%s::i]>[-::-]", config.GetColorString("quote_text"))}, i, 0, 0, 0)
 			} else {
 				// Remove beginning quote and maybe space
 				lines[i] = strings.TrimPrefix(lines[i], ">")
 				lines[i] = strings.TrimPrefix(lines[i], " ")
-				wrappedLines = append(wrappedLines,
-					wrapLine(lines[i],
-						width-2, // Subtract 2 for width of prefix string
-						fmt.Sprintf("[%s::i]> ", config.GetColorString("quote_text")),
-						"[-::-]", true)...,
+				add(wrapLine(lines[i],
+					width-2, // Subtract 2 for width of prefix string
+					fmt.Sprintf("[%s::i]> ", config.GetColorString("quote_text")),
+					"[-::-]", true),
+					i, len(line)-len(lines[i]), 2, 2,
 				)
 			}
 
 		} else if strings.TrimSpace(lines[i]) == "" {
 			// Just add empty line without processing
-			wrappedLines = append(wrappedLines, "")
+			add([]string{""}, i, 0, 0, 0)
 		} else {
 			// Regular line, just wrap it
-			wrappedLines = append(wrappedLines, wrapLine(lines[i], width,
+			add(wrapLine(lines[i], width,
 				fmt.Sprintf("[%s]", config.GetColorString("regular_text")),
-				"[-]", true)...)
+				"[-]", true), i, 0, 0, 0)
 		}
 	}
 
-	return strings.Join(wrappedLines, "\r\n"), links
+	return strings.Join(wrappedLines, "\r\n"), links, sources
 }
 
 // RenderGemini converts text/gemini into a cview displayable format.
@@ -326,10 +379,39 @@ func convertRegularGemini(s string, numLinks, width int, proxied bool) (string,
 // proxied is whether the request is through the gemini:// scheme.
 // If it's not a gemini:// page, set this to true.
 func RenderGemini(s string, width int, proxied bool) (string, []string) {
+	rendered, links, _ := renderGemini(s, width, proxied, false)
+	return rendered, links
+}
+
+// RenderSpartan is like RenderGemini, but for text/gemini from spartan://
+// pages, where prompt lines (=:) are links that ask for input.
+func RenderSpartan(s string, width int) (string, []string) {
+	rendered, links, _ := renderGemini(s, width, true, true)
+	return rendered, links
+}
+
+// GeminiSources returns where each line of the text rendered from s came
+// from, so text found in s can be found in the rendered page too. The
+// arguments are the same as for RenderGemini, and spartan is whether it's
+// rendered with RenderSpartan instead.
+//
+// Lines at the end of the rendered text can be missing, if they don't show
+// anything from s.
+func GeminiSources(s string, width int, proxied, spartan bool) []LineSource {
+	if spartan {
+		proxied = true
+	}
+	_, _, sources := renderGemini(s, width, proxied, spartan)
+	return sources
+}
+
+func renderGemini(s string, width int, proxied, prompts bool) (string, []string, []LineSource) {
 	s = cview.Escape(s)
 
 	lines := strings.Split(s, "\n")
 	links := make([]string, 0)
+	sources := make([]LineSource, 0, len(lines))
+	bufStart := 0 // Index of the first line in buf
 
 	// Process and wrap non preformatted lines
 	rendered := "" // Final result
@@ -397,6 +479,11 @@ func RenderGemini(s string, width int, proxied bool) (string, []string) {
 		// Lines are modified below to always end with \r\n
 		buf = strings.TrimSuffix(buf, "\r\n")
 
+		// Preformatted lines are shown as they are
+		for j := 0; j <= strings.Count(buf, "\n"); j++ {
+			sources = append(sources, LineSource{Line: bufStart + j})
+		}
+
 		if viper.GetBool("a-general.color") {
 			rendered += fmt.Sprintf("[%s]", config.GetColorString("preformatted_text")) +
 				buf + fmt.Sprintf("[%s:%s:-]\r\n", config.GetColorString("regular_text"), config.GetColorString("bg"))
@@ -410,9 +497,15 @@ func RenderGemini(s string, width int, proxied bool) (string, []string) {
 		// ANSI not allowed in regular text - see #59
 		buf = ansiRegex.ReplaceAllString(buf, "")
 
-		ren, lks := convertRegularGemini(buf, len(links), width, proxied)
+		ren, lks, srcs := convertRegularGemini(buf, len(links), width, proxied, prompts)
 		links = append(links, lks...)
 		rendered += ren
+
+		// The last line is empty, after the final newline of buf
+		for _, src := range srcs[:len(srcs)-1] {
+			src.Line += bufStart
+			sources = append(sources, src)
+		}
 	}
 
 	for i := range lines {
@@ -439,6 +532,7 @@ func RenderGemini(s string, width int, proxied bool) (string, []string) {
 				}
 			}
 			buf = "" // Clear buffer for next block
+			bufStart = i + 1
 			pre = !pre
 			continue
 		}
@@ -454,5 +548,5 @@ func RenderGemini(s string, width int, proxied bool) (string, []string) {
 		processRegular()
 	}
 
-	return rendered, links
+	return rendered, links, sources
 }
@@ -0,0 +1,35 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromptLinks(t *testing.T) {
+	page := "=> /page Page\n=: /echo Say something\n=: /search?q Search\n"
+	_, links := RenderSpartan(page, 80)
+	assert.Equal(t, []string{"/page", "/echo?", "/search?q"}, links)
+
+	rendered, links := RenderGemini(page, 80, false)
+	assert.Equal(t, []string{"/page"}, links, "prompt lines are only links on Spartan pages")
+	assert.Contains(t, rendered, "=: /echo Say something")
+}
+
+func TestGeminiSources(t *testing.T) {
+	page := "# Title\n=> gemini://example.com/[x]  Example [link]\n* item\n> quote\n```\npre\n```\ntext\n"
+	rendered, _ := RenderGemini(page, 80, false)
+	sources := GeminiSources(page, 80, false, false)
+	source := strings.Split(page, "\n")
+
+	text, _, _ := VisibleText(rendered)
+	shown := strings.Split(text, "\r\n")
+	assert.Equal(t, []int{0, 1, 2, 3, 5, 7}, []int{
+		sources[0].Line, sources[1].Line, sources[2].Line,
+		sources[3].Line, sources[4].Line, sources[5].Line,
+	})
+	for i, src := range sources {
+		assert.Equal(t, source[src.Line][src.Start:], shown[i][src.Prefix:], "line %d", i)
+	}
+}
@@ -0,0 +1,161 @@
+// Package search finds text in local documents, like cached pages and
+// bookmarks. It ranks the matches and makes snippets to show them.
+package search
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Doc is a document that can be searched.
+type Doc struct {
+	URL   string
+	Title string
+	Text  string // Gemtext or plain text, can be empty
+}
+
+// Result is a document that matched a query.
+type Result struct {
+	*Doc
+	Snippet string // The line of the text where the query was found, or empty
+	score   int
+}
+
+// Query is a parsed search query. All of its terms must be found in a
+// document for it to match, ignoring case.
+type Query struct {
+	terms []string
+	regex *regexp.Regexp // Matches any of the terms
+}
+
+// NewQuery parses a query. Terms are separated by spaces. It returns nil if
+// there are no terms.
+func NewQuery(s string) *Query {
+	terms := strings.Fields(strings.ToLower(s))
+	if len(terms) == 0 {
+		return nil
+	}
+	quoted := make([]string, len(terms))
+	for i := range terms {
+		quoted[i] = regexp.QuoteMeta(terms[i])
+	}
+	// Longer terms first, so they're highlighted instead of terms inside them
+	sort.SliceStable(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	return &Query{
+		terms: terms,
+		regex: regexp.MustCompile("(?i)" + strings.Join(quoted, "|")),
+	}
+}
+
+// matches returns whether all the terms are in one of the strings.
+func (q *Query) matches(strs ...string) bool {
+	for _, term := range q.terms {
+		found := false
+		for _, s := range strs {
+			if strings.Contains(strings.ToLower(s), term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// count returns how many times the terms are in s.
+func (q *Query) count(s string) int {
+	return len(q.regex.FindAllStringIndex(s, -1))
+}
+
+// Search returns the documents that match the query, the best matches
+// first. Matches in the title or URL count for more than in the text.
+// Documents that tie stay in the same order.
+func (q *Query) Search(docs []*Doc, snippetWidth int) []*Result {
+	results := make([]*Result, 0)
+	for _, d := range docs {
+		if !q.matches(d.Title, d.URL, d.Text) {
+			continue
+		}
+		r := &Result{
+			Doc:     d,
+			Snippet: q.Snippet(d.Text, snippetWidth),
+			score:   10*q.count(d.Title) + 5*q.count(d.URL) + q.count(d.Text),
+		}
+		results = append(results, r)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].score > results[j].score
+	})
+	return results
+}
+
+// lineMarkers are removed from the start of gemtext lines in snippets.
+var lineMarkers = regexp.MustCompile("^(=>|```|#+|\\*|>)[ \t]*")
+
+// Snippet returns the first line of the text that has the most terms in
+// it, cut down to about width characters around the first match. Gemtext
+// line types like headings and quotes are removed, and so are link URLs if
+// the terms are in the link text. It returns an empty string if none of the
+// terms are in the text.
+func (q *Query) Snippet(text string, width int) string {
+	best := ""
+	bestCount := 0
+	for _, line := range strings.Split(text, "\n") {
+		if n := q.count(line); n > bestCount {
+			best, bestCount = line, n
+			if n >= len(q.terms) {
+				break
+			}
+		}
+	}
+	if bestCount == 0 {
+		return ""
+	}
+	best = strings.TrimSpace(best)
+	if strings.HasPrefix(best, "=>") {
+		// Only the link text is used, if there is some
+		if fields := strings.Fields(best[2:]); len(fields) > 1 && q.count(strings.Join(fields[1:], " ")) > 0 {
+			best = strings.Join(fields[1:], " ")
+		}
+	}
+	best = strings.Join(strings.Fields(lineMarkers.ReplaceAllString(best, "")), " ")
+	if utf8.RuneCountInString(best) <= width {
+		return best
+	}
+
+	// Cut it down, with the first match about a third of the way in
+	matchStart := 0
+	if loc := q.regex.FindStringIndex(best); loc != nil {
+		// It might not be found if the match was in a line marker
+		matchStart = utf8.RuneCountInString(best[:loc[0]])
+	}
+	runes := []rune(best)
+	start := matchStart - width/3
+	if start < 0 {
+		start = 0
+	}
+	end := start + width
+	if end > len(runes) {
+		end = len(runes)
+		start = end - width
+	}
+	snippet := strings.TrimSpace(string(runes[start:end]))
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// Highlight puts before and after around each of the terms in s.
+func (q *Query) Highlight(s, before, after string) string {
+	return q.regex.ReplaceAllStringFunc(s, func(m string) string {
+		return before + m + after
+	})
+}
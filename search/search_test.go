@@ -0,0 +1,57 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewQuery(t *testing.T) {
+	assert.Nil(t, NewQuery("  "))
+	assert.NotNil(t, NewQuery("a.b (c"), "regex symbols are escaped")
+}
+
+func TestSearch(t *testing.T) {
+	docs := []*Doc{
+		{URL: "gemini://a.example/", Title: "Cooking", Text: "# Cooking\nA recipe for bread.\nMore bread, and soup."},
+		{URL: "gemini://bread.example/", Title: "Bread", Text: "Bread bread bread"},
+		{URL: "gemini://c.example/", Title: "Soup only", Text: "Soup"},
+	}
+	results := NewQuery("BREAD").Search(docs, 80)
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "gemini://bread.example/", results[0].URL, "title and URL matches rank higher")
+		assert.Equal(t, "A recipe for bread.", results[1].Snippet)
+	}
+
+	// All terms have to match
+	results = NewQuery("bread soup").Search(docs, 80)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "More bread, and soup.", results[0].Snippet, "the line with the most terms is used")
+	}
+
+	// Bookmarks and such have no text
+	results = NewQuery("only").Search(docs, 80)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "", results[0].Snippet)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	q := NewQuery("needle")
+	assert.Equal(t, "", q.Snippet("nothing here", 20))
+	assert.Equal(t, "a needle", q.Snippet("=> gemini://x a needle", 20), "gemtext line types are removed")
+
+	long := strings.Repeat("hay ", 20) + "needle" + strings.Repeat(" hay", 20)
+	s := q.Snippet(long, 30)
+	assert.Contains(t, s, "needle")
+	assert.True(t, strings.HasPrefix(s, "…") && strings.HasSuffix(s, "…"))
+	assert.LessOrEqual(t, len([]rune(s)), 32)
+
+	assert.Equal(t, "needle hay…", q.Snippet("needle hay hay hay", 10))
+}
+
+func TestHighlight(t *testing.T) {
+	q := NewQuery("gem gemini")
+	assert.Equal(t, "A <Gemini> <gem>", q.Highlight("A Gemini gem", "<", ">"))
+}
@@ -0,0 +1,236 @@
+// Package sessions saves and loads the open tabs and their history, so they
+// can be restored after quitting or a crash. Each session has a name, and is
+// stored as a JSON file in the sessions directory.
+package sessions
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/makeworld-the-better-one/amfora/structs"
+)
+
+// Default is the name of the session that is used when no other one is picked.
+const Default = "default"
+
+var ErrInvalidName = errors.New("session names can only have letters, numbers, spaces, dashes, and underscores")
+var ErrNotFound = errors.New("there is no session with that name")
+
+var nameRegex = regexp.MustCompile(`^[\p{L}\p{N}_\- ]{1,64}$`)
+
+// Entry is a URL in the history of a tab, with where the page was scrolled
+// to and which link was selected.
+type Entry struct {
+	URL        string           `json:"url"`
+	Row        int              `json:"row"`
+	Column     int              `json:"column"`
+	Selected   string           `json:"selected,omitempty"`
+	SelectedID string           `json:"selected_id,omitempty"`
+	Mode       structs.PageMode `json:"mode,omitempty"`
+}
+
+// Tab is a tab and its history. Pos is the index of the history entry that
+// is shown.
+type Tab struct {
+	History []*Entry `json:"history"`
+	Pos     int      `json:"pos"`
+}
+
+// Session is a set of tabs. Current is the index of the tab that is shown.
+type Session struct {
+	Tabs    []*Tab    `json:"tabs"`
+	Current int       `json:"current"`
+	Saved   time.Time `json:"saved"`
+}
+
+// Info describes a saved session, for listing them.
+type Info struct {
+	Name  string
+	Tabs  int
+	Saved time.Time
+}
+
+var dir string // Where sessions are saved, empty if they aren't
+var mu sync.Mutex
+
+// Init sets the directory sessions are saved to, and creates it.
+func Init(sessionDir string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	dir = sessionDir
+	return os.MkdirAll(dir, 0755)
+}
+
+// ValidName returns whether the name can be used for a session.
+func ValidName(name string) bool {
+	return nameRegex.MatchString(name) && strings.TrimSpace(name) == name
+}
+
+func path(name string) string {
+	return filepath.Join(dir, name+".json")
+}
+
+// Valid returns whether the session can be restored. Sessions with bad
+// positions are fixed.
+func (s *Session) Valid() bool {
+	tabs := make([]*Tab, 0, len(s.Tabs))
+	for _, t := range s.Tabs {
+		if t == nil || len(t.History) == 0 {
+			continue
+		}
+		ok := true
+		for _, e := range t.History {
+			if e == nil || e.URL == "" {
+				ok = false
+				break
+			}
+		}
+		if !ok {
+			continue
+		}
+		if t.Pos < 0 || t.Pos >= len(t.History) {
+			t.Pos = len(t.History) - 1
+		}
+		tabs = append(tabs, t)
+	}
+	s.Tabs = tabs
+	if s.Current < 0 || s.Current >= len(s.Tabs) {
+		s.Current = 0
+	}
+	return len(s.Tabs) > 0
+}
+
+// Save saves the session with the name, replacing any session with the same
+// name. The time it was saved at is set.
+func Save(name string, s *Session) error {
+	if !ValidName(name) {
+		return ErrInvalidName
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	if dir == "" {
+		return nil
+	}
+	s.Saved = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Written to another file first, so a crash while saving doesn't lose
+	// the last session
+	tmp := path(name) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path(name))
+}
+
+// Load returns the saved session with the name.
+func Load(name string) (*Session, error) {
+	if !ValidName(name) {
+		return nil, ErrInvalidName
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	data, err := ioutil.ReadFile(path(name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if !s.Valid() {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+// Delete removes the saved session with the name.
+func Delete(name string) error {
+	if !ValidName(name) {
+		return ErrInvalidName
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	err := os.Remove(path(name))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Rename renames a saved session, replacing any session with the new name.
+func Rename(name, newName string) error {
+	if !ValidName(name) || !ValidName(newName) {
+		return ErrInvalidName
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	err := os.Rename(path(name), path(newName))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// List returns all the saved sessions, the most recently saved first.
+// Files that can't be read are skipped.
+func List() []*Info {
+	mu.Lock()
+	defer mu.Unlock()
+
+	infos := make([]*Info, 0)
+	if dir == "" {
+		return infos
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return infos
+	}
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), ".json")
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") || !ValidName(name) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			continue
+		}
+		var s Session
+		if json.Unmarshal(data, &s) != nil || !s.Valid() {
+			continue
+		}
+		infos = append(infos, &Info{Name: name, Tabs: len(s.Tabs), Saved: s.Saved})
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].Saved.After(infos[j].Saved)
+	})
+	return infos
+}
+
+// Latest returns the name of the most recently saved session, or an empty
+// string if there are none.
+func Latest() string {
+	infos := List()
+	if len(infos) == 0 {
+		return ""
+	}
+	return infos[0].Name
+}
@@ -0,0 +1,69 @@
+package sessions
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveLoad(t *testing.T) {
+	assert.NoError(t, Init(t.TempDir()))
+
+	s := &Session{
+		Tabs: []*Tab{
+			{History: []*Entry{{URL: "about:newtab"}, {URL: "gemini://example.com/", Row: 12, SelectedID: "3"}}, Pos: 1},
+			{History: []*Entry{{URL: "about:bookmarks"}}},
+		},
+		Current: 1,
+	}
+	assert.NoError(t, Save("work", s))
+	assert.NoError(t, Save(Default, &Session{Tabs: []*Tab{{History: []*Entry{{URL: "about:newtab"}}}}}))
+
+	loaded, err := Load("work")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, loaded.Current)
+	assert.Len(t, loaded.Tabs, 2)
+	assert.Equal(t, 12, loaded.Tabs[0].History[1].Row)
+	assert.Equal(t, "3", loaded.Tabs[0].History[1].SelectedID)
+
+	infos := List()
+	assert.Len(t, infos, 2)
+	assert.Equal(t, Default, infos[0].Name, "most recent first")
+	assert.Equal(t, Default, Latest())
+
+	assert.NoError(t, Rename("work", "reading"))
+	_, err = Load("work")
+	assert.ErrorIs(t, err, ErrNotFound)
+	loaded, err = Load("reading")
+	assert.NoError(t, err)
+	assert.Len(t, loaded.Tabs, 2)
+
+	assert.NoError(t, Delete("reading"))
+	_, err = Load("reading")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, Delete("reading"), ErrNotFound)
+}
+
+func TestInvalid(t *testing.T) {
+	d := t.TempDir()
+	assert.NoError(t, Init(d))
+
+	assert.ErrorIs(t, Save("../evil", &Session{}), ErrInvalidName)
+	assert.True(t, ValidName("reading list"))
+	assert.False(t, ValidName(" padded"))
+	assert.False(t, ValidName(""))
+
+	// Broken files aren't listed
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(d, "broken.json"), []byte("{"), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(d, "empty.json"), []byte(`{"tabs": []}`), 0600))
+	assert.Empty(t, List())
+
+	// Positions out of range are fixed
+	s := &Session{Tabs: []*Tab{{History: []*Entry{{URL: "about:newtab"}}, Pos: 5}, {}}, Current: 3}
+	assert.True(t, s.Valid())
+	assert.Len(t, s.Tabs, 1)
+	assert.Equal(t, 0, s.Tabs[0].Pos)
+	assert.Equal(t, 0, s.Current)
+}
@@ -9,6 +9,14 @@ const (
 	TextGemini Mediatype = "text/gemini"
 	TextPlain  Mediatype = "text/plain"
 	TextAnsi   Mediatype = "text/x-ansi"
+	Image      Mediatype = "image" // PNG, JPEG, or GIF, shown inline
+
+	// These are converted to text/gemini for rendering, see renderer.ToGemini
+	TextMarkdown  Mediatype = "text/markdown"
+	TextCSV       Mediatype = "text/csv"
+	TextTSV       Mediatype = "text/tab-separated-values"
+	TextGophermap Mediatype = "text/gophermap"
+	TextHTML      Mediatype = "text/html"
 )
 
 type PageMode int
@@ -20,6 +28,7 @@ const (
 )
 
 // Page is for storing UTF-8 text/gemini pages, as well as text/plain pages.
+// Images that are shown inline are stored too, with the image data in Raw.
 type Page struct {
 	URL          string
 	Mediatype    Mediatype // Used for rendering purposes, generalized
@@ -34,6 +43,7 @@ type Page struct {
 	SelectedID   string    // The cview region ID for the selected text/link
 	Mode         PageMode
 	MadeAt       time.Time // When the page was made. Zero value indicates it should stay in cache forever.
+	CachedAt     time.Time // When the page was fetched, if it's being shown in offline mode. Zero otherwise.
 }
 
 // Size returns an approx. size of a Page in bytes.
@@ -456,6 +456,33 @@ func AllURLS() []string {
 	return urls
 }
 
+// Move changes the URL of a subscription, like when updateFeed finds
+// the URL was permanently redirected. It returns false if there is no
+// subscription at the old URL, or there's already one at the new URL.
+//
+// Any errors that occurred when saving to disk are returned too.
+func Move(oldURL, newURL string) (bool, error) {
+	if IsSubscribed(newURL) {
+		return false, nil
+	}
+
+	data.Lock()
+	if feed, ok := data.Feeds[oldURL]; ok {
+		data.Feeds[newURL] = feed
+		delete(data.Feeds, oldURL)
+	} else if page, ok := data.Pages[oldURL]; ok {
+		data.Pages[newURL] = page
+		delete(data.Pages, oldURL)
+	} else {
+		data.Unlock()
+		return false, nil
+	}
+	data.Unlock()
+
+	LastUpdated = time.Now()
+	return true, writeJSON()
+}
+
 // Remove removes a subscription from memory and from the disk.
 // The URL must be provided. It will do nothing if the URL is
 // not an actual subscription.
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/makeworld-the-better-one/amfora/client"
+)
+
+const tofuUsage = `Usage:
+amfora tofu export [FILE]
+amfora tofu import [--overwrite] FILE
+
+Export writes the TOFU database to FILE, or to stdout if it is not given.
+Import merges the hosts in FILE into the TOFU database. Use - to read from stdin.
+Hosts that are already pinned to a different certificate are reported, and only
+replaced if --overwrite is used. Files from Lagrange and Bombadillo can be
+imported too.`
+
+// tofuCommand runs the tofu subcommand and returns the exit code.
+func tofuCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, tofuUsage)
+		return 1
+	}
+
+	switch args[0] {
+	case "export":
+		if len(args) > 2 {
+			fmt.Fprintln(os.Stderr, tofuUsage)
+			return 1
+		}
+		w := io.Writer(os.Stdout)
+		if len(args) == 2 && args[1] != "-" {
+			f, err := os.OpenFile(args[1], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating file: %v\n", err)
+				return 1
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := client.ExportTofu(w); err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting: %v\n", err)
+			return 1
+		}
+		return 0
+	case "import":
+		overwrite := false
+		var path string
+		for _, arg := range args[1:] {
+			if arg == "--overwrite" {
+				overwrite = true
+			} else if path == "" {
+				path = arg
+			} else {
+				fmt.Fprintln(os.Stderr, tofuUsage)
+				return 1
+			}
+		}
+		if path == "" {
+			fmt.Fprintln(os.Stderr, tofuUsage)
+			return 1
+		}
+
+		r := io.Reader(os.Stdin)
+		if path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error opening file: %v\n", err)
+				return 1
+			}
+			defer f.Close()
+			r = f
+		}
+		res, err := client.ImportTofu(r, overwrite)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error importing: %v\n", err)
+			return 1
+		}
+
+		for _, s := range res.Skipped {
+			fmt.Fprintln(os.Stderr, "Skipped:", s)
+		}
+		for _, s := range res.Conflicts {
+			fmt.Fprintln(os.Stderr, "Conflict:", s)
+		}
+		fmt.Printf("%d added, %d updated, %d unchanged, %d conflicts, %d skipped\n",
+			res.Added, res.Updated, res.Unchanged, len(res.Conflicts), len(res.Skipped))
+		return 0
+	}
+
+	fmt.Fprintln(os.Stderr, tofuUsage)
+	return 1
+}